@@ -0,0 +1,493 @@
+// Command dataset-recorder records the key/value pairs of a dataset,
+// signs tree heads over them, and proves and verifies the inclusion
+// and exclusion of keys.
+//
+// The state of a recording is kept in a directory, with files:
+//
+//	state             the records, written by Recorder.WriteInternal
+//	private.key       the private VRF key of the recorder
+//	signing.key       the key signing tree heads
+//	verification.key  the key verifying tree heads
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/laurentsimon/dataset-recorder/pkg"
+)
+
+// Exit codes. verify exits with exitIncluded or exitExcluded
+// if the proof verifies, and with exitError otherwise.
+const (
+	exitIncluded = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitExcluded = 3
+)
+
+// Files of the state directory.
+const (
+	stateFile           = "state"
+	privateKeyFile      = "private.key"
+	signingKeyFile      = "signing.key"
+	verificationKeyFile = "verification.key"
+)
+
+// errUsage reports bad arguments. The flag set prints the usage.
+var errUsage = errors.New("usage")
+
+const usage = `usage: dataset-recorder <command> [flags]
+
+commands:
+  init     create the state directory and keys
+  insert   record a key and value, the value read from stdin or a file
+  commit   sign a tree head over the records, and time-stamp it
+  public   export the public data for verifiers
+  prove    write the proof of inclusion or exclusion of a key
+  verify   verify a proof against public data
+
+verify exits with 0 if the key is included, 3 if it is excluded,
+and 1 if the proof does not verify.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// command runs a subcommand with its flags.
+type command func(args []string, stdin io.Reader, stdout, stderr io.Writer) (int, error)
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) < 1 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	commands := map[string]command{
+		"init":   initCmd,
+		"insert": insertCmd,
+		"commit": commitCmd,
+		"public": publicCmd,
+		"prove":  proveCmd,
+		"verify": verifyCmd,
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	code, err := cmd(args[1:], stdin, stdout, stderr)
+	switch {
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case err != nil:
+		fmt.Fprintf(stderr, "%s: %v\n", args[0], err)
+		return exitError
+	}
+	return code
+}
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 0 {
+		fmt.Fprintf(fs.Output(), "unexpected arguments: %v\n", fs.Args())
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// labels is a repeated key=value flag.
+type labels map[string]string
+
+func (l labels) String() string {
+	var s []string
+	for k, v := range l {
+		s = append(s, k+"="+v)
+	}
+	return strings.Join(s, ",")
+}
+
+func (l labels) Set(v string) error {
+	key, value, ok := strings.Cut(v, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("label %q is not key=value", v)
+	}
+	l[key] = value
+	return nil
+}
+
+// keyFlags reads a key given as a string or in a file.
+type keyFlags struct {
+	key     *string
+	keyFile *string
+}
+
+func newKeyFlags(fs *flag.FlagSet) *keyFlags {
+	return &keyFlags{
+		key:     fs.String("key", "", "key of the record"),
+		keyFile: fs.String("key-file", "", "file containing the key of the record"),
+	}
+}
+
+func (k *keyFlags) read(fs *flag.FlagSet) ([]byte, error) {
+	switch {
+	case *k.key != "" && *k.keyFile != "":
+		fmt.Fprintln(fs.Output(), "only one of -key and -key-file can be set")
+	case *k.key != "":
+		return []byte(*k.key), nil
+	case *k.keyFile != "":
+		return os.ReadFile(*k.keyFile)
+	default:
+		fmt.Fprintln(fs.Output(), "-key or -key-file is required")
+	}
+	fs.Usage()
+	return nil, errUsage
+}
+
+// writeFile writes the file atomically, so that a failed write
+// does not leave a truncated state behind.
+func writeFile(name string, b []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+func writeJSON(name string, v any, perm os.FileMode) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(name, append(b, '\n'), perm)
+}
+
+func readJSON(name string, v any) error {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// writeOutput writes b to the file out, or to stdout if out is empty.
+func writeOutput(out string, b []byte, stdout io.Writer) error {
+	if out == "" {
+		_, err := stdout.Write(b)
+		return err
+	}
+	return writeFile(out, b, 0o644)
+}
+
+func initCmd(args []string, _ io.Reader, stdout, stderr io.Writer) (int, error) {
+	fs := newFlagSet("init", stderr)
+	dir := fs.String("dir", ".", "state directory")
+	name := fs.String("name", "", "name of the dataset")
+	hashSuite := fs.String("hash", pkg.HashSHAKE128, "hash suite of the tree")
+	vrfSuite := fs.String("vrf", pkg.VRFCONIKS, "VRF suite of the indices")
+	publicIndex := fs.Bool("public-index", false, "hash keys instead of using a VRF, for public keys")
+	treeVersion := fs.Int("tree-version", 2, "version of the interior node hashes")
+	algorithm := fs.String("signature", pkg.SignatureEd25519, "signature algorithm of tree heads")
+	l := labels{}
+	fs.Var(l, "label", "key=value label of the state, can be repeated")
+	if err := parse(fs, args); err != nil {
+		return 0, err
+	}
+
+	state := filepath.Join(*dir, stateFile)
+	if _, err := os.Stat(state); err == nil {
+		return 0, fmt.Errorf("%s already exists", state)
+	}
+	opts := []pkg.Option{
+		pkg.WithName(*name),
+		pkg.WithHashSuite(*hashSuite),
+		pkg.WithVRFSuite(*vrfSuite),
+		pkg.WithTreeVersion(*treeVersion),
+	}
+	if *publicIndex {
+		opts = append(opts, pkg.WithPublicIndex())
+	}
+	for k, v := range l {
+		opts = append(opts, pkg.WithLabel(k, v))
+	}
+	r, err := pkg.NewEmptyRecorder(nil, opts...)
+	if err != nil {
+		return 0, err
+	}
+	key, err := pkg.GenerateSigningKey(nil, *algorithm)
+	if err != nil {
+		return 0, err
+	}
+	vkey, err := key.VerificationKey()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return 0, err
+	}
+	if err := writeFile(filepath.Join(*dir, privateKeyFile), r.Private(), 0o600); err != nil {
+		return 0, err
+	}
+	if err := writeJSON(filepath.Join(*dir, signingKeyFile), key, 0o600); err != nil {
+		return 0, err
+	}
+	if err := writeJSON(filepath.Join(*dir, verificationKeyFile), vkey, 0o644); err != nil {
+		return 0, err
+	}
+	if err := writeState(*dir, r); err != nil {
+		return 0, err
+	}
+	fmt.Fprintf(stdout, "initialized %s\n", *dir)
+	return 0, nil
+}
+
+func loadRecorder(dir string) (*pkg.Recorder, error) {
+	private, err := os.ReadFile(filepath.Join(dir, privateKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(dir, stateFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return pkg.NewRecorderFromReader(f, private)
+}
+
+func loadProver(dir string) (*pkg.Prover, error) {
+	private, err := os.ReadFile(filepath.Join(dir, privateKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(dir, stateFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return pkg.NewProverFromReader(f, private)
+}
+
+func writeState(dir string, r *pkg.Recorder) error {
+	var b bytes.Buffer
+	if err := r.WriteInternal(&b); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, stateFile), b.Bytes(), 0o600)
+}
+
+func insertCmd(args []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	fs := newFlagSet("insert", stderr)
+	dir := fs.String("dir", ".", "state directory")
+	k := newKeyFlags(fs)
+	valueFile := fs.String("value-file", "", "file containing the value, read from stdin if not set")
+	if err := parse(fs, args); err != nil {
+		return 0, err
+	}
+	key, err := k.read(fs)
+	if err != nil {
+		return 0, err
+	}
+	var value []byte
+	if *valueFile != "" {
+		value, err = os.ReadFile(*valueFile)
+	} else {
+		value, err = io.ReadAll(stdin)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	r, err := loadRecorder(*dir)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.Insert(key, value); err != nil {
+		return 0, err
+	}
+	if err := writeState(*dir, r); err != nil {
+		return 0, err
+	}
+	h, err := r.Header()
+	if err != nil {
+		return 0, err
+	}
+	fmt.Fprintf(stdout, "%d records\n", h.Records)
+	return 0, nil
+}
+
+func commitCmd(args []string, _ io.Reader, stdout, stderr io.Writer) (int, error) {
+	fs := newFlagSet("commit", stderr)
+	dir := fs.String("dir", ".", "state directory")
+	out := fs.String("out", "", "file to write the signed tree head to, stdout if not set")
+	tsa := fs.String("tsa", "", "URL of an RFC 3161 time-stamp authority to time-stamp the tree head")
+	if err := parse(fs, args); err != nil {
+		return 0, err
+	}
+	var key pkg.SigningKey
+	if err := readJSON(filepath.Join(*dir, signingKeyFile), &key); err != nil {
+		return 0, err
+	}
+	r, err := loadRecorder(*dir)
+	if err != nil {
+		return 0, err
+	}
+	h, err := r.TreeHead()
+	if err != nil {
+		return 0, err
+	}
+	s, err := h.Sign(&key)
+	if err != nil {
+		return 0, err
+	}
+	if *tsa != "" {
+		if err := s.Timestamp(&httpTimestampAuthority{url: *tsa}); err != nil {
+			return 0, err
+		}
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	return 0, writeOutput(*out, append(b, '\n'), stdout)
+}
+
+func publicCmd(args []string, _ io.Reader, stdout, stderr io.Writer) (int, error) {
+	fs := newFlagSet("public", stderr)
+	dir := fs.String("dir", ".", "state directory")
+	out := fs.String("out", "", "file to write the public data to, stdout if not set")
+	if err := parse(fs, args); err != nil {
+		return 0, err
+	}
+	r, err := loadRecorder(*dir)
+	if err != nil {
+		return 0, err
+	}
+	public, err := r.Public()
+	if err != nil {
+		return 0, err
+	}
+	return 0, writeOutput(*out, public, stdout)
+}
+
+func proveCmd(args []string, _ io.Reader, stdout, stderr io.Writer) (int, error) {
+	fs := newFlagSet("prove", stderr)
+	dir := fs.String("dir", ".", "state directory")
+	k := newKeyFlags(fs)
+	membership := fs.Bool("membership", false, "prove only that the key is recorded, without disclosing its value")
+	out := fs.String("out", "", "file to write the proof to, stdout if not set")
+	if err := parse(fs, args); err != nil {
+		return 0, err
+	}
+	key, err := k.read(fs)
+	if err != nil {
+		return 0, err
+	}
+	p, err := loadProver(*dir)
+	if err != nil {
+		return 0, err
+	}
+	var proof *pkg.Proof
+	if *membership {
+		proof, err = p.GetMembership(key)
+	} else {
+		proof, err = p.Get(key)
+	}
+	if err != nil {
+		return 0, err
+	}
+	b, err := proof.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	return 0, writeOutput(*out, b, stdout)
+}
+
+func verifyCmd(args []string, _ io.Reader, stdout, stderr io.Writer) (int, error) {
+	fs := newFlagSet("verify", stderr)
+	publicFile := fs.String("public", "", "public data file")
+	proofFile := fs.String("proof", "", "proof file")
+	k := newKeyFlags(fs)
+	valueFile := fs.String("value-file", "", "file containing the expected value; if not set, only the membership of the key is verified")
+	if err := parse(fs, args); err != nil {
+		return 0, err
+	}
+	if *publicFile == "" || *proofFile == "" {
+		fmt.Fprintln(stderr, "-public and -proof are required")
+		fs.Usage()
+		return 0, errUsage
+	}
+	key, err := k.read(fs)
+	if err != nil {
+		return 0, err
+	}
+	public, err := os.ReadFile(*publicFile)
+	if err != nil {
+		return 0, err
+	}
+	b, err := os.ReadFile(*proofFile)
+	if err != nil {
+		return 0, err
+	}
+	var proof pkg.Proof
+	if err := proof.UnmarshalBinary(b); err != nil {
+		return 0, err
+	}
+	v, err := pkg.NewVerifier(public)
+	if err != nil {
+		return 0, err
+	}
+
+	if *valueFile != "" {
+		var value []byte
+		if value, err = os.ReadFile(*valueFile); err != nil {
+			return 0, err
+		}
+		err = v.VerifyInclusion(proof, key, value)
+	} else {
+		err = v.VerifyMembership(proof, key)
+	}
+	if !errors.Is(err, pkg.ErrProofType) {
+		if err != nil {
+			return 0, err
+		}
+		fmt.Fprintln(stdout, "included")
+		return exitIncluded, nil
+	}
+	if err := v.VerifyExclusion(proof, key, nil); err != nil {
+		return 0, err
+	}
+	fmt.Fprintln(stdout, "excluded")
+	return exitExcluded, nil
+}
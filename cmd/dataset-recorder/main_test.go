@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/laurentsimon/dataset-recorder/pkg"
+)
+
+// runCmd runs the command and returns its exit code and output.
+func runCmd(t *testing.T, stdin string, args ...string) (int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	if code == exitError || code == exitUsage {
+		t.Logf("%v: %s", args, stderr.String())
+	}
+	return code, stdout.String()
+}
+
+func Test_Commands(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	state := filepath.Join(dir, "state")
+	public := filepath.Join(dir, "public")
+	treeHead := filepath.Join(dir, "treehead.json")
+	value := filepath.Join(dir, "value")
+	if err := os.WriteFile(value, []byte("value2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _ := runCmd(t, "", "init", "-dir", state, "-name", "dataset", "-label", "source=test"); code != 0 {
+		t.Fatalf("init: exit %d", code)
+	}
+	if code, _ := runCmd(t, "", "init", "-dir", state); code != exitError {
+		t.Fatalf("init twice: exit %d", code)
+	}
+	if code, _ := runCmd(t, "value1", "insert", "-dir", state, "-key", "key1"); code != 0 {
+		t.Fatalf("insert: exit %d", code)
+	}
+	code, out := runCmd(t, "", "insert", "-dir", state, "-key", "key2", "-value-file", value)
+	if code != 0 || out != "2 records\n" {
+		t.Fatalf("insert: exit %d: %q", code, out)
+	}
+	if code, _ := runCmd(t, "", "public", "-dir", state, "-out", public); code != 0 {
+		t.Fatalf("public: exit %d", code)
+	}
+	if code, _ := runCmd(t, "", "commit", "-dir", state, "-out", treeHead); code != 0 {
+		t.Fatalf("commit: exit %d", code)
+	}
+
+	// The tree head is signed over the exported public data.
+	var s pkg.SignedTreeHead
+	if err := readJSON(treeHead, &s); err != nil {
+		t.Fatal(err)
+	}
+	var vkey pkg.VerificationKey
+	if err := readJSON(filepath.Join(state, verificationKeyFile), &vkey); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := pkg.NewVerifier(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyTreeHead(&s, &vkey); err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "dataset" || s.Records != 2 {
+		t.Fatalf("unexpected tree head: %+v", s.TreeHead)
+	}
+
+	tests := []struct {
+		name  string
+		prove []string
+		// verify is appended the public data and proof.
+		verify []string
+		code   int
+	}{
+		{
+			name:   "included",
+			prove:  []string{"-key", "key2"},
+			verify: []string{"-key", "key2", "-value-file", value},
+			code:   exitIncluded,
+		},
+		{
+			name:   "wrong value",
+			prove:  []string{"-key", "key1"},
+			verify: []string{"-key", "key1", "-value-file", value},
+			code:   exitError,
+		},
+		{
+			name:   "membership",
+			prove:  []string{"-key", "key1", "-membership"},
+			verify: []string{"-key", "key1"},
+			code:   exitIncluded,
+		},
+		{
+			name:   "excluded",
+			prove:  []string{"-key", "key3"},
+			verify: []string{"-key", "key3"},
+			code:   exitExcluded,
+		},
+		{
+			name:   "other key",
+			prove:  []string{"-key", "key1"},
+			verify: []string{"-key", "key2"},
+			code:   exitError,
+		},
+		{
+			name:   "no key",
+			prove:  []string{"-key", "key1"},
+			verify: nil,
+			code:   exitUsage,
+		},
+	}
+	for i, tt := range tests {
+		proof := filepath.Join(dir, "proof"+string(rune('0'+i)))
+		if code, _ := runCmd(t, "", append([]string{"prove", "-dir", state, "-out", proof}, tt.prove...)...); code != 0 {
+			t.Fatalf("%s: prove: exit %d", tt.name, code)
+		}
+		code, _ := runCmd(t, "", append([]string{"verify", "-public", public, "-proof", proof}, tt.verify...)...)
+		if code != tt.code {
+			t.Errorf("%s: verify: exit %d, want %d", tt.name, code, tt.code)
+		}
+	}
+	if code, _ := runCmd(t, "", "prove", "-dir", state, "-key", "key3", "-membership"); code != exitError {
+		t.Fatalf("prove membership of missing key: exit %d", code)
+	}
+}
+
+func Test_Usage(t *testing.T) {
+	t.Parallel()
+	for _, args := range [][]string{
+		nil,
+		{"unknown"},
+		{"insert", "-unknown"},
+		{"insert", "extra"},
+		{"insert", "-key", "k", "-key-file", "f"},
+		{"verify", "-key", "k"},
+	} {
+		if code, _ := runCmd(t, "", args...); code != exitUsage {
+			t.Errorf("%v: exit %d, want %d", args, code, exitUsage)
+		}
+	}
+}
+
+func Test_Labels(t *testing.T) {
+	t.Parallel()
+	dir := filepath.Join(t.TempDir(), "state")
+	if code, _ := runCmd(t, "", "init", "-dir", dir, "-public-index", "-label", "a=1", "-label", "b=x=y"); code != 0 {
+		t.Fatalf("init: exit %d", code)
+	}
+	f, err := os.Open(filepath.Join(dir, stateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	h, err := pkg.ReadHeader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(h.Labels)
+	if string(b) != `{"a":"1","b":"x=y"}` || h.VRFSuite != "" {
+		t.Fatalf("unexpected header: %+v", h)
+	}
+}
+
+func Test_HTTPTimestampAuthority(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/timestamp-query" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		req, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(append([]byte("reply to "), req...))
+	}))
+	defer srv.Close()
+
+	resp, err := (&httpTimestampAuthority{url: srv.URL}).Timestamp([]byte("request"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != "reply to request" {
+		t.Fatalf("unexpected response: %q", resp)
+	}
+	if _, err := (&httpTimestampAuthority{url: srv.URL + "/missing", client: srv.Client()}).Timestamp([]byte("request")); err == nil {
+		t.Fatal("missing authority returns a response")
+	}
+
+	// The tree head is not written if it cannot be time-stamped.
+	dir := t.TempDir()
+	state := filepath.Join(dir, "state")
+	treeHead := filepath.Join(dir, "treehead.json")
+	if code, _ := runCmd(t, "", "init", "-dir", state); code != 0 {
+		t.Fatalf("init: exit %d", code)
+	}
+	if code, _ := runCmd(t, "", "commit", "-dir", state, "-out", treeHead, "-tsa", srv.URL); code != exitError {
+		t.Fatalf("commit: exit %d, want %d", code, exitError)
+	}
+	if _, err := os.Stat(treeHead); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("unexpected tree head: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxTimestampResponse limits the size of responses read
+// from time-stamp authorities.
+const maxTimestampResponse = 1 << 20
+
+// httpTimestampAuthority is a time-stamp authority reached over
+// HTTP, as described in RFC 3161 section 3.4.
+type httpTimestampAuthority struct {
+	url string
+	// client sends the requests. If nil, http.DefaultClient is used.
+	client *http.Client
+}
+
+// Timestamp implements pkg.TimestampAuthority.
+func (a *httpTimestampAuthority) Timestamp(request []byte) ([]byte, error) {
+	client := a.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(a.url, "application/timestamp-query", bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("time-stamp authority: status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxTimestampResponse))
+}
@@ -0,0 +1,12 @@
+module github.com/laurentsimon/dataset-recorder/cmd/ocilayout
+
+go 1.22
+
+require github.com/laurentsimon/dataset-recorder/pkg v0.0.0
+
+require (
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+)
+
+replace github.com/laurentsimon/dataset-recorder/pkg => ../../pkg
@@ -0,0 +1,173 @@
+// Command ocilayout packages the artifacts of a recording
+// in an OCI image layout, and extracts them.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/laurentsimon/dataset-recorder/pkg"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s write -layout dir -tag tag -public file [-state file] [-treehead file]... [-attestation file]...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s read -layout dir [-tag tag] -out dir\n", os.Args[0])
+	os.Exit(2)
+}
+
+// files is a repeated flag.
+type files []string
+
+func (f *files) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *files) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "write":
+		err = write(os.Args[2:])
+	case "read":
+		err = read(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// attestationMediaType returns the media type of an
+// attestation from its content.
+func attestationMediaType(b []byte) (string, error) {
+	var fields struct {
+		Context     string `json:"@context"`
+		Type        string `json:"_type"`
+		MediaType   string `json:"mediaType"`
+		PayloadType string `json:"payloadType"`
+	}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return "", err
+	}
+	switch {
+	case fields.PayloadType != "":
+		return pkg.EnvelopeMediaType, nil
+	case fields.Type == pkg.StatementType:
+		return pkg.StatementMediaType, nil
+	case fields.MediaType == pkg.BundleMediaType:
+		return pkg.BundleMediaType, nil
+	case strings.Contains(fields.Context, "spdx.org"):
+		return pkg.BOMMediaType, nil
+	}
+	return "", fmt.Errorf("unknown attestation")
+}
+
+func write(args []string) error {
+	fs := flag.NewFlagSet("write", flag.ExitOnError)
+	layout := fs.String("layout", "", "path of the OCI layout")
+	tag := fs.String("tag", "latest", "tag of the recording")
+	state := fs.String("state", "", "state file of the recorder")
+	public := fs.String("public", "", "public data file")
+	var heads, attestations files
+	fs.Var(&heads, "treehead", "signed tree head file")
+	fs.Var(&attestations, "attestation", "DSSE envelope, in-toto statement, Sigstore bundle or SPDX file")
+	fs.Parse(args)
+	if *layout == "" || *public == "" {
+		usage()
+	}
+
+	var (
+		a   pkg.Artifacts
+		err error
+	)
+	if a.Public, err = os.ReadFile(*public); err != nil {
+		return err
+	}
+	if *state != "" {
+		if a.State, err = os.ReadFile(*state); err != nil {
+			return err
+		}
+	}
+	for _, fn := range heads {
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		var s pkg.SignedTreeHead
+		if err := json.Unmarshal(b, &s); err != nil {
+			return fmt.Errorf("%s: %w", fn, err)
+		}
+		a.TreeHeads = append(a.TreeHeads, s)
+	}
+	for _, fn := range attestations {
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		mediaType, err := attestationMediaType(b)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fn, err)
+		}
+		a.Attestations = append(a.Attestations, pkg.Attestation{MediaType: mediaType, Data: b})
+	}
+	return pkg.WriteLayout(*layout, *tag, &a)
+}
+
+func read(args []string) error {
+	fs := flag.NewFlagSet("read", flag.ExitOnError)
+	layout := fs.String("layout", "", "path of the OCI layout")
+	tag := fs.String("tag", "", "tag of the recording, if the layout has several")
+	out := fs.String("out", "", "directory to extract the artifacts to")
+	fs.Parse(args)
+	if *layout == "" || *out == "" {
+		usage()
+	}
+
+	a, err := pkg.ReadLayout(*layout, *tag)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*out, 0o755); err != nil {
+		return err
+	}
+	extract := func(name string, b []byte) error {
+		fmt.Println(name)
+		return os.WriteFile(filepath.Join(*out, name), b, 0o644)
+	}
+	if len(a.State) != 0 {
+		if err := extract("state", a.State); err != nil {
+			return err
+		}
+	}
+	if err := extract("public.json", a.Public); err != nil {
+		return err
+	}
+	for i := range a.TreeHeads {
+		b, err := json.Marshal(&a.TreeHeads[i])
+		if err != nil {
+			return err
+		}
+		if err := extract(fmt.Sprintf("treehead-%d.json", i), b); err != nil {
+			return err
+		}
+	}
+	for i, at := range a.Attestations {
+		if err := extract(fmt.Sprintf("attestation-%d.json", i), at.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/laurentsimon/dataset-recorder/pkg"
+)
+
+// Strategies to derive the key of a row.
+const (
+	// keyPosition keys a row by its position, as "rowgroup/row".
+	keyPosition = "position"
+	// keyHash keys a row by the SHA-256 hash of its encoding.
+	keyHash = "hash"
+	// keyColumns keys a row by the encoding of its key columns,
+	// as encoded by encodeRow.
+	keyColumns = "columns"
+)
+
+// Header labels recording how keys were derived, so that
+// provers can rebuild the key of a row.
+const (
+	keyLabel        = "key"
+	keyColumnsLabel = "key-columns"
+)
+
+// keyer derives the keys of rows.
+type keyer struct {
+	strategy string
+	// names are the paths of the key columns,
+	// and columns their index in the schema.
+	names   []string
+	columns []int
+	// seen has the hashes of the keys derived so far.
+	seen map[[sha256.Size]byte]struct{}
+}
+
+// newKeyer creates a keyer of the strategy for rows with the
+// fields. names are the key columns of the keyColumns strategy.
+func newKeyer(strategy string, names []string, fields []string) (*keyer, error) {
+	k := &keyer{
+		strategy: strategy,
+		seen:     make(map[[sha256.Size]byte]struct{}),
+	}
+	switch strategy {
+	case keyPosition, keyHash:
+		if len(names) != 0 {
+			return nil, fmt.Errorf("key columns with the %s key", strategy)
+		}
+		return k, nil
+	case keyColumns:
+	default:
+		return nil, fmt.Errorf("unknown key %q", strategy)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no key columns")
+	}
+	index := make(map[string]int)
+	for c, f := range fields {
+		if _, ok := index[f]; ok {
+			return nil, fmt.Errorf("column %s is duplicated", f)
+		}
+		index[f] = c
+	}
+	used := make(map[string]bool)
+	for _, name := range names {
+		c, ok := index[name]
+		if !ok {
+			return nil, fmt.Errorf("key column %s is missing", name)
+		}
+		if used[name] {
+			return nil, fmt.Errorf("key column %s is duplicated", name)
+		}
+		used[name] = true
+		k.names = append(k.names, name)
+		k.columns = append(k.columns, c)
+	}
+	return k, nil
+}
+
+// options returns the options recording the strategy in the header.
+func (k *keyer) options() ([]pkg.Option, error) {
+	opts := []pkg.Option{pkg.WithLabel(keyLabel, k.strategy)}
+	if k.strategy != keyColumns {
+		return opts, nil
+	}
+	names, err := json.Marshal(k.names)
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, pkg.WithLabel(keyColumnsLabel, string(names))), nil
+}
+
+// key returns the key of the row at position row of the row
+// group, with values encoded as value. Keys must be unique,
+// since inserting a key again replaces the record.
+func (k *keyer) key(group int, row int64, values []interface{}, value []byte) ([]byte, error) {
+	var key []byte
+	switch k.strategy {
+	case keyPosition:
+		key = []byte(fmt.Sprintf("%d/%d", group, row))
+	case keyHash:
+		h := sha256.Sum256(value)
+		key = h[:]
+	case keyColumns:
+		selected := make([]interface{}, len(k.columns))
+		for i, c := range k.columns {
+			selected[i] = values[c]
+		}
+		var err error
+		if key, err = encodeRow(k.names, selected); err != nil {
+			return nil, err
+		}
+	}
+	h := sha256.Sum256(key)
+	if _, ok := k.seen[h]; ok {
+		return nil, fmt.Errorf("duplicate %s key", k.strategy)
+	}
+	k.seen[h] = struct{}{}
+	return key, nil
+}
@@ -18,209 +18,183 @@ package main
 
 import (
 	"bytes"
-	"encoding/binary"
+	"encoding/hex"
+	"flag"
 	"fmt"
-	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
-	//"github.com/apache/arrow/go/v17/parquet"
-
-	"github.com/apache/arrow/go/v17/parquet"
 	"github.com/apache/arrow/go/v17/parquet/file"
-	"github.com/apache/arrow/go/v17/parquet/schema"
 	"github.com/laurentsimon/dataset-recorder/cmd/parquet/buffer"
+	"github.com/laurentsimon/dataset-recorder/pkg"
 )
 
 func usage() {
-	fmt.Fprintf(os.Stderr, "usage: %s [inputfile]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "usage: %s -state file -private file -public file [-name name] [-key position|hash|columns] [-key-column name]... inputfile\n", os.Args[0])
+	flag.PrintDefaults()
 	os.Exit(2)
 }
 
+// columns is a repeated flag.
+type columns []string
+
+func (c *columns) String() string {
+	return strings.Join(*c, ",")
+}
+
+func (c *columns) Set(v string) error {
+	*c = append(*c, v)
+	return nil
+}
+
 func main() {
-	if len(os.Args) == 1 {
+	state := flag.String("state", "", "file to write the state of the recorder to")
+	private := flag.String("private", "", "file to write the private key of the recorder to")
+	public := flag.String("public", "", "file to write the public data to")
+	name := flag.String("name", "", "name of the dataset, the name of the input file if not set")
+	strategy := flag.String("key", keyPosition, "key of the rows: their position, the hash of the row, or the key columns")
+	var keyColumns columns
+	flag.Var(&keyColumns, "key-column", "path of a key column, in order, for the columns key")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 || *state == "" || *private == "" || *public == "" {
 		usage()
 	}
-	fn := os.Args[1]
-	f, err := os.Open(fn)
+	fn := flag.Arg(0)
+	if *name == "" {
+		*name = filepath.Base(fn)
+	}
+
+	r, rows, err := record(fn, *strategy, keyColumns, pkg.WithName(*name), pkg.WithLabel("source", filepath.Base(fn)))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "open file: %v", err)
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fn, err)
+		os.Exit(1)
+	}
+	if err := write(r, *state, *private, *public); err != nil {
+		fmt.Fprintf(os.Stderr, "write: %v\n", err)
 		os.Exit(1)
 	}
+	fmt.Println("Rows:", rows)
+	fmt.Println("Root:", hex.EncodeToString(r.Root()))
+}
+
+// record inserts the rows of the parquet file in a new recorder,
+// keyed with the strategy. names are the key columns of the
+// columns strategy.
+func record(fn, strategy string, names []string, opts ...pkg.Option) (*pkg.Recorder, int64, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
 	buf, err := buffer.New(f)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "create buffer: %v", err)
-		os.Exit(1)
+		return nil, 0, err
 	}
 	// NOTE: Can use WithReadProps for cache size and streaming.
-	// Also look at WithMetadata. If data is too large, may want to read from file
+	// If data is too large, may want to read from file
 	// from OpenParquetFile instead.
 	prd, err := file.NewParquetReader(buf)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "new parquest reader: %v", err)
-		os.Exit(1)
+		return nil, 0, err
 	}
-	prdMetadata := prd.MetaData()
-	fmt.Println("Version:", prdMetadata.Version())
-	fmt.Println("Created By:", prdMetadata.GetCreatedBy())
-	fmt.Println("Num Rows:", prd.NumRows())
-
-	keyvaluemeta := prdMetadata.KeyValueMetadata()
-	if keyvaluemeta != nil {
-		fmt.Println("Key Value Metadata:", keyvaluemeta.Len(), "entries")
-		keys := keyvaluemeta.Keys()
-		values := keyvaluemeta.Values()
-		for i := 0; i < keyvaluemeta.Len(); i++ {
-			fmt.Printf(">> Key nr %d:\n%q: %q\n", i, keys[i], values[i])
-		}
+	defer prd.Close()
+	fields, err := columnPaths(prd)
+	if err != nil {
+		return nil, 0, err
+	}
+	k, err := newKeyer(strategy, names, fields)
+	if err != nil {
+		return nil, 0, err
+	}
+	keyOpts, err := k.options()
+	if err != nil {
+		return nil, 0, err
+	}
+	r, err := pkg.NewEmptyRecorder(nil, append(opts, keyOpts...)...)
+	if err != nil {
+		return nil, 0, err
 	}
+	rows, err := recordRows(prd, r, fields, k)
+	if err != nil {
+		return nil, 0, err
+	}
+	return r, rows, nil
+}
 
-	fmt.Println("Number of RowGroups:", prd.NumRowGroups())
-	fmt.Println("Number of Real Columns:", prdMetadata.Schema.Root().NumFields())
-	fmt.Println("Number of Columns:", prdMetadata.Schema.NumColumns())
-	selectedColumns := []int{}
-	for i := 0; i < prdMetadata.Schema.NumColumns(); i++ {
-		selectedColumns = append(selectedColumns, i)
-	}
-	for _, c := range selectedColumns {
-		descr := prdMetadata.Schema.Column(c)
-		fmt.Printf("Column %d: %s (%s", c, descr.Path(), descr.PhysicalType())
-		if descr.ConvertedType() != schema.ConvertedTypes.None {
-			fmt.Printf("/%s", descr.ConvertedType())
-			if descr.ConvertedType() == schema.ConvertedTypes.Decimal {
-				dec := descr.LogicalType().(*schema.DecimalLogicalType)
-				fmt.Printf("(%d,%d)", dec.Precision(), dec.Scale())
-			}
+// columnPaths returns the paths of the columns of the file.
+func columnPaths(prd *file.Reader) ([]string, error) {
+	sc := prd.MetaData().Schema
+	fields := make([]string, sc.NumColumns())
+	for c := range fields {
+		descr := sc.Column(c)
+		// Dumpers read values, not records: the values of
+		// repeated columns would not line up with rows.
+		if descr.MaxRepetitionLevel() > 0 {
+			return nil, fmt.Errorf("column %s: repeated columns are not supported", descr.Path())
 		}
-		fmt.Print(")\n")
+		fields[c] = descr.Path()
 	}
+	return fields, nil
+}
 
-	for r := 0; r < prd.NumRowGroups(); r++ {
-		fmt.Println("--- Row Group:", r, " ---")
-
-		rgr := prd.RowGroup(r)
-		rowGroupMeta := rgr.MetaData()
-		fmt.Println("--- Total Bytes:", rowGroupMeta.TotalByteSize(), " ---")
-		fmt.Println("--- Rows:", rgr.NumRows(), " ---")
-		/*
-			for _, c := range selectedColumns {
-				chunkMeta, err := rowGroupMeta.ColumnChunk(c)
-				if err != nil {
-					log.Fatal(err)
-				}
-
-				fmt.Println("Column", c)
-				if set, _ := chunkMeta.StatsSet(); set {
-					stats, err := chunkMeta.Statistics()
-					if err != nil {
-						log.Fatal(err)
-					}
-					fmt.Printf(" Values: %d", chunkMeta.NumValues())
-					if stats.HasMinMax() {
-						fmt.Printf(", Min: %v, Max: %v",
-							metadata.GetStatValue(stats.Type(), stats.EncodeMin()),
-							metadata.GetStatValue(stats.Type(), stats.EncodeMax()))
-					}
-					if stats.HasNullCount() {
-						fmt.Printf(", Null Values: %d", stats.NullCount())
-					}
-					if stats.HasDistinctCount() {
-						fmt.Printf(", Distinct Values: %d", stats.DistinctCount())
-					}
-					fmt.Println()
-				} else {
-					fmt.Println(" Values:", chunkMeta.NumValues(), "Statistics Not Set")
-				}
-
-				fmt.Print(" Compression: ", chunkMeta.Compression())
-				fmt.Print(", Encodings:")
-				for _, enc := range chunkMeta.Encodings() {
-					fmt.Print(" ", enc)
-				}
-				fmt.Println()
-				fmt.Print(" Uncompressed Size: ", chunkMeta.TotalUncompressedSize())
-				fmt.Println(", Compressed Size:", chunkMeta.TotalCompressedSize())
-			}
-		*/
-		fmt.Println("--- Values ---")
-		fmt.Fprint(os.Stderr, "[")
-
-		scanners := make([]*Dumper, len(selectedColumns))
-		fields := make([]string, len(selectedColumns))
-		for idx, c := range selectedColumns {
+// recordRows inserts every row of every row group in r, with
+// the fields as columns and keyed by k, and returns the number
+// of rows.
+func recordRows(prd *file.Reader, r *pkg.Recorder, fields []string, k *keyer) (int64, error) {
+	var rows int64
+	for g := 0; g < prd.NumRowGroups(); g++ {
+		rgr := prd.RowGroup(g)
+		scanners := make([]*Dumper, len(fields))
+		for c := range fields {
 			col, err := rgr.Column(c)
 			if err != nil {
-				log.Fatalf("unable to fetch column=%d err=%s", c, err)
+				return 0, fmt.Errorf("row group %d: column %s: %w", g, fields[c], err)
 			}
-			scanners[idx] = createDumper(col)
-			fields[idx] = col.Descriptor().Path()
+			scanners[c] = createDumper(col)
 		}
-
-		var line string
-		for {
-			if line == "" {
-				line = "\n  {"
-			} else {
-				line = ",\n  {"
-			}
-
-			data := false
-			first := true
-			for idx, s := range scanners {
-				if val, ok := s.Next(); ok {
-					if !data {
-						fmt.Fprint(os.Stderr, line)
-					}
-					data = true
-					if val == nil {
-						continue
-					}
-					if !first {
-						fmt.Fprint(os.Stderr, ",")
-					}
-					first = false
-					// switch val.(type) {
-					// case bool, int32, int64, float32, float64:
-					// default:
-					// 	val = s.FormatValue(val, 0)
-					// }
-					// fmt.Fprintf(os.Stderr, "hey: %q %T", fields[idx], val)
-					// jsonVal, err := json.Marshal(val)
-					// if err != nil {
-					// 	fmt.Fprintf(os.Stderr, "error: marshalling json for %+v, %s\n", val, err)
-					// 	os.Exit(1)
-					// }
-					// fmt.Fprintf(os.Stderr, "\n    %q: %s", fields[idx], jsonVal)
-					var buf bytes.Buffer
-					switch v := val.(type) {
-					default:
-						panic(fmt.Sprintf("unknown type %T", v))
-					case bool, int32, int64, float32, float64:
-						err := binary.Write(&buf, binary.BigEndian, v)
-						if err != nil {
-							panic(err)
-						}
-					case parquet.ByteArray:
-						buf.Write(v.Bytes())
-					}
-					fmt.Fprintf(os.Stderr, "\n    %q(%T): %d %v", fields[idx], val, buf.Len(), buf.Bytes())
-					f, err := os.Create("test")
-					if err != nil {
-						panic(err)
-					}
-					defer f.Close()
-					_, err = f.Write(buf.Bytes())
-					if err != nil {
-						panic(err)
-					}
-					panic("end")
+		for i := int64(0); i < rgr.NumRows(); i++ {
+			values := make([]interface{}, len(scanners))
+			for c, s := range scanners {
+				val, ok := s.Next()
+				if !ok {
+					return 0, fmt.Errorf("row group %d: column %s ends at row %d", g, fields[c], i)
 				}
+				values[c] = val
+			}
+			value, err := encodeRow(fields, values)
+			if err != nil {
+				return 0, fmt.Errorf("row group %d: row %d: %w", g, i, err)
+			}
+			key, err := k.key(g, i, values, value)
+			if err != nil {
+				return 0, fmt.Errorf("row group %d: row %d: %w", g, i, err)
 			}
-			if !data {
-				break
+			if err := r.Insert(key, value); err != nil {
+				return 0, fmt.Errorf("row group %d: row %d: %w", g, i, err)
 			}
-			fmt.Fprint(os.Stderr, "\n  }")
+			rows++
 		}
+	}
+	return rows, nil
+}
 
-		fmt.Fprintln(os.Stderr, "\n]")
+// write writes the state, the private key and the public data of r.
+func write(r *pkg.Recorder, state, private, public string) error {
+	var b bytes.Buffer
+	if err := r.WriteInternal(&b); err != nil {
+		return err
+	}
+	if err := os.WriteFile(state, b.Bytes(), 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(private, r.Private(), 0o600); err != nil {
+		return err
+	}
+	p, err := r.Public()
+	if err != nil {
+		return err
 	}
+	return os.WriteFile(public, p, 0o644)
 }
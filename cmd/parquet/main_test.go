@@ -2,34 +2,332 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/apache/arrow/go/v17/parquet"
+	"github.com/apache/arrow/go/v17/parquet/file"
+	"github.com/apache/arrow/go/v17/parquet/schema"
 	"github.com/laurentsimon/dataset-recorder/pkg"
 )
 
-func Test_todo(t *testing.T) {
+// writeTestParquet writes a parquet file with a row group of each
+// size. Rows have a required id, an optional name that is null
+// every third row, and a required score.
+func writeTestParquet(t *testing.T, fn string, groups ...int) {
+	t.Helper()
+	sc, err := schema.NewGroupNode("schema", parquet.Repetitions.Required, schema.FieldList{
+		schema.NewInt64Node("id", parquet.Repetitions.Required, -1),
+		schema.NewByteArrayNode("name", parquet.Repetitions.Optional, -1),
+		schema.NewFloat64Node("score", parquet.Repetitions.Required, -1),
+	}, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := file.NewParquetWriter(f, sc)
+	var id int64
+	for _, n := range groups {
+		var (
+			ids    []int64
+			names  []parquet.ByteArray
+			defs   []int16
+			scores []float64
+		)
+		for i := 0; i < n; i++ {
+			ids = append(ids, id)
+			if id%3 == 1 {
+				defs = append(defs, 0)
+			} else {
+				defs = append(defs, 1)
+				names = append(names, parquet.ByteArray(fmt.Sprint("name", id)))
+			}
+			scores = append(scores, float64(id)/2)
+			id++
+		}
+		rgw := w.AppendRowGroup()
+		for _, write := range []func(file.ColumnChunkWriter) error{
+			func(cw file.ColumnChunkWriter) error {
+				_, err := cw.(*file.Int64ColumnChunkWriter).WriteBatch(ids, nil, nil)
+				return err
+			},
+			func(cw file.ColumnChunkWriter) error {
+				_, err := cw.(*file.ByteArrayColumnChunkWriter).WriteBatch(names, defs, nil)
+				return err
+			},
+			func(cw file.ColumnChunkWriter) error {
+				_, err := cw.(*file.Float64ColumnChunkWriter).WriteBatch(scores, nil, nil)
+				return err
+			},
+		} {
+			cw, err := rgw.NextColumn()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := write(cw); err != nil {
+				t.Fatal(err)
+			}
+			if err := cw.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rgw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_record(t *testing.T) {
 	t.Parallel()
-	r, err := pkg.NewEmptyRecorder(nil)
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "data.parquet")
+	// The first row group spans several batches of the dumpers.
+	writeTestParquet(t, fn, 2*defaultBatchSize+3, 5)
+
+	r, rows, err := record(fn, keyPosition, nil, pkg.WithName("data"), pkg.WithLabel("source", "data.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(2*defaultBatchSize + 8); rows != want {
+		t.Fatalf("got %d rows, want %d", rows, want)
+	}
+	state, private, public := filepath.Join(dir, "state"), filepath.Join(dir, "private"), filepath.Join(dir, "public")
+	if err := write(r, state, private, public); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := pkg.ReadHeader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels, _ := json.Marshal(h.Labels)
+	if h.Name != "data" || h.Records != uint64(rows) || string(labels) != `{"key":"position","source":"data.parquet"}` {
+		t.Fatalf("unexpected header: %+v", h)
+	}
+
+	// The first row of the second row group has a null name.
+	id := int64(2*defaultBatchSize + 3)
+	value, err := encodeRow([]string{"id", "name", "score"}, []interface{}{id, nil, float64(id) / 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := []byte("1/0")
+	priv, err := os.ReadFile(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := pkg.NewProverFromReader(bytes.NewReader(b), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := p.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := os.ReadFile(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := pkg.NewVerifier(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyInclusion(*proof, key, value); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_recordHashKeys(t *testing.T) {
+	t.Parallel()
+	fields := []string{"id", "name", "score"}
+	k, err := newKeyer(keyHash, nil, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := k.options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := pkg.NewEmptyRecorder(nil, opts...)
 	if err != nil {
 		t.Fatalf("cannot create recorder: %v", err)
 	}
-	keyPrefix := "key"
-	valuePrefix := []byte("value")
-	entries := uint64(10)
-	var i uint64
-	for i = 0; i < entries; i++ {
-		// TODO: download the files, reset.
-		// TODO: select key to use, which should be the hash
-		key := keyPrefix + fmt.Sprint(i)
-		value := append(valuePrefix, byte(i))
-		if err := r.Insert([]byte(key), value); err != nil {
+	entries := int64(10)
+	for i := int64(0); i < entries; i++ {
+		values := []interface{}{i, parquet.ByteArray(fmt.Sprint("name", i)), float64(i) / 2}
+		value, err := encodeRow(fields, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := k.key(0, i, values, value)
+		if err != nil {
 			t.Fatal(err)
 		}
+		if err := r.Insert(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The same row again.
+	values := []interface{}{int64(0), parquet.ByteArray("name0"), float64(0)}
+	value, err := encodeRow(fields, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.key(1, 0, values, value); err == nil {
+		t.Fatal("duplicate row")
+	}
+
+	// Provers rebuild the keys from the strategy in the header.
+	var b bytes.Buffer
+	if err := r.WriteInternal(&b); err != nil {
+		t.Fatal(err)
+	}
+	h, err := pkg.ReadHeader(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
 	}
-	// Now save. Disk or mem?
-	var b1 bytes.Buffer
-	if err := r.WriteInternal(&b1); err != nil {
+	if h.Labels[keyLabel] != keyHash || h.Records != uint64(entries) {
+		t.Fatalf("unexpected header: %+v", h)
+	}
+	p, err := pkg.NewProverFromReader(&b, r.Private())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := sha256.Sum256(value)
+	proof, err := p.Get(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := r.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := pkg.NewVerifier(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyInclusion(*proof, key[:], value); err != nil {
 		t.Fatal(err)
 	}
 }
+
+func Test_keyer(t *testing.T) {
+	t.Parallel()
+	fields := []string{"id", "name", "score"}
+	rows := [][]interface{}{
+		{int64(1), parquet.ByteArray("a"), float64(1)},
+		{int64(1), parquet.ByteArray("b"), float64(1)},
+		{int64(2), parquet.ByteArray("a"), float64(1)},
+	}
+	tests := []struct {
+		name     string
+		strategy string
+		names    []string
+		labels   map[string]string
+		// dup is the index of the first row with
+		// a duplicate key, or -1.
+		dup int
+	}{
+		{
+			name:     "position",
+			strategy: keyPosition,
+			labels:   map[string]string{keyLabel: keyPosition},
+			dup:      -1,
+		},
+		{
+			name:     "hash",
+			strategy: keyHash,
+			labels:   map[string]string{keyLabel: keyHash},
+			dup:      -1,
+		},
+		{
+			name:     "columns",
+			strategy: keyColumns,
+			names:    []string{"name", "id"},
+			labels:   map[string]string{keyLabel: keyColumns, keyColumnsLabel: `["name","id"]`},
+			dup:      -1,
+		},
+		{
+			name:     "duplicate key",
+			strategy: keyColumns,
+			names:    []string{"id"},
+			labels:   map[string]string{keyLabel: keyColumns, keyColumnsLabel: `["id"]`},
+			dup:      1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			k, err := newKeyer(tt.strategy, tt.names, fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts, err := k.options()
+			if err != nil {
+				t.Fatal(err)
+			}
+			r, err := pkg.NewEmptyRecorder(nil, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h, err := r.Header()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := json.Marshal(h.Labels)
+			want, _ := json.Marshal(tt.labels)
+			if !bytes.Equal(got, want) {
+				t.Fatalf("labels %s, want %s", got, want)
+			}
+			for i, values := range rows {
+				value, err := encodeRow(fields, values)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = k.key(0, int64(i), values, value)
+				if (err != nil) != (i == tt.dup) {
+					t.Fatalf("row %d: unexpected err: %v", i, err)
+				}
+				if err != nil {
+					break
+				}
+			}
+		})
+	}
+}
+
+func Test_newKeyerInvalid(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		strategy string
+		names    []string
+		fields   []string
+	}{
+		{"row", nil, []string{"a"}},
+		{keyPosition, []string{"a"}, []string{"a"}},
+		{keyHash, []string{"a"}, []string{"a"}},
+		{keyColumns, nil, []string{"a"}},
+		{keyColumns, []string{"b"}, []string{"a"}},
+		{keyColumns, []string{"a", "a"}, []string{"a"}},
+		{keyColumns, []string{"a"}, []string{"a", "a"}},
+	} {
+		if _, err := newKeyer(tt.strategy, tt.names, tt.fields); err == nil {
+			t.Errorf("%s %v of %v: no error", tt.strategy, tt.names, tt.fields)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/apache/arrow/go/v17/parquet"
+)
+
+// Tags of the values in the canonical encoding of rows.
+const (
+	tagNull byte = iota
+	tagBool
+	tagInt32
+	tagInt64
+	tagInt96
+	tagFloat32
+	tagFloat64
+	tagByteArray
+	tagFixedLenByteArray
+)
+
+// encodeValue returns the tag and the bytes of a value read by a Dumper.
+func encodeValue(val interface{}) (byte, []byte, error) {
+	var buf bytes.Buffer
+	switch v := val.(type) {
+	case nil:
+		return tagNull, nil, nil
+	case bool:
+		if v {
+			return tagBool, []byte{1}, nil
+		}
+		return tagBool, []byte{0}, nil
+	case int32:
+		binary.Write(&buf, binary.BigEndian, v)
+		return tagInt32, buf.Bytes(), nil
+	case int64:
+		binary.Write(&buf, binary.BigEndian, v)
+		return tagInt64, buf.Bytes(), nil
+	case float32:
+		binary.Write(&buf, binary.BigEndian, v)
+		return tagFloat32, buf.Bytes(), nil
+	case float64:
+		binary.Write(&buf, binary.BigEndian, v)
+		return tagFloat64, buf.Bytes(), nil
+	case parquet.Int96:
+		return tagInt96, v[:], nil
+	case parquet.ByteArray:
+		return tagByteArray, v.Bytes(), nil
+	case parquet.FixedLenByteArray:
+		return tagFixedLenByteArray, v.Bytes(), nil
+	}
+	return 0, nil, fmt.Errorf("unsupported value type %T", val)
+}
+
+// appendBytes appends b to dst, prefixed with its length.
+func appendBytes(dst, b []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(b)))
+	return append(dst, b...)
+}
+
+// encodeRow returns the canonical encoding of a row, which is the
+// value of its record. Each column is encoded in schema order as
+// its path, the tag of its value and the value, with the path and
+// the value prefixed by their length as a big-endian uint32.
+func encodeRow(fields []string, values []interface{}) ([]byte, error) {
+	if len(fields) != len(values) {
+		return nil, fmt.Errorf("%d values for %d columns", len(values), len(fields))
+	}
+	var b []byte
+	for i, val := range values {
+		tag, v, err := encodeValue(val)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", fields[i], err)
+		}
+		b = appendBytes(b, []byte(fields[i]))
+		b = append(b, tag)
+		b = appendBytes(b, v)
+	}
+	return b, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/apache/arrow/go/v17/parquet"
+)
+
+func Test_encodeRow(t *testing.T) {
+	t.Parallel()
+	rows := []struct {
+		fields []string
+		values []interface{}
+	}{
+		{[]string{"a"}, []interface{}{nil}},
+		{[]string{"a"}, []interface{}{parquet.ByteArray{}}},
+		{[]string{"a"}, []interface{}{parquet.FixedLenByteArray{}}},
+		{[]string{"a"}, []interface{}{int32(1)}},
+		{[]string{"a"}, []interface{}{int64(1)}},
+		{[]string{"a"}, []interface{}{float32(1)}},
+		{[]string{"a"}, []interface{}{float64(1)}},
+		{[]string{"a"}, []interface{}{true}},
+		{[]string{"a"}, []interface{}{false}},
+		{[]string{"a"}, []interface{}{parquet.Int96{}}},
+		{[]string{"b"}, []interface{}{nil}},
+		{[]string{"a", "b"}, []interface{}{parquet.ByteArray("x"), parquet.ByteArray("yz")}},
+		{[]string{"a", "b"}, []interface{}{parquet.ByteArray("xy"), parquet.ByteArray("z")}},
+		{[]string{"a", "b"}, []interface{}{nil, parquet.ByteArray("z")}},
+		{[]string{"ab"}, []interface{}{nil}},
+	}
+	seen := make(map[string]int)
+	for i, r := range rows {
+		b, err := encodeRow(r.fields, r.values)
+		if err != nil {
+			t.Fatalf("row %d: %v", i, err)
+		}
+		if j, ok := seen[string(b)]; ok {
+			t.Fatalf("rows %d and %d have the same encoding", j, i)
+		}
+		seen[string(b)] = i
+		again, err := encodeRow(r.fields, r.values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, again) {
+			t.Fatalf("row %d: encoding is not deterministic", i)
+		}
+	}
+
+	if _, err := encodeRow([]string{"a"}, []interface{}{1}); err == nil {
+		t.Fatal("encoded an unsupported type")
+	}
+	if _, err := encodeRow([]string{"a", "b"}, []interface{}{nil}); err == nil {
+		t.Fatal("encoded a row with a missing value")
+	}
+}
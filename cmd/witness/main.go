@@ -0,0 +1,140 @@
+// Command witness cosigns the checkpoints of transparency logs,
+// after checking that each is consistent with the last one it
+// cosigned, and serves https://c2sp.org/tlog-witness. The last
+// checkpoints it cosigned are kept in the -state file, so that a
+// restarted witness does not cosign a fork of what it cosigned before.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/laurentsimon/dataset-recorder/pkg"
+)
+
+// files is a repeated flag.
+type files []string
+
+func (f *files) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *files) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+func readJSON(fn string, v any) error {
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	return nil
+}
+
+// writeFile writes the file durably: once it returns, a crash
+// leaves either the previous or the new content behind.
+func writeFile(name string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// loadState loads the state of the witness from the file,
+// if it exists.
+func loadState(w *pkg.Witness, name string) error {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := w.LoadState(f); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func main() {
+	name := flag.String("name", "", "name of the witness")
+	keyFile := flag.String("key", "", "Ed25519 signing key file of the witness")
+	addr := flag.String("addr", "localhost:8080", "address to listen on")
+	state := flag.String("state", "", "file storing the last checkpoints cosigned, created if missing")
+	var logs files
+	flag.Var(&logs, "log", "key file of a log to witness")
+	flag.Parse()
+	if *name == "" || *keyFile == "" || *state == "" || len(logs) == 0 {
+		fmt.Fprintf(os.Stderr, "usage: %s -name name -key file -state file -log file... [-addr addr]\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	var key pkg.SigningKey
+	if err := readJSON(*keyFile, &key); err != nil {
+		log.Fatal(err)
+	}
+	var keys []*pkg.LogKey
+	for _, fn := range logs {
+		var k pkg.LogKey
+		if err := readJSON(fn, &k); err != nil {
+			log.Fatal(err)
+		}
+		keys = append(keys, &k)
+	}
+	w, err := pkg.NewWitness(*name, &key, keys...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := loadState(w, *state); err != nil {
+		log.Fatal(err)
+	}
+	w.Store = func(b []byte) error {
+		return writeFile(*state, b)
+	}
+	vkey, err := key.VerificationKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+	wkey := pkg.WitnessKey{Name: *name, VerificationKey: *vkey}
+	nkey, err := wkey.NoteKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("witness %s", nkey)
+
+	http.Handle("/add-checkpoint", w)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,132 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func writeDeterministicForTest(t *testing.T, r *Recorder) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := r.WriteInternal(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func newDeterministicForTest(t *testing.T, seed []byte, keys []int, opts ...Option) *Recorder {
+	t.Helper()
+	r, err := NewEmptyRecorder(nil, append(opts, WithDeterministicSeed(seed))...)
+	if err != nil {
+		t.Fatalf("cannot create recorder: %v", err)
+	}
+	for _, i := range keys {
+		if err := r.Insert([]byte(fmt.Sprint("key", i)), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func Test_Deterministic(t *testing.T) {
+	t.Parallel()
+
+	seed := []byte("a secret seed")
+	for _, suite := range []string{VRFCONIKS, VRFEdwards25519TAI, VRFEdwards25519ELL2, VRFP256TAI} {
+		suite := suite
+		t.Run(suite, func(t *testing.T) {
+			t.Parallel()
+			opts := []Option{WithName("dataset"), WithVRFSuite(suite)}
+			r1 := newDeterministicForTest(t, seed, []int{0, 1, 2, 3, 4, 5}, opts...)
+			r2 := newDeterministicForTest(t, seed, []int{5, 3, 1, 0, 2, 4}, opts...)
+			state := writeDeterministicForTest(t, r1)
+			if !bytes.Equal(state, writeDeterministicForTest(t, r2)) {
+				t.Fatal("same records give different states")
+			}
+			h, err := r1.Header()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !h.Deterministic || !h.Timestamp.IsZero() {
+				t.Fatalf("unexpected header: %+v", h)
+			}
+
+			// A reloaded recorder stays deterministic.
+			r3 := newDeterministicForTest(t, seed, []int{0, 1, 2}, opts...)
+			r3, err = NewRecorderFromReader(bytes.NewReader(writeDeterministicForTest(t, r3)), r3.Private())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, i := range []int{3, 4, 5} {
+				if err := r3.Insert([]byte(fmt.Sprint("key", i)), []byte{byte(i)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(state, writeDeterministicForTest(t, r3)) {
+				t.Fatal("reloaded recorder gives a different state")
+			}
+
+			// So does a salvaged one.
+			r4, _, err := Salvage(bytes.NewReader(writeDeterministicForTest(t, r3)), r3.Private())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(state, writeDeterministicForTest(t, r4)) {
+				t.Fatal("salvaged recorder gives a different state")
+			}
+
+			// Proofs verify as usual.
+			public, err := r1.Public()
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := NewVerifier(public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proof, err := r1.get([]byte("key2"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := v.VerifyInclusion(*proof, []byte("key2"), []byte{2}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func Test_DeterministicSeeds(t *testing.T) {
+	t.Parallel()
+
+	keys := []int{0, 1, 2}
+	r1 := newDeterministicForTest(t, []byte("seed 1"), keys)
+	r2 := newDeterministicForTest(t, []byte("seed 2"), keys)
+	if bytes.Equal(r1.Private(), r2.Private()) {
+		t.Fatal("different seeds give the same key")
+	}
+	p1, err := r1.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := r2.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(p1, p2) {
+		t.Fatal("different seeds give the same public data")
+	}
+
+	// Without a seed, recordings differ.
+	r3, err := NewEmptyRecorder(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := r3.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Deterministic || h.Timestamp.IsZero() {
+		t.Fatalf("unexpected header: %+v", h)
+	}
+}
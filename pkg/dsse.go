@@ -0,0 +1,249 @@
+package pkg
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Payload types of DSSE envelopes.
+const (
+	// PayloadTypePublic is the type of public data,
+	// as returned by Recorder.Public().
+	PayloadTypePublic = "application/vnd.dataset-recorder.public+json"
+	// PayloadTypeTreeHead is the type of tree heads.
+	PayloadTypeTreeHead = "application/vnd.dataset-recorder.treehead+json"
+	// PayloadTypeInToto is the type of in-toto statements.
+	PayloadTypeInToto = "application/vnd.in-toto+json"
+)
+
+var (
+	// ErrUnsupportedKey indicates a key is neither Ed25519 nor ECDSA.
+	ErrUnsupportedKey = errors.New("[dsse] unsupported key")
+	// ErrNoValidSignature indicates no signature of an
+	// envelope verifies with the given keys.
+	ErrNoValidSignature = errors.New("[dsse] no valid signature")
+	// ErrPayloadType indicates an envelope carries
+	// an unexpected payload.
+	ErrPayloadType = errors.New("[dsse] unexpected payload type")
+)
+
+// Envelope is a DSSE envelope.
+type Envelope struct {
+	PayloadType string              `json:"payloadType"`
+	Payload     []byte              `json:"payload"`
+	Signatures  []EnvelopeSignature `json:"signatures"`
+}
+
+// EnvelopeSignature is a signature of a DSSE envelope.
+type EnvelopeSignature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   []byte `json:"sig"`
+}
+
+// VerifiedEnvelope is an envelope with at least one valid
+// signature. It is only returned by Envelope.Verify.
+type VerifiedEnvelope struct {
+	payloadType string
+	payload     []byte
+}
+
+// PayloadType returns the type of the verified payload.
+func (v *VerifiedEnvelope) PayloadType() string {
+	return v.payloadType
+}
+
+// Payload returns the verified payload.
+func (v *VerifiedEnvelope) Payload() []byte {
+	return append([]byte{}, v.payload...)
+}
+
+// pae is the pre-authentication encoding of DSSE v1,
+// which is what is signed.
+func pae(payloadType string, payload []byte) []byte {
+	b := []byte(fmt.Sprintf("DSSEv1 %d %s %d ", len(payloadType), payloadType, len(payload)))
+	return append(b, payload...)
+}
+
+// ecdsaHash returns the hash of ECDSA signatures over curve.
+func ecdsaHash(curve elliptic.Curve) (crypto.Hash, error) {
+	switch curve {
+	case elliptic.P256():
+		return crypto.SHA256, nil
+	case elliptic.P384():
+		return crypto.SHA384, nil
+	case elliptic.P521():
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("%w: curve %v", ErrUnsupportedKey, curve.Params().Name)
+}
+
+func ecdsaDigest(h crypto.Hash, m []byte) []byte {
+	switch h {
+	case crypto.SHA256:
+		d := sha256.Sum256(m)
+		return d[:]
+	case crypto.SHA384:
+		d := sha512.Sum384(m)
+		return d[:]
+	}
+	d := sha512.Sum512(m)
+	return d[:]
+}
+
+// NewEnvelope returns an envelope of the payload with no signature.
+func NewEnvelope(payloadType string, payload []byte) *Envelope {
+	return &Envelope{
+		PayloadType: payloadType,
+		Payload:     append([]byte{}, payload...),
+	}
+}
+
+// Sign adds a signature by signer to the envelope, which must be an
+// Ed25519 or ECDSA key. ECDSA signatures are ASN.1-encoded, over the
+// SHA-2 digest matching the curve. keyID is optional.
+func (e *Envelope) Sign(signer crypto.Signer, keyID string) error {
+	m := pae(e.PayloadType, e.Payload)
+	var (
+		sig []byte
+		err error
+	)
+	switch pub := signer.Public().(type) {
+	case ed25519.PublicKey:
+		sig, err = signer.Sign(rand.Reader, m, crypto.Hash(0))
+	case *ecdsa.PublicKey:
+		h, herr := ecdsaHash(pub.Curve)
+		if herr != nil {
+			return herr
+		}
+		sig, err = signer.Sign(rand.Reader, ecdsaDigest(h, m), h)
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+	}
+	if err != nil {
+		return err
+	}
+	e.Signatures = append(e.Signatures, EnvelopeSignature{
+		KeyID: keyID,
+		Sig:   sig,
+	})
+	return nil
+}
+
+// Verify verifies that a signature of the envelope is valid
+// for one of keys, which are Ed25519 or ECDSA public keys.
+// Key identifiers are hints, and are not checked.
+func (e *Envelope) Verify(keys ...crypto.PublicKey) (*VerifiedEnvelope, error) {
+	m := pae(e.PayloadType, e.Payload)
+	for _, key := range keys {
+		for _, s := range e.Signatures {
+			ok, err := verifySignature(key, m, s.Sig)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return &VerifiedEnvelope{
+					payloadType: e.PayloadType,
+					payload:     append([]byte{}, e.Payload...),
+				}, nil
+			}
+		}
+	}
+	return nil, ErrNoValidSignature
+}
+
+func verifySignature(key crypto.PublicKey, m, sig []byte) (bool, error) {
+	switch pub := key.(type) {
+	case ed25519.PublicKey:
+		// ed25519.Verify panics on keys of the wrong size.
+		if len(pub) != ed25519.PublicKeySize {
+			return false, fmt.Errorf("%w: Ed25519 key of %d bytes", ErrUnsupportedKey, len(pub))
+		}
+		return ed25519.Verify(pub, m, sig), nil
+	case *ecdsa.PublicKey:
+		h, err := ecdsaHash(pub.Curve)
+		if err != nil {
+			return false, err
+		}
+		return ecdsa.VerifyASN1(pub, ecdsaDigest(h, m), sig), nil
+	}
+	return false, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+}
+
+// PublicEnvelope returns the public data in an envelope signed by signer.
+func (r *Recorder) PublicEnvelope(signer crypto.Signer, keyID string) (*Envelope, error) {
+	public, err := r.Public()
+	if err != nil {
+		return nil, err
+	}
+	e := NewEnvelope(PayloadTypePublic, public)
+	if err := e.Sign(signer, keyID); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Envelope returns the tree head in an envelope signed by signer.
+func (h *TreeHead) Envelope(signer crypto.Signer, keyID string) (*Envelope, error) {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	e := NewEnvelope(PayloadTypeTreeHead, b)
+	if err := e.Sign(signer, keyID); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Envelope returns the statement in an envelope signed by signer.
+func (s *Statement) Envelope(signer crypto.Signer, keyID string) (*Envelope, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	e := NewEnvelope(PayloadTypeInToto, b)
+	if err := e.Sign(signer, keyID); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// TreeHead returns the verified tree head.
+func (v *VerifiedEnvelope) TreeHead() (*TreeHead, error) {
+	if v.payloadType != PayloadTypeTreeHead {
+		return nil, fmt.Errorf("%w: %q", ErrPayloadType, v.payloadType)
+	}
+	var h TreeHead
+	if err := json.Unmarshal(v.payload, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// NewVerifierFromEnvelope returns a verifier of the public
+// data carried by a verified envelope, either directly or in
+// a tree head.
+func NewVerifierFromEnvelope(v *VerifiedEnvelope) (*Verifier, error) {
+	if v == nil {
+		return nil, ErrNoValidSignature
+	}
+	switch v.payloadType {
+	case PayloadTypePublic:
+		return NewVerifier(v.payload)
+	case PayloadTypeTreeHead:
+		h, err := v.TreeHead()
+		if err != nil {
+			return nil, err
+		}
+		return NewVerifier(h.Public)
+	}
+	return nil, fmt.Errorf("%w: %q", ErrPayloadType, v.payloadType)
+}
@@ -0,0 +1,162 @@
+package pkg
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_PAE(t *testing.T) {
+	t.Parallel()
+
+	// Example of the DSSE specification.
+	got := string(pae("http://example.com/HelloWorld", []byte("hello world")))
+	if want := "DSSEv1 29 http://example.com/HelloWorld 11 hello world"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func Test_Envelope(t *testing.T) {
+	t.Parallel()
+
+	_, edKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTreeHeadTestRecorder(t, "dataset", 3)
+	public, err := r.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, signer := range []crypto.Signer{edKey, p256Key, p384Key} {
+		e, err := r.PublicEnvelope(signer, "key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Envelope
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(*e, got); diff != "" {
+			t.Fatalf("unexpected envelope (-want +got): \n%s", diff)
+		}
+		verified, err := got.Verify(p256Key.Public(), signer.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if verified.PayloadType() != PayloadTypePublic || string(verified.Payload()) != string(public) {
+			t.Fatalf("unexpected payload: %s", verified.Payload())
+		}
+		if _, err := NewVerifierFromEnvelope(verified); err != nil {
+			t.Fatal(err)
+		}
+
+		// The payload type is signed.
+		altered := got
+		altered.PayloadType = PayloadTypeTreeHead
+		if _, err := altered.Verify(signer.Public()); !errors.Is(err, ErrNoValidSignature) {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	if _, err := NewEnvelope(PayloadTypePublic, public).Verify(edKey.Public()); !errors.Is(err, ErrNoValidSignature) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.PublicEnvelope(rsaKey, ""); !errors.Is(err, ErrUnsupportedKey) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Ed25519 keys of the wrong size are rejected.
+	e, err := r.PublicEnvelope(edKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Verify(ed25519.PublicKey(make([]byte, 3))); !errors.Is(err, ErrUnsupportedKey) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func Test_TreeHeadEnvelope(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTreeHeadTestRecorder(t, "dataset", 3)
+	head, err := r.TreeHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := head.Envelope(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := e.Verify(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := verified.TreeHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(head, got); diff != "" {
+		t.Fatalf("unexpected tree head (-want +got): \n%s", diff)
+	}
+
+	v, err := NewVerifierFromEnvelope(verified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := r.get([]byte("key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyInclusion(*proof, []byte("key1"), []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Statements are not public data.
+	s, err := r.Statement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	se, err := s.Envelope(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err = se.Verify(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifierFromEnvelope(verified); !errors.Is(err, ErrPayloadType) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := NewVerifierFromEnvelope(nil); !errors.Is(err, ErrNoValidSignature) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/pad"
+)
+
+func testSuiteRoundTrip(t *testing.T, opts ...Option) {
+	r, err := NewEmptyRecorder(nil, opts...)
+	if err != nil {
+		t.Fatalf("cannot create recorder: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := r.Insert([]byte(fmt.Sprint("key", i)), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var b bytes.Buffer
+	if err := r.WriteInternal(&b); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProverFromReader(&b, r.Private())
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := p.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifier(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := p.Get([]byte("key3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyInclusion(*proof, []byte("key3"), []byte{3}); err != nil {
+		t.Fatal(err)
+	}
+	// The proof is not valid for another key.
+	if err := v.VerifyInclusion(*proof, []byte("key4"), []byte{3}); err == nil {
+		t.Fatal("expected error")
+	}
+	proof, err = p.Get([]byte("key9"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyExclusion(*proof, []byte("key9"), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_HashSuites(t *testing.T) {
+	t.Parallel()
+
+	for _, suite := range []string{HashSHAKE128, HashSHA256, HashBLAKE2b256} {
+		suite := suite
+		t.Run(suite, func(t *testing.T) {
+			t.Parallel()
+			testSuiteRoundTrip(t, WithHashSuite(suite))
+		})
+	}
+	if _, err := NewEmptyRecorder(nil, WithHashSuite("MD5")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func Test_VRFSuites(t *testing.T) {
+	t.Parallel()
+
+	suites := []string{VRFCONIKS, VRFEdwards25519TAI, VRFEdwards25519ELL2, VRFP256TAI}
+	for _, suite := range suites {
+		suite := suite
+		t.Run(suite, func(t *testing.T) {
+			t.Parallel()
+			testSuiteRoundTrip(t, WithVRFSuite(suite))
+
+			// Proofs do not verify with another suite.
+			r, err := NewEmptyRecorder(nil, WithVRFSuite(suite))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Insert([]byte("key"), []byte("value")); err != nil {
+				t.Fatal(err)
+			}
+			proof, err := r.get([]byte("key"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			public, err := r.Public()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, other := range suites {
+				if other == suite {
+					continue
+				}
+				p, err := pad.ParsePublic(public)
+				if err != nil {
+					t.Fatal(err)
+				}
+				p.VRFSuite = other
+				b, err := json.Marshal(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				v, err := NewVerifier(b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := v.VerifyInclusion(*proof, []byte("key"), []byte("value")); !errors.Is(err, ErrInvalidIndex) {
+					t.Fatalf("%s: unexpected err: %v", other, err)
+				}
+			}
+		})
+	}
+	if _, err := NewEmptyRecorder(nil, WithVRFSuite("ECVRF-UNKNOWN")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func Test_TreeVersions(t *testing.T) {
+	t.Parallel()
+
+	for _, version := range []int{1, 2} {
+		version := version
+		t.Run(fmt.Sprint(version), func(t *testing.T) {
+			t.Parallel()
+			testSuiteRoundTrip(t, WithTreeVersion(version))
+
+			r, err := NewEmptyRecorder(nil, WithTreeVersion(version))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.Insert([]byte("key"), []byte("value")); err != nil {
+				t.Fatal(err)
+			}
+			public, err := r.Public()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Version 1 public data is unchanged from before versions.
+			var fields map[string]any
+			if err := json.Unmarshal(public, &fields); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := fields["treeVersion"]; ok != (version != 1) {
+				t.Fatalf("unexpected public data: %s", public)
+			}
+
+			// Salvaging a state whose header is damaged finds the version.
+			var b bytes.Buffer
+			if err := r.WriteInternal(&b); err != nil {
+				t.Fatal(err)
+			}
+			state := b.Bytes()
+			state[1+8] = 'X'
+			_, report, err := Salvage(bytes.NewReader(state), r.Private())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.HeaderIntact || report.TreeVersion != version || !report.Complete {
+				t.Fatalf("unexpected report: %+v", report)
+			}
+		})
+	}
+	if _, err := NewEmptyRecorder(nil, WithTreeVersion(3)); err == nil {
+		t.Fatal("expected error")
+	}
+}
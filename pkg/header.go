@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/utils"
+)
+
+// maxHeaderSize bounds the size of a serialized header, so that
+// a corrupted length does not trigger a huge allocation.
+const maxHeaderSize = 1 << 20
+
+var (
+	// ErrNoHeader indicates the state was written in a format
+	// that predates headers.
+	ErrNoHeader = errors.New("no header")
+	// ErrHeaderMismatch indicates the header does not describe
+	// the tree it was stored with.
+	ErrHeaderMismatch = errors.New("header mismatch")
+)
+
+// Header describes the content of a state file. It is stored
+// in clear after the version byte so that it can be read without
+// loading the tree.
+type Header struct {
+	// Name is the name of the recorded dataset.
+	Name string `json:"name"`
+	// Records is the number of records in the tree.
+	Records uint64 `json:"records"`
+	// HashSuite identifies the hash function used by the tree.
+	HashSuite string `json:"hashSuite"`
+	// VRFSuite identifies the VRF used to compute indices.
+	// It is empty in public-index mode.
+	VRFSuite string `json:"vrfSuite"`
+	// Timestamp is the last time the records were modified.
+	Timestamp time.Time `json:"timestamp"`
+	// Labels are free-form annotations.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Public is the public data for verification, as returned
+	// by Recorder.Public().
+	Public []byte `json:"public"`
+	// Deterministic is true if the nonce and salts are derived
+	// from a seed. See WithDeterministicSeed.
+	Deterministic bool `json:"deterministic,omitempty"`
+}
+
+// ReadHeader reads the header of a state file, without reading
+// the tree.
+func ReadHeader(reader io.Reader) (*Header, error) {
+	v, err := readVersion(reader)
+	if err != nil {
+		return nil, err
+	}
+	if v == versionNoHeader {
+		return nil, ErrNoHeader
+	}
+	return readHeader(reader)
+}
+
+func readHeader(reader io.Reader) (*Header, error) {
+	lenBytes := make([]byte, 8)
+	if _, err := io.ReadFull(reader, lenBytes); err != nil {
+		return nil, err
+	}
+	size := utils.BytesToULong(lenBytes)
+	if size > maxHeaderSize {
+		return nil, fmt.Errorf("header too large (%d bytes)", size)
+	}
+	content := make([]byte, size)
+	if _, err := io.ReadFull(reader, content); err != nil {
+		return nil, err
+	}
+	var h Header
+	if err := json.Unmarshal(content, &h); err != nil {
+		return nil, fmt.Errorf("unmarshal header: %w", err)
+	}
+	return &h, nil
+}
+
+func writeHeader(writer io.Writer, h *Header) error {
+	content, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	val := append([]byte{}, utils.ULongToBytes(uint64(len(content)))...)
+	val = append(val, content...)
+	n, err := writer.Write(val)
+	if err != nil {
+		return err
+	}
+	if n != len(val) {
+		return fmt.Errorf("wrote %d bytes, expected %d", n, len(val))
+	}
+	return nil
+}
+
+func (h *Header) clone() *Header {
+	c := *h
+	c.Public = append([]byte{}, h.Public...)
+	if h.Labels != nil {
+		c.Labels = make(map[string]string, len(h.Labels))
+		for k, v := range h.Labels {
+			c.Labels[k] = v
+		}
+	}
+	return &c
+}
@@ -0,0 +1,178 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto/vrf"
+)
+
+func newHeaderTestRecorder(t *testing.T, entries uint64, opts ...Option) *Recorder {
+	r, err := NewEmptyRecorder(nil, append([]Option{WithName("dataset"),
+		WithLabel("source", "file.parquet"), WithLabel("owner", "team")}, opts...)...)
+	if err != nil {
+		t.Fatalf("cannot create recorder: %v", err)
+	}
+	for i := uint64(0); i < entries; i++ {
+		key := "key" + fmt.Sprint(i)
+		value := append([]byte("value"), byte(i))
+		if err := r.Insert([]byte(key), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func Test_ReadHeader(t *testing.T) {
+	t.Parallel()
+
+	r := newHeaderTestRecorder(t, 10)
+	var b bytes.Buffer
+	if err := r.WriteInternal(&b); err != nil {
+		t.Fatal(err)
+	}
+	h, err := ReadHeader(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := r.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Header{
+		Name:      "dataset",
+		Records:   10,
+		HashSuite: crypto.DefaultHash.String(),
+		VRFSuite:  vrf.DefaultSuite.String(),
+		Timestamp: r.timestamp,
+		Labels: map[string]string{
+			"source": "file.parquet",
+			"owner":  "team",
+		},
+		Public: public,
+	}
+	if diff := cmp.Diff(want, h); diff != "" {
+		t.Fatalf("unexpected err (-want +got): \n%s", diff)
+	}
+	// The header survives a round trip.
+	r2, err := NewRecorderFromReader(bytes.NewReader(b.Bytes()), r.Private())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := r2.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, h2); diff != "" {
+		t.Fatalf("unexpected err (-want +got): \n%s", diff)
+	}
+}
+
+func Test_HeaderMismatch(t *testing.T) {
+	t.Parallel()
+
+	r := newHeaderTestRecorder(t, 5)
+	other := newHeaderTestRecorder(t, 5)
+	otherPublic, err := other.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		modify func(h *Header)
+	}{
+		{
+			name:   "records",
+			modify: func(h *Header) { h.Records++ },
+		},
+		{
+			name:   "public",
+			modify: func(h *Header) { h.Public = otherPublic },
+		},
+		{
+			name:   "hash suite",
+			modify: func(h *Header) { h.HashSuite = HashSHA256 },
+		},
+		{
+			name:   "vrf suite",
+			modify: func(h *Header) { h.VRFSuite = "unknown" },
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			h, err := r.Header()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(h)
+			var b bytes.Buffer
+			b.Write([]byte{version})
+			if err := writeHeader(&b, h); err != nil {
+				t.Fatal(err)
+			}
+			if err := r.p.WriteInternal(&b); err != nil {
+				t.Fatal(err)
+			}
+			_, err = NewRecorderFromReader(&b, r.Private())
+			if !errors.Is(err, ErrHeaderMismatch) {
+				t.Fatalf("unexpected err: %v", err)
+			}
+		})
+	}
+}
+
+func Test_NoHeader(t *testing.T) {
+	t.Parallel()
+
+	// Legacy format: version followed by the tree,
+	// which predates tree versions.
+	r := newHeaderTestRecorder(t, 5, WithTreeVersion(1))
+	var b bytes.Buffer
+	b.Write([]byte{versionNoHeader})
+	if err := r.p.WriteInternal(&b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadHeader(bytes.NewReader(b.Bytes())); !errors.Is(err, ErrNoHeader) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	r2, err := NewRecorderFromReader(&b, r.Private())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := r.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r2.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected err (-want +got): \n%s", diff)
+	}
+}
+
+func Test_Version(t *testing.T) {
+	t.Parallel()
+
+	// Leaves store their keys since version 3.
+	r := newHeaderTestRecorder(t, 5)
+	var b bytes.Buffer
+	if err := r.WriteInternal(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Bytes()[0] != 0x03 {
+		t.Fatalf("unexpected version: %d", b.Bytes()[0])
+	}
+	data := append([]byte{}, b.Bytes()...)
+	data[0] = 0x04
+	if _, err := NewRecorderFromReader(bytes.NewReader(data), r.Private()); !errors.Is(err, ErrInvalidVersion) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
@@ -13,21 +13,32 @@ type Commit struct {
 }
 
 // NewCommit creates a new cryptographic commit to the passed byte slices
-// stuff (which won't be mutated). It creates a random salt before
-// committing to the values.
-func NewCommit(stuff ...[]byte) (*Commit, error) {
+// stuff (which won't be mutated), using the hash h. It creates a random
+// salt before committing to the values.
+func NewCommit(h Hash, stuff ...[]byte) (*Commit, error) {
 	salt, err := MakeRand()
 	if err != nil {
 		return nil, err
 	}
 	return &Commit{
 		Salt:  salt,
-		Value: Digest(append([][]byte{salt}, stuff...)...),
+		Value: h.Digest(append([][]byte{salt}, stuff...)...),
 	}, nil
 }
 
+// NewCommitWithSalt creates a commit like NewCommit, with the
+// passed salt instead of a random one. The salt must be secret
+// and unique to the committed values for the commit to hide them.
+func NewCommitWithSalt(h Hash, salt []byte, stuff ...[]byte) *Commit {
+	salt = append([]byte{}, salt...)
+	return &Commit{
+		Salt:  salt,
+		Value: h.Digest(append([][]byte{salt}, stuff...)...),
+	}
+}
+
 // Verify verifies that the underlying commit c was a commit to the passed
-// byte slices stuff (which won't be mutated).
-func (c *Commit) Verify(stuff ...[]byte) bool {
-	return bytes.Equal(c.Value, Digest(append([][]byte{c.Salt}, stuff...)...))
+// byte slices stuff (which won't be mutated), using the hash h.
+func (c *Commit) Verify(h Hash, stuff ...[]byte) bool {
+	return bytes.Equal(c.Value, h.Digest(append([][]byte{c.Salt}, stuff...)...))
 }
@@ -2,18 +2,103 @@ package crypto
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
 
+	"golang.org/x/crypto/blake2b"
 	"golang.org/x/crypto/sha3"
 )
 
 const (
-	// HashSizeByte is the size of the hash output in bytes.
+	// HashSizeByte is the size of the hash output in bytes,
+	// for all hash suites.
 	HashSizeByte = 32
-	// HashID identifies the used hash as a string.
-	HashID = "SHAKE128"
 )
 
-// Digest hashes all passed byte slices.
+// Hash identifies the hash function used by a tree.
+type Hash uint8
+
+const (
+	// SHAKE128 with a 256-bit output. It is the default.
+	SHAKE128 Hash = iota + 1
+	// SHA256 is SHA-256.
+	SHA256
+	// BLAKE2b256 is BLAKE2b with a 256-bit output.
+	BLAKE2b256
+)
+
+// DefaultHash is the hash used by trees created without a
+// hash suite, including all trees that predate hash suites.
+const DefaultHash = SHAKE128
+
+var (
+	// ErrUnknownHash indicates the hash suite is not supported.
+	ErrUnknownHash = errors.New("[crypto] unknown hash suite")
+)
+
+var hashNames = map[Hash]string{
+	SHAKE128:   "SHAKE128",
+	SHA256:     "SHA-256",
+	BLAKE2b256: "BLAKE2b-256",
+}
+
+// String returns the identifier of the hash suite.
+func (h Hash) String() string {
+	if name, ok := hashNames[h]; ok {
+		return name
+	}
+	return fmt.Sprintf("Hash(%d)", uint8(h))
+}
+
+// Available returns true if the hash suite is supported.
+func (h Hash) Available() bool {
+	_, ok := hashNames[h]
+	return ok
+}
+
+// Hashes returns all supported hash suites.
+func Hashes() []Hash {
+	return []Hash{SHAKE128, SHA256, BLAKE2b256}
+}
+
+// ParseHash returns the hash suite with the identifier name.
+func ParseHash(name string) (Hash, error) {
+	for h, n := range hashNames {
+		if n == name {
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownHash, name)
+}
+
+// Digest hashes all passed byte slices with h.
+// The passed slices won't be mutated.
+func (h Hash) Digest(ms ...[]byte) []byte {
+	switch h {
+	case SHA256:
+		d := sha256.New()
+		for _, m := range ms {
+			d.Write(m)
+		}
+		return d.Sum(nil)
+	case BLAKE2b256:
+		d, err := blake2b.New256(nil)
+		if err != nil {
+			// Only fails with a key that is too long.
+			panic(err)
+		}
+		for _, m := range ms {
+			d.Write(m)
+		}
+		return d.Sum(nil)
+	case SHAKE128:
+		return Digest(ms...)
+	}
+	panic(fmt.Sprintf("%v: %v", ErrUnknownHash, h))
+}
+
+// Digest hashes all passed byte slices with SHAKE128.
 // The passed slices won't be mutated.
 func Digest(ms ...[]byte) []byte {
 	h := sha3.NewShake128()
@@ -0,0 +1,100 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestDigest(t *testing.T) {
+	t.Parallel()
+
+	// Known answers for "abc", split over several slices.
+	tests := []struct {
+		hash Hash
+		want string
+	}{
+		{
+			hash: SHAKE128,
+			want: "5881092dd818bf5cf8a3ddb793fbcba74097d5c526a6d35f97b83351940f2cc8",
+		},
+		{
+			hash: SHA256,
+			want: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		},
+		{
+			hash: BLAKE2b256,
+			want: "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.hash.String(), func(t *testing.T) {
+			t.Parallel()
+			got := hex.EncodeToString(tt.hash.Digest([]byte("a"), []byte("bc")))
+			if got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+			h, err := ParseHash(tt.hash.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h != tt.hash {
+				t.Fatalf("got %v, want %v", h, tt.hash)
+			}
+		})
+	}
+	if _, err := ParseHash("MD5"); !errors.Is(err, ErrUnknownHash) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func TestDigestMultipleInputs(t *testing.T) {
+	t.Parallel()
+
+	// Known answers for inputs shaped like the ones hashed by the
+	// tree: an empty slice, a key, binary bytes, a value and a
+	// 32-byte nonce. They only depend on the concatenation.
+	nonce := make([]byte, 32)
+	for i := range nonce {
+		nonce[i] = byte(i)
+	}
+	ms := [][]byte{{}, []byte("key"), {0x00, 0xff}, []byte("value"), nonce}
+	tests := []struct {
+		hash Hash
+		want string
+	}{
+		{
+			hash: SHAKE128,
+			want: "21120907aa7ec09e3cf7f4a247da28a647274c4d498e0ce09c61ed85507dcf64",
+		},
+		{
+			hash: SHA256,
+			want: "826f4949c4651ad8cbb7e9eddfa194b3b768b18fbf07367f54cd1b9632e1e05b",
+		},
+		{
+			hash: BLAKE2b256,
+			want: "0e824a13d4e190ba88ec0a5c3b37fd96a4d99943220421dde8955fbf6c198cd8",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.hash.String(), func(t *testing.T) {
+			t.Parallel()
+			got := hex.EncodeToString(tt.hash.Digest(ms...))
+			if got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+			var all []byte
+			for _, m := range ms {
+				all = append(all, m...)
+			}
+			if got := hex.EncodeToString(tt.hash.Digest(all)); got != tt.want {
+				t.Fatalf("got %s for the concatenation, want %s", got, tt.want)
+			}
+		})
+	}
+	if got := hex.EncodeToString(Digest(ms...)); got != tests[0].want {
+		t.Fatalf("got %s, want %s", got, tests[0].want)
+	}
+}
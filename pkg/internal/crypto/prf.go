@@ -0,0 +1,63 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"io"
+)
+
+// PRF returns HMAC-SHA256 under key of the label and the messages ms.
+// Each input is prefixed with its length, so that distinct inputs
+// never collide. The output is HashSizeByte long.
+func PRF(key []byte, label string, ms ...[]byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	prfWrite(mac, []byte(label))
+	for _, m := range ms {
+		prfWrite(mac, m)
+	}
+	return mac.Sum(nil)
+}
+
+func prfWrite(h hash.Hash, m []byte) {
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(m)))
+	h.Write(size[:])
+	h.Write(m)
+}
+
+// prfReader is an endless stream of PRF outputs
+// under a key, label and counter.
+type prfReader struct {
+	key     []byte
+	label   string
+	counter uint64
+	buf     []byte
+}
+
+// NewPRFReader returns a reader of pseudo-random bytes
+// derived from key and label. It can replace a source of
+// randomness when the output must be reproducible.
+func NewPRFReader(key []byte, label string) io.Reader {
+	return &prfReader{
+		key:   append([]byte{}, key...),
+		label: label,
+	}
+}
+
+func (r *prfReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			var ctr [8]byte
+			binary.BigEndian.PutUint64(ctr[:], r.counter)
+			r.buf = PRF(r.key, r.label, ctr[:])
+			r.counter++
+		}
+		c := copy(p[n:], r.buf)
+		r.buf = r.buf[c:]
+		n += c
+	}
+	return n, nil
+}
@@ -0,0 +1,64 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestPRF(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("key")
+	if got := PRF(key, "label", []byte("ab"), []byte("c")); len(got) != HashSizeByte {
+		t.Fatalf("size: %d", len(got))
+	}
+	if !bytes.Equal(PRF(key, "label", []byte("m")), PRF(key, "label", []byte("m"))) {
+		t.Fatal("not deterministic")
+	}
+	// Inputs are length-prefixed, so moving bytes
+	// between them changes the output.
+	distinct := [][]byte{
+		PRF(key, "label", []byte("ab"), []byte("c")),
+		PRF(key, "label", []byte("a"), []byte("bc")),
+		PRF(key, "labela", []byte("b"), []byte("c")),
+		PRF([]byte("other"), "label", []byte("ab"), []byte("c")),
+	}
+	for i := range distinct {
+		for j := i + 1; j < len(distinct); j++ {
+			if bytes.Equal(distinct[i], distinct[j]) {
+				t.Errorf("outputs %d and %d collide", i, j)
+			}
+		}
+	}
+}
+
+func TestPRFReader(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("key")
+	want := make([]byte, 3*HashSizeByte+7)
+	if _, err := io.ReadFull(NewPRFReader(key, "label"), want); err != nil {
+		t.Fatal(err)
+	}
+	// Reads of any size see the same stream.
+	r := NewPRFReader(key, "label")
+	var got []byte
+	for _, n := range []int{1, 40, 7, HashSizeByte, 23} {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, b...)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("streams differ:\n%x\n%x", got, want)
+	}
+	other := make([]byte, len(want))
+	if _, err := io.ReadFull(NewPRFReader(key, "other"), other); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(other, want) {
+		t.Fatal("labels are not separated")
+	}
+}
@@ -0,0 +1,144 @@
+// Package sign implements the signature algorithms of tree heads.
+// All algorithms share the byte encodings of private and public
+// keys, whose content is algorithm-specific.
+package sign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto/slhdsa"
+)
+
+// Algorithm identifies a signature algorithm.
+type Algorithm uint8
+
+const (
+	// Ed25519 is Ed25519 from RFC 8032. Private keys are
+	// the seed followed by the public key.
+	Ed25519 Algorithm = iota + 1
+	// SLHDSASHAKE128s is SLH-DSA-SHAKE-128s from FIPS 205, a
+	// hash-based algorithm with small signatures and slow signing,
+	// for tree heads that must remain verifiable for decades.
+	SLHDSASHAKE128s
+	// SLHDSASHAKE128f is SLH-DSA-SHAKE-128f from FIPS 205, which
+	// signs faster than SLHDSASHAKE128s with larger signatures.
+	SLHDSASHAKE128f
+)
+
+var (
+	// ErrUnknownAlgorithm indicates the algorithm is not supported.
+	ErrUnknownAlgorithm = errors.New("[sign] unknown algorithm")
+	// ErrInvalidKey indicates a key has the wrong size.
+	ErrInvalidKey = errors.New("[sign] invalid key")
+)
+
+var algorithmNames = map[Algorithm]string{
+	Ed25519:         "Ed25519",
+	SLHDSASHAKE128s: "SLH-DSA-SHAKE-128s",
+	SLHDSASHAKE128f: "SLH-DSA-SHAKE-128f",
+}
+
+// String returns the identifier of the algorithm.
+func (a Algorithm) String() string {
+	if name, ok := algorithmNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Algorithm(%d)", uint8(a))
+}
+
+// Available returns true if the algorithm is supported.
+func (a Algorithm) Available() bool {
+	_, ok := algorithmNames[a]
+	return ok
+}
+
+// Algorithms returns all supported algorithms.
+func Algorithms() []Algorithm {
+	return []Algorithm{Ed25519, SLHDSASHAKE128s, SLHDSASHAKE128f}
+}
+
+// ParseAlgorithm returns the algorithm with the identifier name.
+func ParseAlgorithm(name string) (Algorithm, error) {
+	for a, n := range algorithmNames {
+		if n == name {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, name)
+}
+
+// slhdsa returns the parameters of SLH-DSA algorithms, or nil.
+func (a Algorithm) slhdsa() *slhdsa.Params {
+	switch a {
+	case SLHDSASHAKE128s:
+		return slhdsa.SHAKE128s
+	case SLHDSASHAKE128f:
+		return slhdsa.SHAKE128f
+	}
+	return nil
+}
+
+// GenerateKey creates a private key for the algorithm using rnd
+// for randomness. If rnd is nil, crypto/rand is used.
+func (a Algorithm) GenerateKey(rnd io.Reader) ([]byte, error) {
+	if rnd == nil {
+		rnd = rand.Reader
+	}
+	if a == Ed25519 {
+		_, sk, err := ed25519.GenerateKey(rnd)
+		return sk, err
+	}
+	if p := a.slhdsa(); p != nil {
+		_, sk, err := p.GenerateKey(rnd)
+		return sk, err
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnknownAlgorithm, a)
+}
+
+// Public returns the public key of sk.
+func (a Algorithm) Public(sk []byte) ([]byte, error) {
+	if a == Ed25519 {
+		if len(sk) != ed25519.PrivateKeySize {
+			return nil, ErrInvalidKey
+		}
+		return append([]byte{}, ed25519.PrivateKey(sk).Public().(ed25519.PublicKey)...), nil
+	}
+	if p := a.slhdsa(); p != nil {
+		if len(sk) != p.PrivateKeySize() {
+			return nil, ErrInvalidKey
+		}
+		return p.Public(sk)
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnknownAlgorithm, a)
+}
+
+// Sign signs m with sk. Signatures of all algorithms are
+// deterministic, so signing the same message twice gives
+// the same signature.
+func (a Algorithm) Sign(sk, m []byte) ([]byte, error) {
+	if a == Ed25519 {
+		if len(sk) != ed25519.PrivateKeySize {
+			return nil, ErrInvalidKey
+		}
+		return ed25519.Sign(sk, m), nil
+	}
+	if p := a.slhdsa(); p != nil {
+		return p.Sign(nil, sk, m, nil)
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnknownAlgorithm, a)
+}
+
+// Verify returns true if sig is a valid signature of m by pk.
+func (a Algorithm) Verify(pk, m, sig []byte) bool {
+	if a == Ed25519 {
+		return len(pk) == ed25519.PublicKeySize && ed25519.Verify(pk, m, sig)
+	}
+	if p := a.slhdsa(); p != nil {
+		return p.Verify(pk, m, sig, nil)
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package sign
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestAlgorithms(t *testing.T) {
+	t.Parallel()
+
+	for _, a := range Algorithms() {
+		a := a
+		t.Run(a.String(), func(t *testing.T) {
+			t.Parallel()
+			if got, err := ParseAlgorithm(a.String()); err != nil || got != a {
+				t.Fatalf("cannot parse %v: %v", a, err)
+			}
+			sk, err := a.GenerateKey(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pk, err := a.Public(sk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := []byte("message")
+			sig, err := a.Sign(sk, m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sig2, err := a.Sign(sk, m); err != nil || !bytes.Equal(sig, sig2) {
+				t.Fatal("signature is not deterministic")
+			}
+			if !a.Verify(pk, m, sig) {
+				t.Fatal("signature does not verify")
+			}
+			if a.Verify(pk, []byte("other"), sig) {
+				t.Fatal("verifies another message")
+			}
+			for _, b := range Algorithms() {
+				if b != a && b.Verify(pk, m, sig) {
+					t.Errorf("%v signature verifies as %v", a, b)
+				}
+			}
+		})
+	}
+}
+
+func TestUnknownAlgorithm(t *testing.T) {
+	t.Parallel()
+
+	if _, err := ParseAlgorithm("RSA"); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if _, err := Algorithm(0).GenerateKey(nil); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if Algorithm(0).Verify(nil, nil, nil) {
+		t.Error("unknown algorithm verifies")
+	}
+	if _, err := Ed25519.Sign(make([]byte, 3), nil); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("unexpected err: %v", err)
+	}
+}
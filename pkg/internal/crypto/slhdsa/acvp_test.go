@@ -0,0 +1,179 @@
+package slhdsa
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+)
+
+// The vectors in testdata are the NIST ACVP vectors of
+// https://github.com/usnistgov/ACVP-Server/tree/v1.1.0.38/gen-val/json-files
+// (SLH-DSA-keyGen-FIPS205, SLH-DSA-sigGen-FIPS205 and
+// SLH-DSA-sigVer-FIPS205), with the prompts merged with their expected
+// results. They are restricted to the parameter sets of this package
+// and, for signatures, to the pure variant of the external interface.
+
+// hexBytes is a hex-encoded field of the vectors.
+type hexBytes []byte
+
+func (h *hexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	*h = b
+	return nil
+}
+
+type acvpVectors[T any] struct {
+	Algorithm  string `json:"algorithm"`
+	Mode       string `json:"mode"`
+	Revision   string `json:"revision"`
+	TestGroups []struct {
+		TgID               int    `json:"tgId"`
+		ParameterSet       string `json:"parameterSet"`
+		SignatureInterface string `json:"signatureInterface"`
+		PreHash            string `json:"preHash"`
+		Deterministic      bool   `json:"deterministic"`
+		Tests              []T    `json:"tests"`
+	} `json:"testGroups"`
+}
+
+type acvpKeyGen struct {
+	TcID   int      `json:"tcId"`
+	SkSeed hexBytes `json:"skSeed"`
+	SkPrf  hexBytes `json:"skPrf"`
+	PkSeed hexBytes `json:"pkSeed"`
+	Sk     hexBytes `json:"sk"`
+	Pk     hexBytes `json:"pk"`
+}
+
+type acvpSigGen struct {
+	TcID                 int      `json:"tcId"`
+	Sk                   hexBytes `json:"sk"`
+	Message              hexBytes `json:"message"`
+	Context              hexBytes `json:"context"`
+	AdditionalRandomness hexBytes `json:"additionalRandomness"`
+	Signature            hexBytes `json:"signature"`
+}
+
+type acvpSigVer struct {
+	TcID       int      `json:"tcId"`
+	Pk         hexBytes `json:"pk"`
+	Message    hexBytes `json:"message"`
+	Context    hexBytes `json:"context"`
+	Signature  hexBytes `json:"signature"`
+	TestPassed bool     `json:"testPassed"`
+}
+
+func readACVP[T any](t *testing.T, mode string) *acvpVectors[T] {
+	t.Helper()
+	f, err := os.Open(fmt.Sprintf("testdata/SLH-DSA-%s-FIPS205.json.gz", mode))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v acvpVectors[T]
+	if err := json.NewDecoder(r).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Algorithm != "SLH-DSA" || v.Mode != mode || v.Revision != "FIPS205" {
+		t.Fatalf("unexpected vectors: %s %s %s", v.Algorithm, v.Mode, v.Revision)
+	}
+	if len(v.TestGroups) == 0 {
+		t.Fatal("no test groups")
+	}
+	return &v
+}
+
+func paramsForTest(t *testing.T, name string) *Params {
+	t.Helper()
+	for _, p := range []*Params{SHAKE128s, SHAKE128f} {
+		if p.String() == name {
+			return p
+		}
+	}
+	t.Fatalf("unknown parameter set %q", name)
+	return nil
+}
+
+func TestACVPKeyGen(t *testing.T) {
+	t.Parallel()
+
+	v := readACVP[acvpKeyGen](t, "keyGen")
+	for _, g := range v.TestGroups {
+		p := paramsForTest(t, g.ParameterSet)
+		for _, tt := range g.Tests {
+			seeds := append(append(append([]byte{}, tt.SkSeed...), tt.SkPrf...), tt.PkSeed...)
+			pk, sk, err := p.GenerateKey(bytes.NewReader(seeds))
+			if err != nil {
+				t.Fatalf("%v %d: %v", p, tt.TcID, err)
+			}
+			if !bytes.Equal(pk, tt.Pk) || !bytes.Equal(sk, tt.Sk) {
+				t.Errorf("%v %d: unexpected key", p, tt.TcID)
+			}
+		}
+	}
+}
+
+func TestACVPSigGen(t *testing.T) {
+	t.Parallel()
+
+	v := readACVP[acvpSigGen](t, "sigGen")
+	for _, g := range v.TestGroups {
+		if g.SignatureInterface != "external" || g.PreHash != "pure" {
+			t.Fatalf("group %d: unsupported interface", g.TgID)
+		}
+		p := paramsForTest(t, g.ParameterSet)
+		for _, tt := range g.Tests {
+			tt := tt
+			t.Run(fmt.Sprint(tt.TcID), func(t *testing.T) {
+				t.Parallel()
+				if p == SHAKE128s && testing.Short() {
+					t.Skip("slow signing in short mode")
+				}
+				var rnd io.Reader
+				if !g.Deterministic {
+					rnd = bytes.NewReader(tt.AdditionalRandomness)
+				}
+				sig, err := p.Sign(rnd, tt.Sk, tt.Message, tt.Context)
+				if err != nil {
+					t.Fatalf("%v: %v", p, err)
+				}
+				if !bytes.Equal(sig, tt.Signature) {
+					t.Errorf("%v: unexpected signature", p)
+				}
+			})
+		}
+	}
+}
+
+func TestACVPSigVer(t *testing.T) {
+	t.Parallel()
+
+	v := readACVP[acvpSigVer](t, "sigVer")
+	for _, g := range v.TestGroups {
+		if g.SignatureInterface != "external" || g.PreHash != "pure" {
+			t.Fatalf("group %d: unsupported interface", g.TgID)
+		}
+		p := paramsForTest(t, g.ParameterSet)
+		for _, tt := range g.Tests {
+			if got := p.Verify(tt.Pk, tt.Message, tt.Signature, tt.Context); got != tt.TestPassed {
+				t.Errorf("%v %d: got %v, want %v", p, tt.TcID, got, tt.TestPassed)
+			}
+		}
+	}
+}
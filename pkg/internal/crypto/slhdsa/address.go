@@ -0,0 +1,114 @@
+package slhdsa
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Address types of FIPS 205.
+const (
+	addrWOTSHash = iota
+	addrWOTSPK
+	addrTree
+	addrFORSTree
+	addrFORSRoots
+	addrWOTSPRF
+	addrFORSPRF
+)
+
+// address is the 32-byte ADRS of FIPS 205: the layer, a 12-byte tree
+// address, the type and three type-specific words.
+type address [32]byte
+
+func (a *address) setLayer(layer uint32) {
+	binary.BigEndian.PutUint32(a[0:4], layer)
+}
+
+func (a *address) setTree(tree uint64) {
+	binary.BigEndian.PutUint32(a[4:8], 0)
+	binary.BigEndian.PutUint64(a[8:16], tree)
+}
+
+func (a *address) setTypeAndClear(typ uint32) {
+	binary.BigEndian.PutUint32(a[16:20], typ)
+	clear(a[20:])
+}
+
+func (a *address) setKeyPair(i uint32) {
+	binary.BigEndian.PutUint32(a[20:24], i)
+}
+
+func (a *address) keyPair() uint32 {
+	return binary.BigEndian.Uint32(a[20:24])
+}
+
+// setChain also sets the tree height, which shares its word.
+func (a *address) setChain(i uint32) {
+	binary.BigEndian.PutUint32(a[24:28], i)
+}
+
+func (a *address) setTreeHeight(z uint32) {
+	a.setChain(z)
+}
+
+// setHash also sets the tree index, which shares its word.
+func (a *address) setHash(i uint32) {
+	binary.BigEndian.PutUint32(a[28:32], i)
+}
+
+func (a *address) setTreeIndex(i uint32) {
+	a.setHash(i)
+}
+
+func (a *address) treeIndex() uint32 {
+	return binary.BigEndian.Uint32(a[28:32])
+}
+
+// state holds the seeds of a key pair. SK.seed is nil when verifying.
+type state struct {
+	p      *Params
+	pkSeed []byte
+	skSeed []byte
+	h      sha3.ShakeHash
+}
+
+func (p *Params) newState(pkSeed, skSeed []byte) *state {
+	return &state{
+		p:      p,
+		pkSeed: pkSeed,
+		skSeed: skSeed,
+		h:      sha3.NewShake256(),
+	}
+}
+
+// shake returns size bytes of SHAKE256 over the
+// concatenation of in. It instantiates H_msg and PRF_msg.
+func (s *state) shake(size int, in ...[]byte) []byte {
+	s.h.Reset()
+	for _, b := range in {
+		s.h.Write(b)
+	}
+	out := make([]byte, size)
+	s.h.Read(out)
+	return out
+}
+
+// t is the tweakable hash SHAKE256(PK.seed || ADRS || in), which
+// instantiates F, H and T_l.
+func (s *state) t(adrs *address, in ...[]byte) []byte {
+	s.h.Reset()
+	s.h.Write(s.pkSeed)
+	s.h.Write(adrs[:])
+	for _, b := range in {
+		s.h.Write(b)
+	}
+	out := make([]byte, s.p.n)
+	s.h.Read(out)
+	return out
+}
+
+// prf derives a secret value: SHAKE256(PK.seed || ADRS || SK.seed).
+func (s *state) prf(adrs *address) []byte {
+	return s.t(adrs, s.skSeed)
+}
@@ -0,0 +1,72 @@
+package slhdsa
+
+// FORS few-time signatures of the message digest.
+
+// forsSecret returns the secret of the leaf idx of the FORS key pair of adrs.
+func (s *state) forsSecret(adrs *address, idx uint32) []byte {
+	sk := *adrs
+	sk.setTypeAndClear(addrFORSPRF)
+	sk.setKeyPair(adrs.keyPair())
+	sk.setTreeIndex(idx)
+	return s.prf(&sk)
+}
+
+// forsNode computes the node i at height z of the FORS trees,
+// which are indexed as if they were the subtrees of a single tree.
+func (s *state) forsNode(i uint32, z int, adrs *address) []byte {
+	if z == 0 {
+		sk := s.forsSecret(adrs, i)
+		adrs.setTreeHeight(0)
+		adrs.setTreeIndex(i)
+		return s.t(adrs, sk)
+	}
+	left := s.forsNode(2*i, z-1, adrs)
+	right := s.forsNode(2*i+1, z-1, adrs)
+	adrs.setTreeHeight(uint32(z))
+	adrs.setTreeIndex(i)
+	return s.t(adrs, left, right)
+}
+
+func (s *state) forsSign(md []byte, adrs *address) []byte {
+	p := s.p
+	var sig []byte
+	for i, idx := range base2b(md, p.a, p.k) {
+		tree := uint32(i)
+		sig = append(sig, s.forsSecret(adrs, tree<<p.a+idx)...)
+		for j := 0; j < p.a; j++ {
+			sibling := idx>>j ^ 1
+			sig = append(sig, s.forsNode(tree<<(p.a-j)+sibling, j, adrs)...)
+		}
+	}
+	return sig
+}
+
+// forsPKFromSig computes the FORS public key from a signature.
+func (s *state) forsPKFromSig(sig, md []byte, adrs *address) []byte {
+	p := s.p
+	n := p.n
+	roots := make([][]byte, p.k)
+	for i, idx := range base2b(md, p.a, p.k) {
+		tree := sig[i*(1+p.a)*n : (i+1)*(1+p.a)*n]
+		adrs.setTreeHeight(0)
+		adrs.setTreeIndex(uint32(i)<<p.a + idx)
+		node := s.t(adrs, tree[:n])
+		auth := tree[n:]
+		for j := 0; j < p.a; j++ {
+			adrs.setTreeHeight(uint32(j + 1))
+			sibling := auth[j*n : (j+1)*n]
+			if idx>>j&1 == 0 {
+				adrs.setTreeIndex(adrs.treeIndex() / 2)
+				node = s.t(adrs, node, sibling)
+			} else {
+				adrs.setTreeIndex((adrs.treeIndex() - 1) / 2)
+				node = s.t(adrs, sibling, node)
+			}
+		}
+		roots[i] = node
+	}
+	pk := *adrs
+	pk.setTypeAndClear(addrFORSRoots)
+	pk.setKeyPair(adrs.keyPair())
+	return s.t(&pk, roots...)
+}
@@ -0,0 +1,258 @@
+// Package slhdsa implements the stateless hash-based signature scheme
+// SLH-DSA of FIPS 205 with its SHAKE parameter sets. Its security only
+// rests on SHAKE256, so that signatures remain trustworthy for as long
+// as the hash function does.
+//
+// Keys and signatures use the encodings of FIPS 205: private keys are
+// SK.seed || SK.prf || PK.seed || PK.root and public keys are
+// PK.seed || PK.root. Sign and Verify are the pure variant of section
+// 10.2, with a context string.
+package slhdsa
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"io"
+)
+
+var (
+	// ErrInvalidKey indicates a key has the wrong size.
+	ErrInvalidKey = errors.New("[slhdsa] invalid key")
+	// ErrContextTooLong indicates the context exceeds 255 bytes.
+	ErrContextTooLong = errors.New("[slhdsa] context too long")
+)
+
+// Params is an SLH-DSA parameter set.
+type Params struct {
+	name string
+	// n is the security parameter in bytes.
+	n int
+	// h is the height of the hypertree, made of d layers of
+	// XMSS trees of height hp.
+	h, d, hp int
+	// FORS signs with k trees of height a.
+	a, k int
+	// m is the size of the message digest in bytes.
+	m int
+}
+
+// The parameter sets of FIPS 205 that use SHAKE.
+var (
+	SHAKE128s = &Params{name: "SLH-DSA-SHAKE-128s", n: 16, h: 63, d: 7, hp: 9, a: 12, k: 14, m: 30}
+	SHAKE128f = &Params{name: "SLH-DSA-SHAKE-128f", n: 16, h: 66, d: 22, hp: 3, a: 6, k: 33, m: 34}
+)
+
+const (
+	// lgw is the number of bits per WOTS+ chain, with chains of w = 16.
+	lgw = 4
+	w   = 1 << lgw
+	// len2 is the number of checksum chains of WOTS+, for every
+	// parameter set of FIPS 205.
+	len2 = 3
+)
+
+// String returns the name of the parameter set.
+func (p *Params) String() string {
+	return p.name
+}
+
+// PublicKeySize returns the size of public keys.
+func (p *Params) PublicKeySize() int {
+	return 2 * p.n
+}
+
+// PrivateKeySize returns the size of private keys.
+func (p *Params) PrivateKeySize() int {
+	return 4 * p.n
+}
+
+// SignatureSize returns the size of signatures.
+func (p *Params) SignatureSize() int {
+	return p.n * (1 + p.k*(1+p.a) + p.h + p.d*p.len())
+}
+
+// len returns the number of WOTS+ chains.
+func (p *Params) len() int {
+	return 2*p.n + len2
+}
+
+// GenerateKey creates a key pair using rnd for randomness.
+// If rnd is nil, crypto/rand is used.
+func (p *Params) GenerateKey(rnd io.Reader) (public, private []byte, err error) {
+	if rnd == nil {
+		rnd = rand.Reader
+	}
+	seeds := make([]byte, 3*p.n)
+	if _, err := io.ReadFull(rnd, seeds); err != nil {
+		return nil, nil, err
+	}
+	skSeed, skPRF, pkSeed := seeds[:p.n], seeds[p.n:2*p.n], seeds[2*p.n:]
+	s := p.newState(pkSeed, skSeed)
+	var adrs address
+	adrs.setLayer(uint32(p.d - 1))
+	root := s.xmssNode(0, p.hp, &adrs)
+	private = append(append(append(append(make([]byte, 0, 4*p.n), skSeed...), skPRF...), pkSeed...), root...)
+	return append([]byte{}, private[2*p.n:]...), private, nil
+}
+
+// Public returns the public key of private.
+func (p *Params) Public(private []byte) ([]byte, error) {
+	if len(private) != p.PrivateKeySize() {
+		return nil, ErrInvalidKey
+	}
+	return append([]byte{}, private[2*p.n:]...), nil
+}
+
+// Sign signs msg with private under the context ctx. Signing is
+// hedged with randomness from rnd. If rnd is nil, signing is
+// deterministic.
+func (p *Params) Sign(rnd io.Reader, private, msg, ctx []byte) ([]byte, error) {
+	if len(private) != p.PrivateKeySize() {
+		return nil, ErrInvalidKey
+	}
+	if len(ctx) > 255 {
+		return nil, ErrContextTooLong
+	}
+	skSeed, skPRF := private[:p.n], private[p.n:2*p.n]
+	pkSeed, pkRoot := private[2*p.n:3*p.n], private[3*p.n:]
+	// The deterministic variant uses PK.seed as randomness.
+	optRand := pkSeed
+	if rnd != nil {
+		optRand = make([]byte, p.n)
+		if _, err := io.ReadFull(rnd, optRand); err != nil {
+			return nil, err
+		}
+	}
+	m := encodeMessage(msg, ctx)
+
+	s := p.newState(pkSeed, skSeed)
+	r := s.shake(p.n, skPRF, optRand, m)
+	sig := make([]byte, 0, p.SignatureSize())
+	sig = append(sig, r...)
+	md, idxTree, idxLeaf := p.digest(s.shake(p.m, r, pkSeed, pkRoot, m))
+
+	var adrs address
+	adrs.setTree(idxTree)
+	adrs.setTypeAndClear(addrFORSTree)
+	adrs.setKeyPair(idxLeaf)
+	sigFORS := s.forsSign(md, &adrs)
+	sig = append(sig, sigFORS...)
+	pkFORS := s.forsPKFromSig(sigFORS, md, &adrs)
+	return append(sig, s.htSign(pkFORS, idxTree, idxLeaf)...), nil
+}
+
+// Verify reports whether sig is a valid signature of msg
+// under the context ctx by public.
+func (p *Params) Verify(public, msg, sig, ctx []byte) bool {
+	if len(public) != p.PublicKeySize() || len(sig) != p.SignatureSize() || len(ctx) > 255 {
+		return false
+	}
+	pkSeed, pkRoot := public[:p.n], public[p.n:]
+	m := encodeMessage(msg, ctx)
+
+	s := p.newState(pkSeed, nil)
+	r := sig[:p.n]
+	sigFORS := sig[p.n : p.n+p.k*(1+p.a)*p.n]
+	sigHT := sig[p.n+p.k*(1+p.a)*p.n:]
+	md, idxTree, idxLeaf := p.digest(s.shake(p.m, r, pkSeed, pkRoot, m))
+
+	var adrs address
+	adrs.setTree(idxTree)
+	adrs.setTypeAndClear(addrFORSTree)
+	adrs.setKeyPair(idxLeaf)
+	pkFORS := s.forsPKFromSig(sigFORS, md, &adrs)
+	return s.htVerify(pkFORS, sigHT, idxTree, idxLeaf, pkRoot)
+}
+
+// encodeMessage prefixes msg with its context, as in
+// the pure variant of FIPS 205.
+func encodeMessage(msg, ctx []byte) []byte {
+	m := make([]byte, 0, 2+len(ctx)+len(msg))
+	m = append(m, 0, byte(len(ctx)))
+	m = append(m, ctx...)
+	return append(m, msg...)
+}
+
+// digest splits the message digest into the FORS message and
+// the indices of the tree and leaf that sign it.
+func (p *Params) digest(digest []byte) (md []byte, idxTree uint64, idxLeaf uint32) {
+	mdSize := (p.k*p.a + 7) / 8
+	treeBits := p.h - p.hp
+	treeSize := (treeBits + 7) / 8
+	leafSize := (p.hp + 7) / 8
+	md = digest[:mdSize]
+	idxTree = toInt(digest[mdSize : mdSize+treeSize])
+	if treeBits < 64 {
+		idxTree &= 1<<treeBits - 1
+	}
+	idxLeaf = uint32(toInt(digest[mdSize+treeSize:mdSize+treeSize+leafSize])) & (1<<p.hp - 1)
+	return md, idxTree, idxLeaf
+}
+
+// toInt decodes a big-endian integer.
+func toInt(b []byte) uint64 {
+	var x uint64
+	for _, c := range b {
+		x = x<<8 | uint64(c)
+	}
+	return x
+}
+
+// base2b splits x into out integers of b bits each.
+func base2b(x []byte, b, out int) []uint32 {
+	var (
+		in, bits int
+		total    uint32
+	)
+	baseb := make([]uint32, out)
+	for i := range baseb {
+		for bits < b {
+			total = total<<8 | uint32(x[in])
+			in++
+			bits += 8
+		}
+		bits -= b
+		baseb[i] = (total >> bits) & (1<<b - 1)
+	}
+	return baseb
+}
+
+// htSign signs msg with the hypertree.
+func (s *state) htSign(msg []byte, idxTree uint64, idxLeaf uint32) []byte {
+	p := s.p
+	var adrs address
+	adrs.setTree(idxTree)
+	sig := s.xmssSign(msg, idxLeaf, &adrs)
+	sigHT := sig
+	root := s.xmssPKFromSig(idxLeaf, sig, msg, &adrs)
+	for j := 1; j < p.d; j++ {
+		idxLeaf = uint32(idxTree & (1<<p.hp - 1))
+		idxTree >>= p.hp
+		adrs.setLayer(uint32(j))
+		adrs.setTree(idxTree)
+		sig = s.xmssSign(root, idxLeaf, &adrs)
+		sigHT = append(sigHT, sig...)
+		if j < p.d-1 {
+			root = s.xmssPKFromSig(idxLeaf, sig, root, &adrs)
+		}
+	}
+	return sigHT
+}
+
+// htVerify verifies the hypertree signature sig of msg.
+func (s *state) htVerify(msg, sig []byte, idxTree uint64, idxLeaf uint32, pkRoot []byte) bool {
+	p := s.p
+	size := (p.hp + p.len()) * p.n
+	var adrs address
+	adrs.setTree(idxTree)
+	node := s.xmssPKFromSig(idxLeaf, sig[:size], msg, &adrs)
+	for j := 1; j < p.d; j++ {
+		idxLeaf = uint32(idxTree & (1<<p.hp - 1))
+		idxTree >>= p.hp
+		adrs.setLayer(uint32(j))
+		adrs.setTree(idxTree)
+		node = s.xmssPKFromSig(idxLeaf, sig[j*size:(j+1)*size], node, &adrs)
+	}
+	return subtle.ConstantTimeCompare(node, pkRoot) == 1
+}
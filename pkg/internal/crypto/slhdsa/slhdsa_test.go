@@ -0,0 +1,119 @@
+package slhdsa
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
+)
+
+func TestSizes(t *testing.T) {
+	t.Parallel()
+
+	// Sizes of table 2 of FIPS 205.
+	for _, tt := range []struct {
+		p   *Params
+		sig int
+	}{
+		{SHAKE128s, 7856},
+		{SHAKE128f, 17088},
+	} {
+		if got := tt.p.SignatureSize(); got != tt.sig {
+			t.Errorf("%v: signature size %d, want %d", tt.p, got, tt.sig)
+		}
+		if tt.p.PublicKeySize() != 32 || tt.p.PrivateKeySize() != 64 {
+			t.Errorf("%v: unexpected key sizes", tt.p)
+		}
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	t.Parallel()
+
+	for _, p := range []*Params{SHAKE128s, SHAKE128f} {
+		p := p
+		t.Run(p.String(), func(t *testing.T) {
+			t.Parallel()
+			pk, sk, err := p.GenerateKey(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := p.Public(sk); err != nil || !bytes.Equal(got, pk) {
+				t.Fatalf("unexpected public key: %x, %v", got, err)
+			}
+			msg, ctx := []byte("message"), []byte("context")
+			sig, err := p.Sign(nil, sk, msg, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sig) != p.SignatureSize() {
+				t.Fatalf("signature size %d", len(sig))
+			}
+			if !p.Verify(pk, msg, sig, ctx) {
+				t.Fatal("signature does not verify")
+			}
+			if p.Verify(pk, []byte("other"), sig, ctx) {
+				t.Error("verifies another message")
+			}
+			if p.Verify(pk, msg, sig, []byte("other")) {
+				t.Error("verifies another context")
+			}
+			for _, i := range []int{0, 16, len(sig) / 2, len(sig) - 1} {
+				bad := append([]byte{}, sig...)
+				bad[i] ^= 1
+				if p.Verify(pk, msg, bad, ctx) {
+					t.Errorf("verifies a signature altered at %d", i)
+				}
+			}
+			hedged, err := p.Sign(crypto.NewPRFReader([]byte("seed"), "rnd"), sk, msg, ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(hedged, sig) || !p.Verify(pk, msg, hedged, ctx) {
+				t.Fatal("unexpected hedged signature")
+			}
+		})
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	t.Parallel()
+
+	// The key and signature are deterministic functions of the seeds,
+	// so their hashes catch changes to the encoding.
+	p := SHAKE128f
+	seeds := make([]byte, 3*p.n)
+	for i := range seeds {
+		seeds[i] = byte(i)
+	}
+	pk, sk, err := p.GenerateKey(bytes.NewReader(seeds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := p.Sign(nil, sk, []byte("message"), []byte("context"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(pk), "202122232425262728292a2b2c2d2e2fa90e4715b9a925c332801767fd786371"; got != want {
+		t.Errorf("public key %s, want %s", got, want)
+	}
+	if got, want := hex.EncodeToString(crypto.SHAKE128.Digest(sig)), "ce6bed03ffb68b9e17df786cc17da57b771f05a15daa900737f2d94142c1a3b3"; got != want {
+		t.Errorf("signature hash %s, want %s", got, want)
+	}
+}
+
+func TestInvalidInputs(t *testing.T) {
+	t.Parallel()
+
+	p := SHAKE128f
+	if _, err := p.Sign(nil, make([]byte, 10), nil, nil); err != ErrInvalidKey {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if _, err := p.Sign(nil, make([]byte, p.PrivateKeySize()), nil, make([]byte, 256)); err != ErrContextTooLong {
+		t.Errorf("unexpected err: %v", err)
+	}
+	if p.Verify(make([]byte, p.PublicKeySize()), nil, make([]byte, 10), nil) {
+		t.Error("verifies a short signature")
+	}
+}
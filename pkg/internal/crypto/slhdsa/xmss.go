@@ -0,0 +1,124 @@
+package slhdsa
+
+// WOTS+ one-time signatures and the XMSS trees built from them.
+
+// wotsMessage returns the chain lengths of msg, followed
+// by those of its checksum.
+func (s *state) wotsMessage(msg []byte) []uint32 {
+	p := s.p
+	lengths := base2b(msg, lgw, 2*p.n)
+	var csum uint32
+	for _, l := range lengths {
+		csum += w - 1 - l
+	}
+	// The checksum is left-aligned on 12 bits.
+	csum <<= 4
+	return append(lengths, base2b([]byte{byte(csum >> 8), byte(csum)}, lgw, len2)...)
+}
+
+// chain applies steps iterations of F to x, from iteration start.
+func (s *state) chain(x []byte, start, steps uint32, adrs *address) []byte {
+	for j := start; j < start+steps; j++ {
+		adrs.setHash(j)
+		x = s.t(adrs, x)
+	}
+	return x
+}
+
+// wotsSecret returns the secret of chain i of the key pair of adrs.
+func (s *state) wotsSecret(adrs *address, i uint32) []byte {
+	sk := *adrs
+	sk.setTypeAndClear(addrWOTSPRF)
+	sk.setKeyPair(adrs.keyPair())
+	sk.setChain(i)
+	return s.prf(&sk)
+}
+
+// wotsPK compresses the ends of the chains into a public key.
+func (s *state) wotsPK(adrs *address, ends [][]byte) []byte {
+	pk := *adrs
+	pk.setTypeAndClear(addrWOTSPK)
+	pk.setKeyPair(adrs.keyPair())
+	return s.t(&pk, ends...)
+}
+
+func (s *state) wotsPKGen(adrs *address) []byte {
+	ends := make([][]byte, s.p.len())
+	for i := range ends {
+		sk := s.wotsSecret(adrs, uint32(i))
+		adrs.setChain(uint32(i))
+		ends[i] = s.chain(sk, 0, w-1, adrs)
+	}
+	return s.wotsPK(adrs, ends)
+}
+
+func (s *state) wotsSign(msg []byte, adrs *address) []byte {
+	var sig []byte
+	for i, l := range s.wotsMessage(msg) {
+		sk := s.wotsSecret(adrs, uint32(i))
+		adrs.setChain(uint32(i))
+		sig = append(sig, s.chain(sk, 0, l, adrs)...)
+	}
+	return sig
+}
+
+func (s *state) wotsPKFromSig(sig, msg []byte, adrs *address) []byte {
+	n := s.p.n
+	lengths := s.wotsMessage(msg)
+	ends := make([][]byte, len(lengths))
+	for i, l := range lengths {
+		adrs.setChain(uint32(i))
+		ends[i] = s.chain(sig[i*n:(i+1)*n], l, w-1-l, adrs)
+	}
+	return s.wotsPK(adrs, ends)
+}
+
+// xmssNode computes the node i at height z of the XMSS tree of adrs.
+func (s *state) xmssNode(i uint32, z int, adrs *address) []byte {
+	if z == 0 {
+		adrs.setTypeAndClear(addrWOTSHash)
+		adrs.setKeyPair(i)
+		return s.wotsPKGen(adrs)
+	}
+	left := s.xmssNode(2*i, z-1, adrs)
+	right := s.xmssNode(2*i+1, z-1, adrs)
+	adrs.setTypeAndClear(addrTree)
+	adrs.setTreeHeight(uint32(z))
+	adrs.setTreeIndex(i)
+	return s.t(adrs, left, right)
+}
+
+// xmssSign signs msg with the leaf idx, followed by its authentication path.
+func (s *state) xmssSign(msg []byte, idx uint32, adrs *address) []byte {
+	var auth []byte
+	for j := 0; j < s.p.hp; j++ {
+		auth = append(auth, s.xmssNode(idx>>j^1, j, adrs)...)
+	}
+	adrs.setTypeAndClear(addrWOTSHash)
+	adrs.setKeyPair(idx)
+	return append(s.wotsSign(msg, adrs), auth...)
+}
+
+// xmssPKFromSig computes the root of the XMSS tree from a signature.
+func (s *state) xmssPKFromSig(idx uint32, sig, msg []byte, adrs *address) []byte {
+	n, wotsSize := s.p.n, s.p.len()*s.p.n
+	adrs.setTypeAndClear(addrWOTSHash)
+	adrs.setKeyPair(idx)
+	node := s.wotsPKFromSig(sig[:wotsSize], msg, adrs)
+	auth := sig[wotsSize:]
+
+	adrs.setTypeAndClear(addrTree)
+	adrs.setTreeIndex(idx)
+	for k := 0; k < s.p.hp; k++ {
+		adrs.setTreeHeight(uint32(k + 1))
+		sibling := auth[k*n : (k+1)*n]
+		if idx>>k&1 == 0 {
+			adrs.setTreeIndex(adrs.treeIndex() / 2)
+			node = s.t(adrs, node, sibling)
+		} else {
+			adrs.setTreeIndex((adrs.treeIndex() - 1) / 2)
+			node = s.t(adrs, sibling, node)
+		}
+	}
+	return node
+}
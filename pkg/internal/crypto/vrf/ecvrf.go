@@ -0,0 +1,254 @@
+package vrf
+
+// ECVRF-EDWARDS25519-SHA512-TAI and ECVRF-EDWARDS25519-SHA512-ELL2
+// from RFC 9381. Keys are Ed25519 keys: the 32-byte secret followed by
+// the public key, and the secret scalar is derived as in RFC 8032.
+//
+//	Prove_x(alpha) = (Gamma=x*H, c, s=k+c*x)
+//	    where H = encode_to_curve(Y, alpha)
+//	    and c = challenge(Y, H, Gamma, k*B, k*H)
+//	Verify(Y, alpha, (Gamma, c, s)) =
+//	    c == challenge(Y, H, Gamma, s*B-c*Y, s*H-c*Gamma)
+//	beta = SHA512(suite || 0x03 || 8*Gamma || 0x00)
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"io"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto/ed25519/edwards25519"
+	"golang.org/x/crypto/ed25519"
+)
+
+const (
+	// suite_string values of RFC 9381.
+	ecvrfSuiteTAI  = 0x03
+	ecvrfSuiteELL2 = 0x04
+
+	// ecvrfChallengeSize is cLen of RFC 9381.
+	ecvrfChallengeSize = 16
+	// ECVRFProofSize is the size of a proof: Gamma, c and s.
+	ECVRFProofSize = 32 + ecvrfChallengeSize + 32
+	// ECVRFSize is the size of the vrf value beta.
+	ECVRFSize = sha512.Size
+
+	// Domain separators of RFC 9381.
+	ecvrfEncodeToCurveFront = 0x01
+	ecvrfChallengeFront     = 0x02
+	ecvrfProofToHashFront   = 0x03
+	ecvrfBack               = 0x00
+)
+
+func ecvrfGenerateKey(rnd io.Reader) (PrivateKey, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := io.ReadFull(rnd, seed); err != nil {
+		return nil, err
+	}
+	return PrivateKey(ed25519.NewKeyFromSeed(seed)), nil
+}
+
+// ecvrfExpandSecret returns the secret scalar x and the
+// nonce prefix, as in RFC 8032.
+func ecvrfExpandSecret(sk PrivateKey) (x, prefix *[32]byte) {
+	h := sha512.Sum512(sk[:32])
+	x, prefix = new([32]byte), new([32]byte)
+	copy(x[:], h[:32])
+	copy(prefix[:], h[32:])
+	x[0] &= 248
+	x[31] &= 127
+	x[31] |= 64
+	return
+}
+
+// ecvrfDecodePoint decodes a point, rejecting non-canonical encodings.
+func ecvrfDecodePoint(p *edwards25519.ExtendedGroupElement, s []byte) bool {
+	if len(s) != 32 {
+		return false
+	}
+	var b, check [32]byte
+	copy(b[:], s)
+	if !p.FromBytes(&b) {
+		return false
+	}
+	p.ToBytes(&check)
+	return check == b
+}
+
+func ecvrfClearCofactor(p *edwards25519.ExtendedGroupElement) {
+	edwards25519.GeDouble(p, p)
+	edwards25519.GeDouble(p, p)
+	edwards25519.GeDouble(p, p)
+}
+
+func ecvrfNeg(p *edwards25519.ExtendedGroupElement) {
+	edwards25519.FeNeg(&p.X, &p.X)
+	edwards25519.FeNeg(&p.T, &p.T)
+}
+
+// ecvrfEncodeToCurve maps alpha to a point, salted with the public key.
+func ecvrfEncodeToCurve(suite byte, pk, alpha []byte) (*edwards25519.ExtendedGroupElement, bool) {
+	if suite == ecvrfSuiteELL2 {
+		return ell2EncodeToCurve(suite, pk, alpha), true
+	}
+	// Try-and-increment. It is not constant time.
+	for ctr := 0; ctr < 256; ctr++ {
+		h := sha512.New()
+		h.Write([]byte{suite, ecvrfEncodeToCurveFront})
+		h.Write(pk)
+		h.Write(alpha)
+		h.Write([]byte{byte(ctr), ecvrfBack})
+		var p edwards25519.ExtendedGroupElement
+		if ecvrfDecodePoint(&p, h.Sum(nil)[:32]) {
+			ecvrfClearCofactor(&p)
+			return &p, true
+		}
+	}
+	return nil, false
+}
+
+// ecvrfNonce derives the nonce k as in RFC 8032.
+func ecvrfNonce(prefix, hB *[32]byte) *[32]byte {
+	h := sha512.New()
+	h.Write(prefix[:])
+	h.Write(hB[:])
+	var digest [64]byte
+	h.Sum(digest[:0])
+	var k [32]byte
+	edwards25519.ScReduce(&k, &digest)
+	return &k
+}
+
+// ecvrfChallenge returns c, zero-padded to a scalar.
+func ecvrfChallenge(suite byte, points ...[]byte) *[32]byte {
+	h := sha512.New()
+	h.Write([]byte{suite, ecvrfChallengeFront})
+	for _, p := range points {
+		h.Write(p)
+	}
+	h.Write([]byte{ecvrfBack})
+	var c [32]byte
+	copy(c[:ecvrfChallengeSize], h.Sum(nil))
+	return &c
+}
+
+func ecvrfProofToHash(suite byte, gamma *edwards25519.ExtendedGroupElement) []byte {
+	var p edwards25519.ExtendedGroupElement
+	edwards25519.ExtendedGroupElementCopy(&p, gamma)
+	ecvrfClearCofactor(&p)
+	var pB [32]byte
+	p.ToBytes(&pB)
+	h := sha512.New()
+	h.Write([]byte{suite, ecvrfProofToHashFront})
+	h.Write(pB[:])
+	h.Write([]byte{ecvrfBack})
+	return h.Sum(nil)
+}
+
+func ecvrfCompute(suite byte, sk PrivateKey, alpha []byte) []byte {
+	if len(sk) != PrivateKeySize {
+		return nil
+	}
+	x, _ := ecvrfExpandSecret(sk)
+	h, ok := ecvrfEncodeToCurve(suite, sk[32:], alpha)
+	if !ok {
+		return nil
+	}
+	var gamma edwards25519.ExtendedGroupElement
+	edwards25519.GeScalarMult(&gamma, x, h)
+	return ecvrfProofToHash(suite, &gamma)
+}
+
+func ecvrfProve(suite byte, sk PrivateKey, alpha []byte) (vrf, proof []byte) {
+	if len(sk) != PrivateKeySize {
+		return nil, nil
+	}
+	pk := sk[32:]
+	x, prefix := ecvrfExpandSecret(sk)
+	h, ok := ecvrfEncodeToCurve(suite, pk, alpha)
+	if !ok {
+		return nil, nil
+	}
+	var gamma, u, v edwards25519.ExtendedGroupElement
+	var hB, gammaB, uB, vB, s [32]byte
+	h.ToBytes(&hB)
+	edwards25519.GeScalarMult(&gamma, x, h)
+	gamma.ToBytes(&gammaB)
+
+	k := ecvrfNonce(prefix, &hB)
+	edwards25519.GeScalarMultBase(&u, k)
+	edwards25519.GeScalarMult(&v, k, h)
+	u.ToBytes(&uB)
+	v.ToBytes(&vB)
+	c := ecvrfChallenge(suite, pk, hB[:], gammaB[:], uB[:], vB[:])
+	edwards25519.ScMulAdd(&s, c, x, k)
+
+	proof = make([]byte, 0, ECVRFProofSize)
+	proof = append(proof, gammaB[:]...)
+	proof = append(proof, c[:ecvrfChallengeSize]...)
+	proof = append(proof, s[:]...)
+	return ecvrfProofToHash(suite, &gamma), proof
+}
+
+// ecvrfScalarReduced returns true if s < l.
+func ecvrfScalarReduced(s *[32]byte) bool {
+	for i := 31; i >= 0; i-- {
+		if s[i] != edwards25519.BasePointOrder[i] {
+			return s[i] < edwards25519.BasePointOrder[i]
+		}
+	}
+	return false
+}
+
+func ecvrfVerify(suite byte, pk PublicKey, alpha, vrf, proof []byte) bool {
+	if len(pk) != PublicKeySize || len(proof) != ECVRFProofSize || len(vrf) != ECVRFSize {
+		return false
+	}
+	var y, gamma edwards25519.ExtendedGroupElement
+	if !ecvrfDecodePoint(&y, pk) {
+		return false
+	}
+	// Reject keys of small order.
+	var y8 edwards25519.ExtendedGroupElement
+	var y8B [32]byte
+	edwards25519.ExtendedGroupElementCopy(&y8, &y)
+	ecvrfClearCofactor(&y8)
+	if y8.ToBytes(&y8B); y8B == [32]byte{1} {
+		return false
+	}
+	if !ecvrfDecodePoint(&gamma, proof[:32]) {
+		return false
+	}
+	var c, s [32]byte
+	copy(c[:ecvrfChallengeSize], proof[32:32+ecvrfChallengeSize])
+	copy(s[:], proof[32+ecvrfChallengeSize:])
+	if !ecvrfScalarReduced(&s) {
+		return false
+	}
+	h, ok := ecvrfEncodeToCurve(suite, pk, alpha)
+	if !ok {
+		return false
+	}
+
+	// U = s*B - c*Y
+	var u, cy edwards25519.ExtendedGroupElement
+	edwards25519.GeScalarMultBase(&u, &s)
+	edwards25519.GeScalarMult(&cy, &c, &y)
+	ecvrfNeg(&cy)
+	edwards25519.GeAdd(&u, &u, &cy)
+	// V = s*H - c*Gamma
+	var v, cg edwards25519.ExtendedGroupElement
+	edwards25519.GeScalarMult(&v, &s, h)
+	edwards25519.GeScalarMult(&cg, &c, &gamma)
+	ecvrfNeg(&cg)
+	edwards25519.GeAdd(&v, &v, &cg)
+
+	var hB, uB, vB [32]byte
+	h.ToBytes(&hB)
+	u.ToBytes(&uB)
+	v.ToBytes(&vB)
+	cCheck := ecvrfChallenge(suite, pk, hB[:], proof[:32], uB[:], vB[:])
+	if subtle.ConstantTimeCompare(cCheck[:], c[:]) != 1 {
+		return false
+	}
+	return subtle.ConstantTimeCompare(ecvrfProofToHash(suite, &gamma), vrf) == 1
+}
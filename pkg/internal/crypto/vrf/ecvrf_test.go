@@ -0,0 +1,221 @@
+package vrf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// RFC 9381 test vectors for ECVRF-EDWARDS25519-SHA512-TAI
+// (Appendix B.3, examples 16 to 18) and -ELL2 (Appendix B.4,
+// examples 19 to 21). The keys are those of RFC 8032.
+var ecvrfVectors = []struct {
+	suite Suite
+	sk    string
+	pk    string
+	alpha string
+	pi    string
+	beta  string
+}{
+	{
+		suite: EdwardsTAI,
+		sk:    "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60",
+		pk:    "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+		alpha: "",
+		pi:    "8657106690b5526245a92b003bb079ccd1a92130477671f6fc01ad16f26f723f26f8a57ccaed74ee1b190bed1f479d9727d2d0f9b005a6e456a35d4fb0daab1268a1b0db10836d9826a528ca76567805",
+		beta:  "90cf1df3b703cce59e2a35b925d411164068269d7b2d29f3301c03dd757876ff66b71dda49d2de59d03450451af026798e8f81cd2e333de5cdf4f3e140fdd8ae",
+	},
+	{
+		suite: EdwardsTAI,
+		sk:    "4ccd089b28ff96da9db6c346ec114e0f5b8a319f35aba624da8cf6ed4fb8a6fb",
+		pk:    "3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c",
+		alpha: "72",
+		pi:    "f3141cd382dc42909d19ec5110469e4feae18300e94f304590abdced48aed5933bf0864a62558b3ed7f2fea45c92a465301b3bbf5e3e54ddf2d935be3b67926da3ef39226bbc355bdc9850112c8f4b02",
+		beta:  "eb4440665d3891d668e7e0fcaf587f1b4bd7fbfe99d0eb2211ccec90496310eb5e33821bc613efb94db5e5b54c70a848a0bef4553a41befc57663b56373a5031",
+	},
+	{
+		suite: EdwardsTAI,
+		sk:    "c5aa8df43f9f837bedb7442f31dcb7b166d38535076f094b85ce3a2e0b4458f7",
+		pk:    "fc51cd8e6218a1a38da47ed00230f0580816ed13ba3303ac5deb911548908025",
+		alpha: "af82",
+		pi:    "9bc0f79119cc5604bf02d23b4caede71393cedfbb191434dd016d30177ccbf8096bb474e53895c362d8628ee9f9ea3c0e52c7a5c691b6c18c9979866568add7a2d41b00b05081ed0f58ee5e31b3a970e",
+		beta:  "645427e5d00c62a23fb703732fa5d892940935942101e456ecca7bb217c61c452118fec1219202a0edcf038bb6373241578be7217ba85a2687f7a0310b2df19f",
+	},
+	{
+		suite: EdwardsELL2,
+		sk:    "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60",
+		pk:    "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+		alpha: "",
+		pi:    "7d9c633ffeee27349264cf5c667579fc583b4bda63ab71d001f89c10003ab46f14adf9a3cd8b8412d9038531e865c341cafa73589b023d14311c331a9ad15ff2fb37831e00f0acaa6d73bc9997b06501",
+		beta:  "9d574bf9b8302ec0fc1e21c3ec5368269527b87b462ce36dab2d14ccf80c53cccf6758f058c5b1c856b116388152bbe509ee3b9ecfe63d93c3b4346c1fbc6c54",
+	},
+	{
+		suite: EdwardsELL2,
+		sk:    "4ccd089b28ff96da9db6c346ec114e0f5b8a319f35aba624da8cf6ed4fb8a6fb",
+		pk:    "3d4017c3e843895a92b70aa74d1b7ebc9c982ccf2ec4968cc0cd55f12af4660c",
+		alpha: "72",
+		pi:    "47b327393ff2dd81336f8a2ef10339112401253b3c714eeda879f12c509072ef055b48372bb82efbdce8e10c8cb9a2f9d60e93908f93df1623ad78a86a028d6bc064dbfc75a6a57379ef855dc6733801",
+		beta:  "38561d6b77b71d30eb97a062168ae12b667ce5c28caccdf76bc88e093e4635987cd96814ce55b4689b3dd2947f80e59aac7b7675f8083865b46c89b2ce9cc735",
+	},
+	{
+		suite: EdwardsELL2,
+		sk:    "c5aa8df43f9f837bedb7442f31dcb7b166d38535076f094b85ce3a2e0b4458f7",
+		pk:    "fc51cd8e6218a1a38da47ed00230f0580816ed13ba3303ac5deb911548908025",
+		alpha: "af82",
+		pi:    "926e895d308f5e328e7aa159c06eddbe56d06846abf5d98c2512235eaa57fdce35b46edfc655bc828d44ad09d1150f31374e7ef73027e14760d42e77341fe05467bb286cc2c9d7fde29120a0b2320d04",
+		beta:  "121b7f9b9aaaa29099fc04a94ba52784d44eac976dd1a3cca458733be5cd090a7b5fbd148444f17f8daf1fb55cb04b1ae85a626e30a54b4b0f8abf4a43314a58",
+	},
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestECVRFVectors(t *testing.T) {
+	for _, v := range ecvrfVectors {
+		sk, err := v.suite.GenerateKey(bytes.NewReader(mustDecodeHex(t, v.sk)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pk, err := v.suite.Public(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pk, mustDecodeHex(t, v.pk)) {
+			t.Fatalf("%v: pk %x, want %s", v.suite, pk, v.pk)
+		}
+		alpha := mustDecodeHex(t, v.alpha)
+		beta, pi := v.suite.Prove(sk, alpha)
+		if !bytes.Equal(pi, mustDecodeHex(t, v.pi)) {
+			t.Fatalf("%v: pi %x, want %s", v.suite, pi, v.pi)
+		}
+		if !bytes.Equal(beta, mustDecodeHex(t, v.beta)) {
+			t.Fatalf("%v: beta %x, want %s", v.suite, beta, v.beta)
+		}
+		if !bytes.Equal(v.suite.Compute(sk, alpha), beta) {
+			t.Fatalf("%v: Compute != Prove", v.suite)
+		}
+		if !v.suite.Verify(pk, alpha, beta, pi) {
+			t.Fatalf("%v: valid proof rejected", v.suite)
+		}
+	}
+}
+
+func TestECVRFEncodeToCurve(t *testing.T) {
+	// RFC 9380 Appendix J.5.2, edwards25519_XMD:SHA-512_ELL2_NU_.
+	dst := []byte("QUUX-V01-CS02-with-edwards25519_XMD:SHA-512_ELL2_NU_")
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{
+			msg:  "",
+			want: "9b0f7f682dabce2190b14e21a175f39eb6a6b29fff2a9f5e72d5a4044d312e22",
+		},
+		{
+			msg:  "abc",
+			want: "42fa27c8f5a1ae0aa38bb59d5938e5145622ba5dedd11d11736fa2f9502d7367",
+		},
+	}
+	for _, tt := range tests {
+		var got [32]byte
+		ell2EncodeToCurveDST([]byte(tt.msg), dst).ToBytes(&got)
+		if hex.EncodeToString(got[:]) != tt.want {
+			t.Fatalf("%q: got %x, want %s", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestECVRFForgery(t *testing.T) {
+	alice := []byte("alice")
+	for _, suite := range []Suite{EdwardsTAI, EdwardsELL2, P256TAI} {
+		sk, err := suite.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pk, err := suite.Public(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vrf, proof := suite.Prove(sk, alice)
+		if !suite.Verify(pk, alice, vrf, proof) {
+			t.Fatalf("%v: Gen -> Prove -> Verify -> FALSE", suite)
+		}
+		if suite.Verify(pk, []byte("bob"), vrf, proof) {
+			t.Fatalf("%v: verified for another message", suite)
+		}
+		for i := range proof {
+			proof[i] ^= 1
+			if suite.Verify(pk, alice, vrf, proof) {
+				t.Fatalf("%v: forged by flipping proof[%d]", suite, i)
+			}
+			proof[i] ^= 1
+		}
+		for i := range vrf {
+			vrf[i] ^= 1
+			if suite.Verify(pk, alice, vrf, proof) {
+				t.Fatalf("%v: forged by flipping vrf[%d]", suite, i)
+			}
+			vrf[i] ^= 1
+		}
+		// s must be reduced.
+		forged := append([]byte{}, proof...)
+		for i := len(forged) - 32; i < len(forged); i++ {
+			forged[i] = 0xff
+		}
+		if suite.Verify(pk, alice, vrf, forged) {
+			t.Fatalf("%v: accepted unreduced s", suite)
+		}
+		if suite == P256TAI {
+			continue
+		}
+		// Small order keys are rejected.
+		identity := make([]byte, PublicKeySize)
+		identity[0] = 1
+		if suite.Verify(identity, alice, vrf, proof) {
+			t.Fatalf("%v: accepted identity key", suite)
+		}
+	}
+}
+
+func TestECVRFCrossSuite(t *testing.T) {
+	alice := []byte("alice")
+	for _, s := range Suites() {
+		sk, err := s.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pk, err := s.Public(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vrf, proof := s.Prove(sk, alice)
+		for _, other := range Suites() {
+			if other == s {
+				continue
+			}
+			if other.Verify(pk, alice, vrf, proof) {
+				t.Fatalf("%v proof verified as %v", s, other)
+			}
+		}
+	}
+}
+
+func TestParseSuite(t *testing.T) {
+	for _, s := range Suites() {
+		got, err := ParseSuite(s.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != s {
+			t.Fatalf("got %v, want %v", got, s)
+		}
+	}
+	if _, err := ParseSuite("ECVRF-UNKNOWN"); err == nil {
+		t.Fatal("expected error")
+	}
+}
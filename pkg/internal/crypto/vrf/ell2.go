@@ -0,0 +1,131 @@
+package vrf
+
+// encode_to_curve for edwards25519_XMD:SHA-512_ELL2_NU_ from RFC 9380,
+// as used by ECVRF-EDWARDS25519-SHA512-ELL2. The field arithmetic uses
+// math/big and is not constant time.
+
+import (
+	"crypto/sha512"
+	"math/big"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto/ed25519/edwards25519"
+)
+
+const (
+	ell2SuiteID = "edwards25519_XMD:SHA-512_ELL2_NU_"
+	// ell2FieldSize is L of hash_to_field: ceil((255 + 128) / 8).
+	ell2FieldSize = 48
+)
+
+var (
+	ell2P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	ell2J = big.NewInt(486662)
+	// ell2C1 is sqrt(-486664) with sgn0 == 0.
+	ell2C1 = func() *big.Int {
+		c := new(big.Int).ModSqrt(new(big.Int).Sub(ell2P, big.NewInt(486664)), ell2P)
+		if c.Bit(0) == 1 {
+			c.Sub(ell2P, c)
+		}
+		return c
+	}()
+)
+
+// ell2ExpandMessageXMD is expand_message_xmd with SHA-512.
+// n and dst must be shorter than 256 bytes.
+func ell2ExpandMessageXMD(msg, dst []byte, n int) []byte {
+	dstPrime := append(append([]byte{}, dst...), byte(len(dst)))
+	h := sha512.New()
+	h.Write(make([]byte, h.BlockSize()))
+	h.Write(msg)
+	h.Write([]byte{byte(n >> 8), byte(n), 0})
+	h.Write(dstPrime)
+	b0 := h.Sum(nil)
+
+	h.Reset()
+	h.Write(b0)
+	h.Write([]byte{1})
+	h.Write(dstPrime)
+	bi := h.Sum(nil)
+	out := append([]byte{}, bi...)
+	for i := 2; len(out) < n; i++ {
+		x := make([]byte, len(b0))
+		for j := range x {
+			x[j] = b0[j] ^ bi[j]
+		}
+		h.Reset()
+		h.Write(x)
+		h.Write([]byte{byte(i)})
+		h.Write(dstPrime)
+		bi = h.Sum(nil)
+		out = append(out, bi...)
+	}
+	return out[:n]
+}
+
+// ell2Map is map_to_curve_elligator2_edwards25519: Elligator 2 onto
+// curve25519, followed by the rational map to edwards25519.
+func ell2Map(u *big.Int) (x, y *big.Int) {
+	p := ell2P
+	mod := func(v *big.Int) *big.Int { return v.Mod(v, p) }
+	// x1 = -J / (1 + 2u^2). The denominator is never zero.
+	tv := mod(new(big.Int).Mul(u, u))
+	tv = mod(tv.Lsh(tv, 1))
+	den := mod(tv.Add(tv, big.NewInt(1)))
+	s := mod(new(big.Int).Mul(new(big.Int).Neg(ell2J), new(big.Int).ModInverse(den, p)))
+	g := func(s *big.Int) *big.Int {
+		// s^3 + J*s^2 + s
+		s2 := mod(new(big.Int).Mul(s, s))
+		g := mod(new(big.Int).Mul(s2, s))
+		g.Add(g, new(big.Int).Mul(ell2J, s2))
+		return mod(g.Add(g, s))
+	}
+	t := new(big.Int).ModSqrt(g(s), p)
+	if t != nil {
+		// sgn0(t) == 1.
+		if t.Bit(0) == 0 {
+			mod(t.Sub(p, t))
+		}
+	} else {
+		// x2 = -x1 - J, and sgn0(t) == 0.
+		s = mod(s.Neg(s.Add(s, ell2J)))
+		t = new(big.Int).ModSqrt(g(s), p)
+		if t.Bit(0) == 1 {
+			t.Sub(p, t)
+		}
+	}
+	// x = c1 * s / t, y = (s - 1) / (s + 1).
+	sPlus1 := mod(new(big.Int).Add(s, big.NewInt(1)))
+	if t.Sign() == 0 || sPlus1.Sign() == 0 {
+		return big.NewInt(0), big.NewInt(1)
+	}
+	x = mod(new(big.Int).Mul(ell2C1, s))
+	x = mod(x.Mul(x, new(big.Int).ModInverse(t, p)))
+	y = mod(new(big.Int).Sub(s, big.NewInt(1)))
+	y = mod(y.Mul(y, new(big.Int).ModInverse(sPlus1, p)))
+	return x, y
+}
+
+func ell2EncodeToCurve(suite byte, pk, alpha []byte) *edwards25519.ExtendedGroupElement {
+	dst := append([]byte("ECVRF_"+ell2SuiteID), suite)
+	return ell2EncodeToCurveDST(append(append([]byte{}, pk...), alpha...), dst)
+}
+
+func ell2EncodeToCurveDST(msg, dst []byte) *edwards25519.ExtendedGroupElement {
+	u := new(big.Int).SetBytes(ell2ExpandMessageXMD(msg, dst, ell2FieldSize))
+	x, y := ell2Map(u.Mod(u, ell2P))
+
+	// Encode as in RFC 8032: little-endian y, and the sign of x.
+	var b [32]byte
+	y.FillBytes(b[:])
+	for i := 0; i < 16; i++ {
+		b[i], b[31-i] = b[31-i], b[i]
+	}
+	b[31] |= byte(x.Bit(0)) << 7
+	var q edwards25519.ExtendedGroupElement
+	if !q.FromBytes(&b) {
+		// The map always returns a point of the curve.
+		panic("[vrf] invalid elligator2 point")
+	}
+	ecvrfClearCofactor(&q)
+	return &q
+}
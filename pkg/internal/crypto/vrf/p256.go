@@ -0,0 +1,231 @@
+package vrf
+
+// ECVRF-P256-SHA256-TAI from RFC 9381, for deployments that require
+// NIST curves. Keys are the 32-byte big-endian secret scalar followed
+// by the compressed public key. Integers are big-endian, and the nonce
+// is derived as in RFC 6979.
+
+import (
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"io"
+	"math/big"
+)
+
+const (
+	// p256SuiteTAI is the suite_string of RFC 9381.
+	p256SuiteTAI = 0x01
+
+	p256ScalarSize = 32
+	p256PointSize  = 33
+	// P256PrivateKeySize is the size of a P-256 private key.
+	P256PrivateKeySize = p256ScalarSize + p256PointSize
+	// P256PublicKeySize is the size of a P-256 public key.
+	P256PublicKeySize = p256PointSize
+	// P256ProofSize is the size of a proof: Gamma, c and s.
+	P256ProofSize = p256PointSize + ecvrfChallengeSize + p256ScalarSize
+	// P256Size is the size of the vrf value beta.
+	P256Size = sha256.Size
+)
+
+type p256Point struct {
+	x, y *big.Int
+}
+
+func p256Encode(p p256Point) []byte {
+	return elliptic.MarshalCompressed(elliptic.P256(), p.x, p.y)
+}
+
+func p256Decode(b []byte) (p256Point, bool) {
+	if len(b) != p256PointSize {
+		return p256Point{}, false
+	}
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), b)
+	return p256Point{x, y}, x != nil
+}
+
+func p256ScalarMult(p p256Point, k []byte) p256Point {
+	x, y := elliptic.P256().ScalarMult(p.x, p.y, k)
+	return p256Point{x, y}
+}
+
+func p256ScalarBaseMult(k []byte) p256Point {
+	x, y := elliptic.P256().ScalarBaseMult(k)
+	return p256Point{x, y}
+}
+
+func p256Add(p, q p256Point) p256Point {
+	x, y := elliptic.P256().Add(p.x, p.y, q.x, q.y)
+	return p256Point{x, y}
+}
+
+func p256Neg(p p256Point) p256Point {
+	if p.y.Sign() == 0 {
+		return p
+	}
+	return p256Point{p.x, new(big.Int).Sub(elliptic.P256().Params().P, p.y)}
+}
+
+func p256ScalarBytes(k *big.Int) []byte {
+	return k.FillBytes(make([]byte, p256ScalarSize))
+}
+
+func p256GenerateKey(rnd io.Reader) (PrivateKey, error) {
+	n := elliptic.P256().Params().N
+	b := make([]byte, p256ScalarSize)
+	for {
+		if _, err := io.ReadFull(rnd, b); err != nil {
+			return nil, err
+		}
+		if x := new(big.Int).SetBytes(b); x.Sign() > 0 && x.Cmp(n) < 0 {
+			break
+		}
+	}
+	return PrivateKey(append(b, p256Encode(p256ScalarBaseMult(b))...)), nil
+}
+
+// p256EncodeToCurve maps alpha to a point with try-and-increment,
+// salted with the public key. It is not constant time.
+func p256EncodeToCurve(pk, alpha []byte) (p256Point, bool) {
+	for ctr := 0; ctr < 256; ctr++ {
+		h := sha256.New()
+		h.Write([]byte{p256SuiteTAI, ecvrfEncodeToCurveFront})
+		h.Write(pk)
+		h.Write(alpha)
+		h.Write([]byte{byte(ctr), ecvrfBack})
+		if p, ok := p256Decode(h.Sum([]byte{0x02})); ok {
+			return p, true
+		}
+	}
+	return p256Point{}, false
+}
+
+// p256Nonce derives the nonce k from x and the
+// encoding of H as in RFC 6979, section 3.2.
+func p256Nonce(x, hB []byte) []byte {
+	n := elliptic.P256().Params().N
+	h1 := sha256.Sum256(hB)
+	h1Int := new(big.Int).SetBytes(h1[:])
+	h1Octets := p256ScalarBytes(h1Int.Mod(h1Int, n))
+	mac := func(key []byte, data ...[]byte) []byte {
+		m := hmac.New(sha256.New, key)
+		for _, d := range data {
+			m.Write(d)
+		}
+		return m.Sum(nil)
+	}
+	v := make([]byte, sha256.Size)
+	for i := range v {
+		v[i] = 0x01
+	}
+	k := make([]byte, sha256.Size)
+	k = mac(k, v, []byte{0x00}, x, h1Octets)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, x, h1Octets)
+	v = mac(k, v)
+	for {
+		v = mac(k, v)
+		if t := new(big.Int).SetBytes(v); t.Sign() > 0 && t.Cmp(n) < 0 {
+			return v
+		}
+		k = mac(k, v, []byte{0x00})
+		v = mac(k, v)
+	}
+}
+
+func p256Challenge(points ...[]byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{p256SuiteTAI, ecvrfChallengeFront})
+	for _, p := range points {
+		h.Write(p)
+	}
+	h.Write([]byte{ecvrfBack})
+	return h.Sum(nil)[:ecvrfChallengeSize]
+}
+
+// p256ProofToHash returns beta. The cofactor of P-256 is 1.
+func p256ProofToHash(gammaB []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{p256SuiteTAI, ecvrfProofToHashFront})
+	h.Write(gammaB)
+	h.Write([]byte{ecvrfBack})
+	return h.Sum(nil)
+}
+
+func p256Compute(sk PrivateKey, alpha []byte) []byte {
+	if len(sk) != P256PrivateKeySize {
+		return nil
+	}
+	h, ok := p256EncodeToCurve(sk[p256ScalarSize:], alpha)
+	if !ok {
+		return nil
+	}
+	return p256ProofToHash(p256Encode(p256ScalarMult(h, sk[:p256ScalarSize])))
+}
+
+func p256Prove(sk PrivateKey, alpha []byte) (vrf, proof []byte) {
+	if len(sk) != P256PrivateKeySize {
+		return nil, nil
+	}
+	x, pk := sk[:p256ScalarSize], sk[p256ScalarSize:]
+	h, ok := p256EncodeToCurve(pk, alpha)
+	if !ok {
+		return nil, nil
+	}
+	hB := p256Encode(h)
+	gammaB := p256Encode(p256ScalarMult(h, x))
+	k := p256Nonce(x, hB)
+	uB := p256Encode(p256ScalarBaseMult(k))
+	vB := p256Encode(p256ScalarMult(h, k))
+	c := p256Challenge(pk, hB, gammaB, uB, vB)
+
+	// s = k + c*x mod n
+	n := elliptic.P256().Params().N
+	s := new(big.Int).Mul(new(big.Int).SetBytes(c), new(big.Int).SetBytes(x))
+	s.Add(s, new(big.Int).SetBytes(k))
+	s.Mod(s, n)
+
+	proof = make([]byte, 0, P256ProofSize)
+	proof = append(proof, gammaB...)
+	proof = append(proof, c...)
+	proof = append(proof, p256ScalarBytes(s)...)
+	return p256ProofToHash(gammaB), proof
+}
+
+func p256Verify(pk PublicKey, alpha, vrf, proof []byte) bool {
+	if len(pk) != P256PublicKeySize || len(proof) != P256ProofSize || len(vrf) != P256Size {
+		return false
+	}
+	y, ok := p256Decode(pk)
+	if !ok {
+		return false
+	}
+	gammaB := proof[:p256PointSize]
+	gamma, ok := p256Decode(gammaB)
+	if !ok {
+		return false
+	}
+	c := proof[p256PointSize : p256PointSize+ecvrfChallengeSize]
+	s := proof[p256PointSize+ecvrfChallengeSize:]
+	if new(big.Int).SetBytes(s).Cmp(elliptic.P256().Params().N) >= 0 {
+		return false
+	}
+	h, ok := p256EncodeToCurve(pk, alpha)
+	if !ok {
+		return false
+	}
+	// U = s*B - c*Y, V = s*H - c*Gamma
+	u := p256Add(p256ScalarBaseMult(s), p256Neg(p256ScalarMult(y, c)))
+	v := p256Add(p256ScalarMult(h, s), p256Neg(p256ScalarMult(gamma, c)))
+	// The identity has no encoding, and is never valid.
+	if u.x.Sign() == 0 && u.y.Sign() == 0 || v.x.Sign() == 0 && v.y.Sign() == 0 {
+		return false
+	}
+	cCheck := p256Challenge(pk, p256Encode(h), gammaB, p256Encode(u), p256Encode(v))
+	if subtle.ConstantTimeCompare(cCheck, c) != 1 {
+		return false
+	}
+	return subtle.ConstantTimeCompare(p256ProofToHash(gammaB), vrf) == 1
+}
@@ -0,0 +1,101 @@
+package vrf
+
+import (
+	"bytes"
+	"testing"
+)
+
+// RFC 9381 test vectors for ECVRF-P256-SHA256-TAI (Appendix B.1,
+// examples 10 to 12). The keys are those of RFC 6979.
+var p256Vectors = []struct {
+	sk    string
+	pk    string
+	alpha string
+	pi    string
+	beta  string
+}{
+	{
+		sk:    "c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721",
+		pk:    "0360fed4ba255a9d31c961eb74c6356d68c049b8923b61fa6ce669622e60f29fb6",
+		alpha: "73616d706c65",
+		pi:    "035b5c726e8c0e2c488a107c600578ee75cb702343c153cb1eb8dec77f4b5071b4a53f0a46f018bc2c56e58d383f2305e0975972c26feea0eb122fe7893c15af376b33edf7de17c6ea056d4d82de6bc02f",
+		beta:  "a3ad7b0ef73d8fc6655053ea22f9bede8c743f08bbed3d38821f0e16474b505e",
+	},
+	{
+		sk:    "c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721",
+		pk:    "0360fed4ba255a9d31c961eb74c6356d68c049b8923b61fa6ce669622e60f29fb6",
+		alpha: "74657374",
+		pi:    "034dac60aba508ba0c01aa9be80377ebd7562c4a52d74722e0abae7dc3080ddb56c19e067b15a8a8174905b13617804534214f935b94c2287f797e393eb0816969d864f37625b443f30f1a5a33f2b3c854",
+		beta:  "a284f94ceec2ff4b3794629da7cbafa49121972671b466cab4ce170aa365f26d",
+	},
+	{
+		sk:    "2ca1411a41b17b24cc8c3b089cfd033f1920202a6c0de8abb97df1498d50d2c8",
+		pk:    "03596375e6ce57e0f20294fc46bdfcfd19a39f8161b58695b3ec5b3d16427c274d",
+		alpha: "4578616d706c65206f66204543445341207769746820616e736970323536723120616e64205348412d323536",
+		pi:    "030b002a87426005cf0e1a3f07c691881824157b3c1c5d1a330b06602d25453d6fb18150f8dee88080975edc989199e59a75a0d1bbe836914e8f6abc39e21e3976cb4c51f4db3434b0b1404b4630e50a6c",
+		beta:  "f1c929389f0330c80707ee1326d4412c0061462615efc6986d93485bdaac49e8",
+	},
+}
+
+func TestP256Vectors(t *testing.T) {
+	for _, v := range p256Vectors {
+		sk, err := P256TAI.GenerateKey(bytes.NewReader(mustDecodeHex(t, v.sk)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pk, err := P256TAI.Public(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pk, mustDecodeHex(t, v.pk)) {
+			t.Fatalf("pk %x, want %s", pk, v.pk)
+		}
+		alpha := mustDecodeHex(t, v.alpha)
+		beta, pi := P256TAI.Prove(sk, alpha)
+		if !bytes.Equal(pi, mustDecodeHex(t, v.pi)) {
+			t.Fatalf("pi %x, want %s", pi, v.pi)
+		}
+		if !bytes.Equal(beta, mustDecodeHex(t, v.beta)) {
+			t.Fatalf("beta %x, want %s", beta, v.beta)
+		}
+		if !bytes.Equal(P256TAI.Compute(sk, alpha), beta) {
+			t.Fatal("Compute != Prove")
+		}
+		if !P256TAI.Verify(pk, alpha, beta, pi) {
+			t.Fatal("valid proof rejected")
+		}
+	}
+}
+
+func TestP256InvalidKeys(t *testing.T) {
+	sk, err := P256TAI.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sk) != P256PrivateKeySize {
+		t.Fatalf("key size %d", len(sk))
+	}
+	alice := []byte("alice")
+	vrf, proof := P256TAI.Prove(sk, alice)
+	pk, err := P256TAI.Public(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A point that is not on the curve.
+	bad := append([]byte{}, pk...)
+	bad[0] = 0x04
+	if P256TAI.Verify(bad, alice, vrf, proof) {
+		t.Fatal("accepted invalid key")
+	}
+	// Keys of another suite are rejected.
+	edSK, err := EdwardsTAI.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := P256TAI.Public(edSK); err == nil {
+		t.Fatal("expected error")
+	}
+	if vrf, proof := P256TAI.Prove(edSK, alice); vrf != nil || proof != nil {
+		t.Fatal("proved with an edwards key")
+	}
+}
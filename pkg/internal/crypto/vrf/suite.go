@@ -0,0 +1,164 @@
+package vrf
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Suite identifies a VRF construction. All suites share the
+// PrivateKey and PublicKey types, whose encoding is suite-specific.
+type Suite uint8
+
+const (
+	// CONIKS is the legacy construction of this package,
+	// using SHAKE256 and the Elligator map. It is the default.
+	CONIKS Suite = iota + 1
+	// EdwardsTAI is ECVRF-EDWARDS25519-SHA512-TAI from RFC 9381.
+	EdwardsTAI
+	// EdwardsELL2 is ECVRF-EDWARDS25519-SHA512-ELL2 from RFC 9381.
+	EdwardsELL2
+	// P256TAI is ECVRF-P256-SHA256-TAI from RFC 9381.
+	P256TAI
+)
+
+// DefaultSuite is the suite used by keys created without a
+// suite, including all keys that predate VRF suites.
+const DefaultSuite = CONIKS
+
+var (
+	// ErrUnknownSuite indicates the VRF suite is not supported.
+	ErrUnknownSuite = errors.New("[vrf] unknown suite")
+)
+
+var suiteNames = map[Suite]string{
+	CONIKS:      "CONIKS-ED25519-SHAKE256-ELL",
+	EdwardsTAI:  "ECVRF-EDWARDS25519-SHA512-TAI",
+	EdwardsELL2: "ECVRF-EDWARDS25519-SHA512-ELL2",
+	P256TAI:     "ECVRF-P256-SHA256-TAI",
+}
+
+// String returns the identifier of the suite.
+func (s Suite) String() string {
+	if name, ok := suiteNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Suite(%d)", uint8(s))
+}
+
+// Available returns true if the suite is supported.
+func (s Suite) Available() bool {
+	_, ok := suiteNames[s]
+	return ok
+}
+
+// Suites returns all supported suites.
+func Suites() []Suite {
+	return []Suite{CONIKS, EdwardsTAI, EdwardsELL2, P256TAI}
+}
+
+// ParseSuite returns the suite with the identifier name.
+func ParseSuite(name string) (Suite, error) {
+	for s, n := range suiteNames {
+		if n == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownSuite, name)
+}
+
+// GenerateKey creates a key pair for the suite using rnd for
+// randomness. If rnd is nil, crypto/rand is used.
+func (s Suite) GenerateKey(rnd io.Reader) (PrivateKey, error) {
+	if rnd == nil {
+		rnd = rand.Reader
+	}
+	switch s {
+	case CONIKS:
+		return GenerateKey(rnd)
+	case EdwardsTAI, EdwardsELL2:
+		return ecvrfGenerateKey(rnd)
+	case P256TAI:
+		return p256GenerateKey(rnd)
+	}
+	return nil, fmt.Errorf("%w: %v", ErrUnknownSuite, s)
+}
+
+// Public returns the public key of sk.
+func (s Suite) Public(sk PrivateKey) (PublicKey, error) {
+	var secretSize int
+	switch s {
+	case CONIKS, EdwardsTAI, EdwardsELL2:
+		secretSize = PrivateKeySize - PublicKeySize
+	case P256TAI:
+		secretSize = p256ScalarSize
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownSuite, s)
+	}
+	if len(sk) != s.PrivateKeySize() {
+		return nil, ErrGetPubKey
+	}
+	// All suites store the public key after the secret.
+	return PublicKey(append([]byte{}, sk[secretSize:]...)), nil
+}
+
+// PrivateKeySize returns the size of private keys of the suite.
+func (s Suite) PrivateKeySize() int {
+	if s == P256TAI {
+		return P256PrivateKeySize
+	}
+	return PrivateKeySize
+}
+
+// Compute generates the vrf value for m with sk.
+func (s Suite) Compute(sk PrivateKey, m []byte) []byte {
+	switch s {
+	case CONIKS:
+		return sk.Compute(m)
+	case EdwardsTAI, EdwardsELL2:
+		return ecvrfCompute(s.ecvrfID(), sk, m)
+	case P256TAI:
+		return p256Compute(sk, m)
+	}
+	panic(fmt.Sprintf("%v: %v", ErrUnknownSuite, s))
+}
+
+// Prove returns the vrf value for m and a proof such that
+// Verify(pk, m, vrf, proof) == true.
+func (s Suite) Prove(sk PrivateKey, m []byte) (vrf, proof []byte) {
+	switch s {
+	case CONIKS:
+		return sk.Prove(m)
+	case EdwardsTAI, EdwardsELL2:
+		return ecvrfProve(s.ecvrfID(), sk, m)
+	case P256TAI:
+		return p256Prove(sk, m)
+	}
+	panic(fmt.Sprintf("%v: %v", ErrUnknownSuite, s))
+}
+
+// Verify returns true iff vrf is the vrf value of m for the
+// private key of pk, as proven by proof.
+func (s Suite) Verify(pk PublicKey, m, vrf, proof []byte) bool {
+	switch s {
+	case CONIKS:
+		return pk.Verify(m, vrf, proof)
+	case EdwardsTAI, EdwardsELL2:
+		return ecvrfVerify(s.ecvrfID(), pk, m, vrf, proof)
+	case P256TAI:
+		return p256Verify(pk, m, vrf, proof)
+	}
+	return false
+}
+
+// ecvrfID returns the suite_string of RFC 9381.
+func (s Suite) ecvrfID() byte {
+	switch s {
+	case EdwardsTAI:
+		return ecvrfSuiteTAI
+	case EdwardsELL2:
+		return ecvrfSuiteELL2
+	}
+	panic(fmt.Sprintf("%v: %v", ErrUnknownSuite, s))
+}
@@ -0,0 +1,38 @@
+// Command katgen writes the known-answer test vectors.
+//
+//	go run ./cmd/katgen -o testdata/vectors.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/kat"
+)
+
+func main() {
+	out := flag.String("o", "", "output file (default stdout)")
+	flag.Parse()
+
+	if err := run(*out); err != nil {
+		fmt.Fprintln(os.Stderr, "katgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(out string) error {
+	v, err := kat.Generate()
+	if err != nil {
+		return err
+	}
+	b, err := v.Marshal()
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(out, b, 0o644)
+}
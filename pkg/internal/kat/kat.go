@@ -0,0 +1,297 @@
+// Package kat generates known-answer test vectors, so that
+// implementations in other languages can check their commitments,
+// node hashes, roots and proofs against this one. The vectors are
+// generated from deterministic recorders and checked in under
+// testdata, where the tests of this package replay them.
+package kat
+
+//go:generate go run ./cmd/katgen -o testdata/vectors.json
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/laurentsimon/dataset-recorder/pkg"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/merkletree"
+)
+
+// Version is the version of the vector format. It must be
+// incremented when the fields of the vectors change.
+const Version = 1
+
+// Node types of NodeVector.
+const (
+	NodeLeaf     = "leaf"
+	NodeEmpty    = "empty"
+	NodeInterior = "interior"
+)
+
+// Proof types of ProofVector.
+const (
+	ProofInclusion  = "inclusion"
+	ProofExclusion  = "exclusion"
+	ProofMembership = "membership"
+)
+
+// Hex is a byte string encoded in hexadecimal in JSON.
+type Hex []byte
+
+// MarshalText encodes h in hexadecimal.
+func (h Hex) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h)), nil
+}
+
+// UnmarshalText decodes hexadecimal text into h.
+func (h *Hex) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*h = b
+	return nil
+}
+
+// Vectors are the known-answer test vectors.
+type Vectors struct {
+	Version     int                `json:"version"`
+	Commitments []CommitmentVector `json:"commitments"`
+	Nodes       []NodeVector       `json:"nodes"`
+	Recorders   []RecorderVector   `json:"recorders"`
+}
+
+// CommitmentVector is a commitment to a key and value:
+// Digest(salt, key, value).
+type CommitmentVector struct {
+	HashSuite  string `json:"hashSuite"`
+	Salt       Hex    `json:"salt"`
+	Key        Hex    `json:"key"`
+	Value      Hex    `json:"value"`
+	Commitment Hex    `json:"commitment"`
+}
+
+// NodeVector is the hash of a tree node. Leaves and empty nodes
+// have an index, and leaves a commitment. Interior nodes have the
+// hashes of their children, and depend on the tree version.
+type NodeVector struct {
+	Type        string `json:"type"`
+	HashSuite   string `json:"hashSuite"`
+	TreeVersion int    `json:"treeVersion,omitempty"`
+	Nonce       Hex    `json:"nonce"`
+	Level       uint32 `json:"level"`
+	Index       Hex    `json:"index,omitempty"`
+	Commitment  Hex    `json:"commitment,omitempty"`
+	Left        Hex    `json:"left,omitempty"`
+	Right       Hex    `json:"right,omitempty"`
+	Hash        Hex    `json:"hash"`
+}
+
+// RecorderVector is a deterministic recorder and proofs of its records.
+type RecorderVector struct {
+	Name        string   `json:"name"`
+	HashSuite   string   `json:"hashSuite"`
+	VRFSuite    string   `json:"vrfSuite,omitempty"`
+	PublicIndex bool     `json:"publicIndex,omitempty"`
+	TreeVersion int      `json:"treeVersion"`
+	Seed        Hex      `json:"seed"`
+	Records     []Record `json:"records"`
+	// Public is the public data, as returned by Recorder.Public.
+	Public string        `json:"public"`
+	Root   Hex           `json:"root"`
+	Proofs []ProofVector `json:"proofs"`
+}
+
+// Record is a key and value.
+type Record struct {
+	Key   Hex `json:"key"`
+	Value Hex `json:"value"`
+}
+
+// ProofVector is a proof of a key, as encoded by Proof.MarshalBinary.
+// Proofs of exclusion have no value, and membership proofs come with
+// the salt that opens their commitment to the value.
+type ProofVector struct {
+	Type  string `json:"type"`
+	Key   Hex    `json:"key"`
+	Value Hex    `json:"value,omitempty"`
+	Salt  Hex    `json:"salt,omitempty"`
+	Proof Hex    `json:"proof"`
+}
+
+// recorderConfigs are the recorders of the vectors.
+var recorderConfigs = []RecorderVector{
+	{HashSuite: pkg.HashSHAKE128, VRFSuite: pkg.VRFCONIKS, TreeVersion: 2},
+	{HashSuite: pkg.HashSHAKE128, VRFSuite: pkg.VRFCONIKS, TreeVersion: 1},
+	{HashSuite: pkg.HashSHA256, VRFSuite: pkg.VRFEdwards25519TAI, TreeVersion: 2},
+	{HashSuite: pkg.HashBLAKE2b256, VRFSuite: pkg.VRFEdwards25519ELL2, TreeVersion: 2},
+	{HashSuite: pkg.HashSHA256, VRFSuite: pkg.VRFP256TAI, TreeVersion: 2},
+	{HashSuite: pkg.HashSHA256, PublicIndex: true, TreeVersion: 2},
+}
+
+// Generate returns the vectors. Its output only depends
+// on the code, so that it can be compared to the checked-in
+// vectors.
+func Generate() (*Vectors, error) {
+	v := &Vectors{
+		Version: Version,
+	}
+	for _, h := range crypto.Hashes() {
+		salt := h.Digest([]byte("kat salt"))
+		key, value := []byte("key"), []byte("value")
+		commitment := crypto.NewCommitWithSalt(h, salt, key, value)
+		v.Commitments = append(v.Commitments, CommitmentVector{
+			HashSuite:  h.String(),
+			Salt:       salt,
+			Key:        key,
+			Value:      value,
+			Commitment: commitment.Value,
+		})
+
+		nonce := h.Digest([]byte("kat nonce"))
+		index := h.Digest([]byte("kat index"))
+		leaf := merkletree.LeafHash(h, nonce, index, 3, commitment.Value)
+		v.Nodes = append(v.Nodes, NodeVector{
+			Type:       NodeLeaf,
+			HashSuite:  h.String(),
+			Nonce:      nonce,
+			Level:      3,
+			Index:      index,
+			Commitment: commitment.Value,
+			Hash:       leaf,
+		})
+		// Empty nodes are indexed by their prefix.
+		empty := merkletree.EmptyHash(h, nonce, []byte{0xa0}, 3)
+		v.Nodes = append(v.Nodes, NodeVector{
+			Type:      NodeEmpty,
+			HashSuite: h.String(),
+			Nonce:     nonce,
+			Level:     3,
+			Index:     []byte{0xa0},
+			Hash:      empty,
+		})
+		for _, version := range []merkletree.HashVersion{merkletree.HashV1, merkletree.HashV2} {
+			v.Nodes = append(v.Nodes, NodeVector{
+				Type:        NodeInterior,
+				HashSuite:   h.String(),
+				TreeVersion: int(version),
+				Nonce:       nonce,
+				Level:       2,
+				Left:        empty,
+				Right:       leaf,
+				Hash:        merkletree.InteriorHash(h, version, nonce, 2, empty, leaf),
+			})
+		}
+	}
+	for _, c := range recorderConfigs {
+		r, err := generateRecorder(c)
+		if err != nil {
+			return nil, err
+		}
+		v.Recorders = append(v.Recorders, *r)
+	}
+	return v, nil
+}
+
+// Options returns the recorder options of c.
+func (c *RecorderVector) Options() []pkg.Option {
+	opts := []pkg.Option{
+		pkg.WithHashSuite(c.HashSuite),
+		pkg.WithTreeVersion(c.TreeVersion),
+		pkg.WithDeterministicSeed(c.Seed),
+	}
+	if c.PublicIndex {
+		return append(opts, pkg.WithPublicIndex())
+	}
+	return append(opts, pkg.WithVRFSuite(c.VRFSuite))
+}
+
+func generateRecorder(c RecorderVector) (*RecorderVector, error) {
+	c.Name = fmt.Sprintf("%s %s v%d", c.VRFSuite, c.HashSuite, c.TreeVersion)
+	if c.PublicIndex {
+		c.Name = fmt.Sprintf("public-index %s v%d", c.HashSuite, c.TreeVersion)
+	}
+	c.Seed = []byte("dataset-recorder test vectors")
+	r, err := pkg.NewEmptyRecorder(nil, c.Options()...)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < 5; i++ {
+		record := Record{
+			Key:   []byte(fmt.Sprintf("key%d", i)),
+			Value: []byte(fmt.Sprintf("value%d", i)),
+		}
+		if err := r.Insert(record.Key, record.Value); err != nil {
+			return nil, err
+		}
+		c.Records = append(c.Records, record)
+	}
+	public, err := r.Public()
+	if err != nil {
+		return nil, err
+	}
+	var p struct {
+		TreeHash []byte `json:"treeHash"`
+	}
+	if err := json.Unmarshal(public, &p); err != nil {
+		return nil, err
+	}
+	c.Public, c.Root = string(public), p.TreeHash
+
+	var state bytes.Buffer
+	if err := r.WriteInternal(&state); err != nil {
+		return nil, err
+	}
+	prover, err := pkg.NewProverFromReader(&state, r.Private())
+	if err != nil {
+		return nil, err
+	}
+	proofs := []struct {
+		typ   string
+		key   []byte
+		value []byte
+	}{
+		{ProofInclusion, []byte("key1"), []byte("value1")},
+		{ProofExclusion, []byte("absent"), nil},
+		{ProofMembership, []byte("key3"), []byte("value3")},
+	}
+	for _, tt := range proofs {
+		pv := ProofVector{
+			Type:  tt.typ,
+			Key:   tt.key,
+			Value: tt.value,
+		}
+		var proof *pkg.Proof
+		if tt.typ == ProofMembership {
+			proof, err = prover.GetMembership(tt.key)
+			if err != nil {
+				return nil, err
+			}
+			opening, err := prover.Open(tt.key)
+			if err != nil {
+				return nil, err
+			}
+			pv.Salt = opening.Salt
+		} else {
+			proof, err = prover.Get(tt.key)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if pv.Proof, err = proof.MarshalBinary(); err != nil {
+			return nil, err
+		}
+		c.Proofs = append(c.Proofs, pv)
+	}
+	return &c, nil
+}
+
+// Marshal encodes the vectors as they are checked in.
+func (v *Vectors) Marshal() ([]byte, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
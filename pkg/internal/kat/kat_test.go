@@ -0,0 +1,147 @@
+package kat
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/laurentsimon/dataset-recorder/pkg"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/merkletree"
+)
+
+func readVectors(t *testing.T) ([]byte, *Vectors) {
+	t.Helper()
+	b, err := os.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v Vectors
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Version != Version {
+		t.Fatalf("unexpected version: %d", v.Version)
+	}
+	return b, &v
+}
+
+func hashForTest(t *testing.T, name string) crypto.Hash {
+	t.Helper()
+	for _, h := range crypto.Hashes() {
+		if h.String() == name {
+			return h
+		}
+	}
+	t.Fatalf("unknown hash suite %q", name)
+	return 0
+}
+
+func TestVectorsUpToDate(t *testing.T) {
+	t.Parallel()
+
+	want, _ := readVectors(t)
+	v, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := v.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), string(got)); diff != "" {
+		t.Fatalf("vectors changed, run go generate if intended (-want +got): \n%s", diff)
+	}
+}
+
+func TestReplayCommitments(t *testing.T) {
+	t.Parallel()
+
+	_, v := readVectors(t)
+	for _, c := range v.Commitments {
+		h := hashForTest(t, c.HashSuite)
+		got := crypto.NewCommitWithSalt(h, c.Salt, c.Key, c.Value)
+		if !bytes.Equal(got.Value, c.Commitment) {
+			t.Errorf("%s: commitment %x, want %x", c.HashSuite, got.Value, []byte(c.Commitment))
+		}
+	}
+}
+
+func TestReplayNodes(t *testing.T) {
+	t.Parallel()
+
+	_, v := readVectors(t)
+	for _, n := range v.Nodes {
+		h := hashForTest(t, n.HashSuite)
+		var got []byte
+		switch n.Type {
+		case NodeLeaf:
+			got = merkletree.LeafHash(h, n.Nonce, n.Index, n.Level, n.Commitment)
+		case NodeEmpty:
+			got = merkletree.EmptyHash(h, n.Nonce, n.Index, n.Level)
+		case NodeInterior:
+			got = merkletree.InteriorHash(h, merkletree.HashVersion(n.TreeVersion), n.Nonce, n.Level, n.Left, n.Right)
+		default:
+			t.Fatalf("unknown node type %q", n.Type)
+		}
+		if !bytes.Equal(got, n.Hash) {
+			t.Errorf("%s %s v%d: hash %x, want %x", n.Type, n.HashSuite, n.TreeVersion, got, []byte(n.Hash))
+		}
+	}
+}
+
+func TestReplayRecorders(t *testing.T) {
+	t.Parallel()
+
+	_, v := readVectors(t)
+	for _, r := range v.Recorders {
+		r := r
+		t.Run(r.Name, func(t *testing.T) {
+			t.Parallel()
+
+			verifier, err := pkg.NewVerifier([]byte(r.Public))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, pv := range r.Proofs {
+				var proof pkg.Proof
+				if err := proof.UnmarshalBinary(pv.Proof); err != nil {
+					t.Fatal(err)
+				}
+				switch pv.Type {
+				case ProofInclusion:
+					err = verifier.VerifyInclusion(proof, pv.Key, pv.Value)
+				case ProofExclusion:
+					err = verifier.VerifyExclusion(proof, pv.Key, pv.Value)
+				case ProofMembership:
+					err = verifier.VerifyOpening(proof, pv.Key, pkg.Opening{Value: pv.Value, Salt: pv.Salt})
+				default:
+					t.Fatalf("unknown proof type %q", pv.Type)
+				}
+				if err != nil {
+					t.Errorf("%s proof of %q: %v", pv.Type, pv.Key, err)
+				}
+			}
+
+			// Recording the same records again gives the same public data.
+			rec, err := pkg.NewEmptyRecorder(nil, r.Options()...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, record := range r.Records {
+				if err := rec.Insert(record.Key, record.Value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			public, err := rec.Public()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(r.Public, string(public)); diff != "" {
+				t.Fatalf("unexpected public data (-want +got): \n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package merkletree
+
+import (
+	"fmt"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/utils"
+)
+
+// boundedReader reads serialized data with bound checks,
+// so that corrupted lengths are reported as errors
+// instead of triggering large allocations.
+type boundedReader struct {
+	data   []byte
+	offset int
+}
+
+func (s *boundedReader) read(n int) ([]byte, error) {
+	if n < 0 || n > len(s.data)-s.offset {
+		return nil, fmt.Errorf("%w: expected %d bytes at offset %d, got %d",
+			ErrInvalidRead, n, s.offset, len(s.data)-s.offset)
+	}
+	b := s.data[s.offset : s.offset+n]
+	s.offset += n
+	return append([]byte{}, b...), nil
+}
+
+func (s *boundedReader) readLevel() (uint32, error) {
+	b, err := s.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return utils.BytesToUInt32(b), nil
+}
+
+func (s *boundedReader) readArbitraryLengthBytes() ([]byte, error) {
+	b, err := s.read(8)
+	if err != nil {
+		return nil, err
+	}
+	l := utils.BytesToLong(b)
+	if l < 0 || l > int64(len(s.data)-s.offset) {
+		return nil, fmt.Errorf("%w: invalid length %d at offset %d", ErrInvalidRead, l, s.offset)
+	}
+	return s.read(int(l))
+}
+
+// readOptionalBytes reads bytes written by writeOptionalBytes.
+func (s *boundedReader) readOptionalBytes() ([]byte, error) {
+	present, err := s.read(1)
+	if err != nil {
+		return nil, err
+	}
+	switch present[0] {
+	case 0:
+		return nil, nil
+	case 1:
+		return s.readArbitraryLengthBytes()
+	}
+	return nil, fmt.Errorf("%w: invalid presence byte %d", ErrInvalidRead, present[0])
+}
+
+func (s *boundedReader) done() error {
+	if s.offset != len(s.data) {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidRead, len(s.data)-s.offset)
+	}
+	return nil
+}
+
+// appendArbitraryLengthBytes appends the length-prefixed b to dst.
+func appendArbitraryLengthBytes(dst, b []byte) []byte {
+	dst = append(dst, utils.LongToBytes(int64(len(b)))...)
+	return append(dst, b...)
+}
+
+// appendOptionalBytes appends b to dst, preserving
+// the difference between nil and empty slices.
+func appendOptionalBytes(dst, b []byte) []byte {
+	if b == nil {
+		return append(dst, 0)
+	}
+	dst = append(dst, 1)
+	return appendArbitraryLengthBytes(dst, b)
+}
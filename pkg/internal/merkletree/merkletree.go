@@ -28,60 +28,182 @@ const (
 	// LeafIdentifier is the domain separation prefix for user
 	// leaf node hashes.
 	LeafIdentifier = 'L'
+
+	// InteriorIdentifier is the domain separation prefix for
+	// interior node hashes, from HashV2.
+	InteriorIdentifier = 'I'
+)
+
+// HashVersion identifies how the interior nodes of a tree are hashed.
+type HashVersion uint8
+
+const (
+	// HashV1 hashes interior nodes as Digest(left, right). It is
+	// used by all trees that predate hash versions.
+	HashV1 HashVersion = iota + 1
+	// HashV2 prefixes interior node hashes with InteriorIdentifier,
+	// the tree nonce and the level of the node, like leaf hashes,
+	// so that a node hash cannot be reused at another level or in
+	// another tree. It is the default.
+	HashV2
 )
 
+// DefaultHashVersion is the hash version of new trees.
+const DefaultHashVersion = HashV2
+
+// ErrUnknownHashVersion indicates the hash version is not supported.
+var ErrUnknownHashVersion = errors.New("[merkletree] unknown hash version")
+
+// Available returns true if the hash version is supported.
+func (v HashVersion) Available() bool {
+	return v == HashV1 || v == HashV2
+}
+
+// InteriorHash returns the hash of the interior node at
+// level whose children hash to left and right.
+func InteriorHash(h crypto.Hash, v HashVersion, nonce []byte, level uint32, left, right []byte) []byte {
+	if v == HashV1 {
+		return h.Digest(left, right)
+	}
+	return h.Digest(
+		[]byte{InteriorIdentifier},         // K_interior
+		[]byte(nonce),                      // K_n
+		[]byte(utils.UInt32ToBytes(level)), // l
+		left,
+		right,
+	)
+}
+
+// LeafHash returns the hash of the user leaf at index and level,
+// whose commitment value is commitment.
+func LeafHash(h crypto.Hash, nonce, index []byte, level uint32, commitment []byte) []byte {
+	return h.Digest(
+		[]byte{LeafIdentifier},             // K_leaf
+		[]byte(nonce),                      // K_n
+		[]byte(index),                      // i
+		[]byte(utils.UInt32ToBytes(level)), // l
+		[]byte(commitment),                 // commit(key|| value)
+	)
+}
+
+// EmptyHash returns the hash of the empty node at index and level.
+func EmptyHash(h crypto.Hash, nonce, index []byte, level uint32) []byte {
+	return h.Digest(
+		[]byte{EmptyBranchIdentifier},      // K_empty
+		[]byte(nonce),                      // K_n
+		[]byte(index),                      // i
+		[]byte(utils.UInt32ToBytes(level)), // l
+	)
+}
+
+// checkSuites returns an error if h or v is not supported.
+func checkSuites(h crypto.Hash, v HashVersion) error {
+	if !h.Available() {
+		return fmt.Errorf("%w: %v", crypto.ErrUnknownHash, h)
+	}
+	if !v.Available() {
+		return fmt.Errorf("%w: %d", ErrUnknownHashVersion, v)
+	}
+	return nil
+}
+
 // MerkleTree represents the Merkle prefix tree data structure,
 // which includes the root node, its hash, and a random tree-specific
 // nonce.
 type MerkleTree struct {
-	nonce []byte
-	root  *interiorNode
-	hash  []byte
-	dirty bool
+	suite   crypto.Hash
+	version HashVersion
+	nonce   []byte
+	root    *interiorNode
+	hash    []byte
+	dirty   bool
+	// saltKey derives the commitment salts, if set.
+	saltKey []byte
 }
 
-// NewEmpty returns an empty Merkle prefix tree
-// with a secure random nonce. The tree root is an interior node
-// and its children are two empty leaf nodes.
-func NewEmpty() (*MerkleTree, error) {
+// NewEmpty returns an empty Merkle prefix tree hashed with h and
+// version v, with a secure random nonce. The tree root is an interior
+// node and its children are two empty leaf nodes.
+func NewEmpty(h crypto.Hash, v HashVersion) (*MerkleTree, error) {
+	if err := checkSuites(h, v); err != nil {
+		return nil, err
+	}
 	root := newInteriorNode(nil, 0, []bool{})
 	nonce, err := crypto.MakeRand()
 	if err != nil {
 		return nil, err
 	}
 	m := &MerkleTree{
-		nonce: nonce,
-		root:  root,
+		suite:   h,
+		version: v,
+		nonce:   nonce,
+		root:    root,
+		dirty:   true,
 	}
 	return m, nil
 }
 
-// NewFromReader loads a tree from a reader.
-func NewFromReader(reader io.Reader) (*MerkleTree, error) {
+// NewEmptyDeterministic returns an empty Merkle prefix tree hashed
+// with h and version v, whose nonce and commitment salts are derived from the
+// secret key. Inserting the same records in a tree created with the
+// same key gives the same root, regardless of the insertion order.
+func NewEmptyDeterministic(h crypto.Hash, v HashVersion, key []byte) (*MerkleTree, error) {
+	if err := checkSuites(h, v); err != nil {
+		return nil, err
+	}
+	return &MerkleTree{
+		suite:   h,
+		version: v,
+		nonce:   crypto.PRF(key, "nonce"),
+		root:    newInteriorNode(nil, 0, []bool{}),
+		saltKey: append([]byte{}, key...),
+		dirty:   true,
+	}, nil
+}
+
+// SetSaltKey derives the salts of the commitments created by
+// later calls to Set from the secret key. It is used to resume
+// a tree created with NewEmptyDeterministic.
+func (m *MerkleTree) SetSaltKey(key []byte) {
+	m.saltKey = append([]byte{}, key...)
+}
+
+// Deterministic returns true if the commitment salts
+// are derived from a key.
+func (m *MerkleTree) Deterministic() bool {
+	return m.saltKey != nil
+}
+
+// NewFromReader loads a tree hashed with h and version v from a reader.
+// The tree must be the rest of the reader's data.
+func NewFromReader(reader io.Reader, h crypto.Hash, v HashVersion) (*MerkleTree, error) {
+	if err := checkSuites(h, v); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	s := &boundedReader{data: data}
 	m := new(MerkleTree)
+	m.suite = h
+	m.version = v
 	// Set tree as dirty because the hash is not computed.
 	m.dirty = true
 	// Read the nonce.
-	m.nonce = make([]byte, crypto.HashSizeByte)
-	n, err := reader.Read(m.nonce)
-	if err != nil {
+	if m.nonce, err = s.read(crypto.HashSizeByte); err != nil {
 		return nil, err
 	}
-	if n != crypto.HashSizeByte {
-		return nil, fmt.Errorf("%w: expected %d, got %d", ErrInvalidWrite, crypto.HashSizeByte, n)
-	}
 	// Read the hash.
-	hash := make([]byte, crypto.HashSizeByte)
-	n, err = reader.Read(hash)
+	hash, err := s.read(crypto.HashSizeByte)
 	if err != nil {
 		return nil, err
 	}
-	if n != crypto.HashSizeByte {
-		return nil, fmt.Errorf("%w: expected %d, got %d", ErrInvalidWrite, crypto.HashSizeByte, n)
-	}
 	// Read the tree.
-	m.root, err = readInteriorNode(reader)
-	if err != nil {
+	if m.root, err = readInteriorNode(s); err != nil {
+		return nil, err
+	}
+	if err := s.done(); err != nil {
 		return nil, err
 	}
 
@@ -135,6 +257,55 @@ func (m *MerkleTree) Hash() []byte {
 	return h
 }
 
+// HashSuite returns the hash used by the tree.
+func (m *MerkleTree) HashSuite() crypto.Hash {
+	return m.suite
+}
+
+// HashVersion returns how the interior nodes of the tree are hashed.
+func (m *MerkleTree) HashVersion() HashVersion {
+	return m.version
+}
+
+// Len returns the number of user leaves in the tree.
+func (m *MerkleTree) Len() uint64 {
+	var n uint64
+	m.visitLeafNodes(func(*userLeafNode) {
+		n++
+	})
+	return n
+}
+
+// Leaf is a user leaf of the tree.
+type Leaf struct {
+	Index []byte
+	// Key is nil for leaves written before keys were stored.
+	Key        []byte
+	Value      []byte
+	Commitment *crypto.Commit
+}
+
+// Leaves returns copies of the user leaves of the tree,
+// ordered by index.
+func (m *MerkleTree) Leaves() []Leaf {
+	var leaves []Leaf
+	m.visitLeafNodes(func(n *userLeafNode) {
+		l := Leaf{
+			Index: append([]byte{}, n.index...),
+			Value: append([]byte{}, n.value...),
+			Commitment: &crypto.Commit{
+				Salt:  append([]byte{}, n.commitment.Salt...),
+				Value: append([]byte{}, n.commitment.Value...),
+			},
+		}
+		if n.key != nil {
+			l.Key = append([]byte{}, n.key...)
+		}
+		leaves = append(leaves, l)
+	})
+	return leaves
+}
+
 // Get returns an AuthenticationPath used as a proof
 // of inclusion/absence for the requested lookupIndex.
 func (m *MerkleTree) Get(lookupIndex []byte) (*AuthenticationPath, error) {
@@ -217,13 +388,21 @@ func (m *MerkleTree) Get(lookupIndex []byte) (*AuthenticationPath, error) {
 // commitment are replaced with the new value and newly generated
 // commitment.
 func (m *MerkleTree) Set(index []byte, key, value []byte) error {
-	commitment, err := crypto.NewCommit([]byte(key), value)
-	if err != nil {
-		return err
+	var commitment *crypto.Commit
+	if m.saltKey != nil {
+		salt := crypto.PRF(m.saltKey, "salt", index, key, value)
+		commitment = crypto.NewCommitWithSalt(m.suite, salt, key, value)
+	} else {
+		var err error
+		commitment, err = crypto.NewCommit(m.suite, []byte(key), value)
+		if err != nil {
+			return err
+		}
 	}
 	toAdd := userLeafNode{
 		value:      append([]byte{}, value...), // make a copy of value
 		index:      index,
+		key:        append([]byte{}, key...), // make a copy of key
 		commitment: commitment,
 	}
 	m.insertNode(index, &toAdd)
@@ -333,8 +512,12 @@ func visitULNsInternal(nodePtr merkleNode, callBack func(*userLeafNode)) {
 // and vice versa.
 func (m *MerkleTree) Clone() *MerkleTree {
 	return &MerkleTree{
-		nonce: append([]byte{}, m.nonce...), // Make a copy of the nonce.
-		root:  m.root.clone(nil).(*interiorNode),
-		hash:  append([]byte{}, m.hash...), // Make a copy of the nonce.
+		suite:   m.suite,
+		version: m.version,
+		nonce:   append([]byte{}, m.nonce...), // Make a copy of the nonce.
+		root:    m.root.clone(nil).(*interiorNode),
+		hash:    append([]byte{}, m.hash...), // Make a copy of the nonce.
+
+		saltKey: m.saltKey, // Never mutated, so it can be shared.
 	}
 }
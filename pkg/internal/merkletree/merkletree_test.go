@@ -2,6 +2,7 @@ package merkletree
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"testing"
 
@@ -13,7 +14,7 @@ import (
 var staticVRFKey = crypto.NewStaticTestVRFKey()
 
 func newEmptyTreeForTest(t *testing.T) *MerkleTree {
-	m, err := NewEmpty()
+	m, err := NewEmpty(crypto.SHAKE128, HashV2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -22,7 +23,7 @@ func newEmptyTreeForTest(t *testing.T) *MerkleTree {
 
 // TODO: When #178 is merged, 3 tests below should be removed.
 func TestOneEntry(t *testing.T) {
-	m, err := NewEmpty()
+	m, err := NewEmpty(crypto.SHAKE128, HashV2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -96,7 +97,7 @@ func TestOneEntry(t *testing.T) {
 }
 
 func TestTwoEntries(t *testing.T) {
-	m, err := NewEmpty()
+	m, err := NewEmpty(crypto.SHAKE128, HashV2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -136,7 +137,7 @@ func TestTwoEntries(t *testing.T) {
 }
 
 func TestThreeEntries(t *testing.T) {
-	m, err := NewEmpty()
+	m, err := NewEmpty(crypto.SHAKE128, HashV2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -256,7 +257,7 @@ func TestTreeClone(t *testing.T) {
 	index2 := staticVRFKey.Compute([]byte(key2))
 	val2 := []byte("value2")
 
-	m1, err := NewEmpty()
+	m1, err := NewEmpty(crypto.SHAKE128, HashV2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -309,7 +310,7 @@ func TestNewFromReader(t *testing.T) {
 	entries := uint64(10)
 	var i uint64
 	// Create m1 tree.
-	m1, err := NewEmpty()
+	m1, err := NewEmpty(crypto.SHAKE128, HashV2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -360,7 +361,7 @@ func TestNewFromReader(t *testing.T) {
 	}
 	cpyb1.Write(b1.Bytes())
 	// Create a new tree from b1.
-	m2, err := NewFromReader(&b1)
+	m2, err := NewFromReader(&b1, crypto.SHAKE128, HashV2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -403,3 +404,152 @@ func TestNewFromReader(t *testing.T) {
 		}
 	}
 }
+
+func TestNewFromReaderCorrupt(t *testing.T) {
+	m, err := NewEmpty(crypto.SHAKE128, HashV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		key := []byte(fmt.Sprint("key", i))
+		if err := m.Set(staticVRFKey.Compute(key), key, []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var b bytes.Buffer
+	if err := m.WriteInternal(&b); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+	// The length of the index of the first leaf follows
+	// its header and level.
+	lenOffset := leafOffsets(t, m)[0] + 1 + 4
+	withLength := func(l int64) []byte {
+		d := append([]byte{}, data...)
+		copy(d[lenOffset:], utils.LongToBytes(l))
+		return d
+	}
+	for name, d := range map[string][]byte{
+		"huge length":     withLength(1 << 62),
+		"negative length": withLength(-1),
+		"truncated":       data[:len(data)-1],
+		"trailing bytes":  append(append([]byte{}, data...), 0),
+		"bad header":      append(append([]byte{}, data[:2*crypto.HashSizeByte]...), 'X'),
+	} {
+		if _, err := NewFromReader(bytes.NewReader(d), crypto.SHAKE128, HashV2); !errors.Is(err, ErrInvalidRead) {
+			t.Errorf("%s: unexpected err: %v", name, err)
+		}
+	}
+	if _, err := NewFromReader(bytes.NewReader(data), crypto.SHAKE128, HashV2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeterministicTree(t *testing.T) {
+	t.Parallel()
+
+	build := func(key []byte, keys []string) *MerkleTree {
+		m, err := NewEmptyDeterministic(crypto.SHAKE128, HashV2, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range keys {
+			if err := m.Set(staticVRFKey.Compute([]byte(k)), []byte(k), []byte("value "+k)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return m
+	}
+	write := func(m *MerkleTree) []byte {
+		var buf bytes.Buffer
+		if err := m.WriteInternal(&buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	key := []byte("secret")
+	m1 := build(key, []string{"a", "b", "c", "d"})
+	m2 := build(key, []string{"d", "b", "a", "c"})
+	if !bytes.Equal(write(m1), write(m2)) {
+		t.Fatal("same records give different states")
+	}
+	if !m1.Deterministic() {
+		t.Fatal("tree is not deterministic")
+	}
+
+	// A loaded tree resumes deterministically once given the key.
+	m3, err := NewFromReader(bytes.NewReader(write(build(key, []string{"a", "b"}))), crypto.SHAKE128, HashV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m3.SetSaltKey(key)
+	for _, k := range []string{"c", "d"} {
+		if err := m3.Set(staticVRFKey.Compute([]byte(k)), []byte(k), []byte("value "+k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(m1.Hash(), m3.Hash()) {
+		t.Fatal("resumed tree has a different root")
+	}
+
+	if bytes.Equal(m1.Hash(), build([]byte("other"), []string{"a", "b", "c", "d"}).Hash()) {
+		t.Fatal("different keys give the same root")
+	}
+}
+
+func TestHashVersions(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewEmpty(crypto.SHAKE128, HashVersion(3)); !errors.Is(err, ErrUnknownHashVersion) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	key := []byte("key")
+	index := staticVRFKey.Compute(key)
+	roots := make(map[HashVersion][]byte)
+	for _, v := range []HashVersion{HashV1, HashV2} {
+		m, err := NewEmptyDeterministic(crypto.SHAKE128, v, []byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Set(index, key, []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+		left, right := m.root.leftChild.hash(m), m.root.rightChild.hash(m)
+		want := crypto.SHAKE128.Digest(left, right)
+		if v == HashV2 {
+			want = crypto.SHAKE128.Digest([]byte{InteriorIdentifier}, m.nonce, []byte{0, 0, 0, 0}, left, right)
+		}
+		if got := m.Hash(); !bytes.Equal(got, want) {
+			t.Fatalf("version %d: root %x, want %x", v, got, want)
+		}
+		roots[v] = m.Hash()
+
+		// The tree reloads and its proofs verify with its own version only.
+		var b bytes.Buffer
+		if err := m.WriteInternal(&b); err != nil {
+			t.Fatal(err)
+		}
+		other := HashV1 + HashV2 - v
+		if _, err := NewFromReader(bytes.NewReader(b.Bytes()), crypto.SHAKE128, other); !errors.Is(err, ErrInvalidRead) {
+			t.Fatalf("version %d: unexpected err: %v", v, err)
+		}
+		if _, err := NewFromReader(bytes.NewReader(b.Bytes()), crypto.SHAKE128, v); err != nil {
+			t.Fatal(err)
+		}
+		ap, err := m.Get(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ap.Verify(crypto.SHAKE128, v, key, []byte("value"), m.Hash()); err != nil {
+			t.Fatal(err)
+		}
+		if err := ap.Verify(crypto.SHAKE128, other, key, []byte("value"), m.Hash()); err != ErrUnequalTreeHashes {
+			t.Fatalf("version %d: unexpected err: %v", v, err)
+		}
+	}
+	if bytes.Equal(roots[HashV1], roots[HashV2]) {
+		t.Fatal("versions give the same root")
+	}
+}
@@ -26,6 +26,7 @@ type userLeafNode struct {
 	node
 	value      []byte
 	index      []byte
+	key        []byte
 	commitment *crypto.Commit
 }
 
@@ -85,26 +86,15 @@ func (n *interiorNode) hash(m *MerkleTree) []byte {
 	if n.rightHash == nil {
 		n.rightHash = n.rightChild.hash(m)
 	}
-	return crypto.Digest(n.leftHash, n.rightHash)
+	return InteriorHash(m.suite, m.version, m.nonce, n.level, n.leftHash, n.rightHash)
 }
 
 func (n *userLeafNode) hash(m *MerkleTree) []byte {
-	return crypto.Digest(
-		[]byte{LeafIdentifier},               // K_leaf
-		[]byte(m.nonce),                      // K_n
-		[]byte(n.index),                      // i
-		[]byte(utils.UInt32ToBytes(n.level)), // l
-		[]byte(n.commitment.Value),           // commit(key|| value)
-	)
+	return LeafHash(m.suite, m.nonce, n.index, n.level, n.commitment.Value)
 }
 
 func (n *emptyNode) hash(m *MerkleTree) []byte {
-	return crypto.Digest(
-		[]byte{EmptyBranchIdentifier},        // K_empty
-		[]byte(m.nonce),                      // K_n
-		[]byte(n.index),                      // i
-		[]byte(utils.UInt32ToBytes(n.level)), // l
-	)
+	return EmptyHash(m.suite, m.nonce, n.index, n.level)
 }
 
 func (n *interiorNode) clone(parent *interiorNode) merkleNode {
@@ -134,6 +124,7 @@ func (n *userLeafNode) clone(parent *interiorNode) merkleNode {
 		},
 		value:      append([]byte{}, n.value...), // make a copy of value
 		index:      append([]byte{}, n.index...), // make a copy of index
+		key:        n.key,
 		commitment: n.commitment,
 	}
 }
@@ -240,8 +231,13 @@ func writeInteriorNode(writer io.Writer, in *interiorNode) error {
 }
 
 func writeLeafNode(writer io.Writer, ul *userLeafNode) error {
-	// Write the header.
-	if err := writeHeader(writer, []byte("L")); err != nil {
+	// Write the header. Leaves created before keys
+	// were stored have no key.
+	header := []byte("K")
+	if ul.key == nil {
+		header = []byte("L")
+	}
+	if err := writeHeader(writer, header); err != nil {
 		return err
 	}
 	// Write the level.
@@ -252,6 +248,12 @@ func writeLeafNode(writer io.Writer, ul *userLeafNode) error {
 	if err := writeIndex(writer, ul.index); err != nil {
 		return err
 	}
+	// Write the key.
+	if ul.key != nil {
+		if err := writeKey(writer, ul.key); err != nil {
+			return err
+		}
+	}
 	// Write the value.
 	if err := writeValue(writer, ul.value); err != nil {
 		return err
@@ -294,75 +296,25 @@ func nodeWrite(m *MerkleTree, n merkleNode, writer io.Writer) error {
 	return nil
 }
 
-func readBytes(reader io.Reader, b []byte) error {
-	n, err := reader.Read(b)
-	if err != nil {
-		return err
-	}
-	if n != len(b) {
-		if n != len(b) {
-			return fmt.Errorf("%w: expected %d, got %d", ErrInvalidRead, len(b), n)
-		}
-	}
-	return nil
-}
-
-func readArbitraryLengthBytes(reader io.Reader) ([]byte, error) {
-	lenBytes := make([]byte, 8)
-	if err := readBytes(reader, lenBytes); err != nil {
-		return nil, err
-	}
-	len := utils.BytesToLong(lenBytes)
-	contentBytes := make([]byte, len)
-	if err := readBytes(reader, contentBytes); err != nil {
-		return nil, err
-	}
-	return contentBytes, nil
-}
-
-func readHeader(reader io.Reader) ([]byte, error) {
-	header := make([]byte, 1)
-	if err := readBytes(reader, header); err != nil {
-		return nil, err
-	}
-	return header, nil
-}
-
-func readLevel(reader io.Reader) (uint32, error) {
-	levelBytes := make([]byte, 4)
-	if err := readBytes(reader, levelBytes); err != nil {
-		return 0, err
-	}
-	return utils.BytesToUInt32(levelBytes), nil
-}
-
-func readIndex(reader io.Reader) ([]byte, error) {
-	return readArbitraryLengthBytes(reader)
-}
-
-func readValue(reader io.Reader) ([]byte, error) {
-	return readArbitraryLengthBytes(reader)
-}
-
-func readCommitment(reader io.Reader) (*crypto.Commit, error) {
+func (s *boundedReader) readCommitment() (*crypto.Commit, error) {
 	// 32 bytes salt.
-	saltBytes := make([]byte, crypto.HashSizeByte)
-	if err := readBytes(reader, saltBytes); err != nil {
+	salt, err := s.read(crypto.HashSizeByte)
+	if err != nil {
 		return nil, err
 	}
 	// Value.
-	valueBytes, err := readArbitraryLengthBytes(reader)
+	value, err := s.readArbitraryLengthBytes()
 	if err != nil {
 		return nil, err
 	}
 	return &crypto.Commit{
-		Salt:  saltBytes,
-		Value: valueBytes,
+		Salt:  salt,
+		Value: value,
 	}, nil
 }
 
-func readInteriorNode(reader io.Reader) (*interiorNode, error) {
-	in, err := newMerkleNode(nil, reader)
+func readInteriorNode(s *boundedReader) (*interiorNode, error) {
+	in, err := newMerkleNode(nil, s)
 	if err != nil {
 		return nil, err
 	}
@@ -373,31 +325,39 @@ func readInteriorNode(reader io.Reader) (*interiorNode, error) {
 	return vin, nil
 }
 
-func newMerkleNode(parent merkleNode, reader io.Reader) (merkleNode, error) {
+func newMerkleNode(parent merkleNode, s *boundedReader) (merkleNode, error) {
 	// Read the header.
-	header, err := readHeader(reader)
+	header, err := s.read(1)
 	if err != nil {
 		return nil, err
 	}
 	switch {
-	case bytes.Equal([]byte("L"), header):
+	case bytes.Equal([]byte("L"), header), bytes.Equal([]byte("K"), header):
 		// Read the level.
-		level, err := readLevel(reader)
+		level, err := s.readLevel()
 		if err != nil {
 			return nil, err
 		}
 		// Read the index.
-		index, err := readIndex(reader)
+		index, err := s.readArbitraryLengthBytes()
 		if err != nil {
 			return nil, err
 		}
+		// Read the key.
+		var key []byte
+		if bytes.Equal([]byte("K"), header) {
+			key, err = s.readArbitraryLengthBytes()
+			if err != nil {
+				return nil, err
+			}
+		}
 		// Read the value.
-		value, err := readValue(reader)
+		value, err := s.readArbitraryLengthBytes()
 		if err != nil {
 			return nil, err
 		}
 		// Read the commitment.
-		commitment, err := readCommitment(reader)
+		commitment, err := s.readCommitment()
 		if err != nil {
 			return nil, err
 		}
@@ -408,12 +368,13 @@ func newMerkleNode(parent merkleNode, reader io.Reader) (merkleNode, error) {
 			},
 			value:      value,
 			index:      index,
+			key:        key,
 			commitment: commitment,
 		}, nil
 	case bytes.Equal([]byte("I"), header):
 		// Interior node.
 		// Read the level.
-		level, err := readLevel(reader)
+		level, err := s.readLevel()
 		if err != nil {
 			return nil, err
 		}
@@ -424,12 +385,12 @@ func newMerkleNode(parent merkleNode, reader io.Reader) (merkleNode, error) {
 			},
 		}
 		// Set the left child.
-		in.leftChild, err = newMerkleNode(in, reader)
+		in.leftChild, err = newMerkleNode(in, s)
 		if err != nil {
 			return nil, err
 		}
 		// Set the right child.
-		in.rightChild, err = newMerkleNode(in, reader)
+		in.rightChild, err = newMerkleNode(in, s)
 		if err != nil {
 			return nil, err
 		}
@@ -438,12 +399,12 @@ func newMerkleNode(parent merkleNode, reader io.Reader) (merkleNode, error) {
 	case bytes.Equal([]byte("E"), header):
 		// Empty node.
 		// Read the level.
-		level, err := readLevel(reader)
+		level, err := s.readLevel()
 		if err != nil {
 			return nil, err
 		}
 		// Read the index.
-		index, err := readIndex(reader)
+		index, err := s.readArbitraryLengthBytes()
 		if err != nil {
 			return nil, err
 		}
@@ -452,8 +413,8 @@ func newMerkleNode(parent merkleNode, reader io.Reader) (merkleNode, error) {
 				parent: parent,
 				level:  level,
 			},
-			index: append([]byte{}, index...), // make a copy of index
+			index: index,
 		}, nil
 	}
-	panic("unreachable")
+	return nil, fmt.Errorf("%w: invalid node header %q", ErrInvalidRead, header)
 }
@@ -3,6 +3,7 @@ package merkletree
 import (
 	"bytes"
 	"errors"
+	"fmt"
 
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/utils"
@@ -36,25 +37,13 @@ type ProofNode struct {
 	Commitment *crypto.Commit
 }
 
-func (n *ProofNode) hash(treeNonce []byte) []byte {
+func (n *ProofNode) hash(h crypto.Hash, treeNonce []byte) []byte {
 	if n.IsEmpty {
 		// empty leaf node
-		return crypto.Digest(
-			[]byte{EmptyBranchIdentifier},        // K_empty
-			[]byte(treeNonce),                    // K_n
-			[]byte(n.Index),                      // i
-			[]byte(utils.UInt32ToBytes(n.Level)), // l
-		)
-	} else {
-		// user leaf node
-		return crypto.Digest(
-			[]byte{LeafIdentifier},               // K_leaf
-			[]byte(treeNonce),                    // K_n
-			[]byte(n.Index),                      // i
-			[]byte(utils.UInt32ToBytes(n.Level)), // l
-			[]byte(n.Commitment.Value),           // commit(key|| value)
-		)
+		return EmptyHash(h, treeNonce, n.Index, n.Level)
 	}
+	// user leaf node
+	return LeafHash(h, treeNonce, n.Index, n.Level, n.Commitment.Value)
 }
 
 // A ProofType indicates whether an AuthenticationPath is
@@ -81,16 +70,16 @@ type AuthenticationPath struct {
 	proofType   ProofType
 }
 
-func (ap *AuthenticationPath) authPathHash() []byte {
-	hash := ap.Leaf.hash(ap.TreeNonce)
+func (ap *AuthenticationPath) authPathHash(h crypto.Hash, v HashVersion) []byte {
+	hash := ap.Leaf.hash(h, ap.TreeNonce)
 	indexBits := utils.ToBits(ap.Leaf.Index)
 	depth := ap.Leaf.Level
 	for depth > 0 {
 		depth -= 1
 		if indexBits[depth] { // right child
-			hash = crypto.Digest(ap.PrunedTree[depth][:], hash)
+			hash = InteriorHash(h, v, ap.TreeNonce, depth, ap.PrunedTree[depth][:], hash)
 		} else {
-			hash = crypto.Digest(hash, ap.PrunedTree[depth][:])
+			hash = InteriorHash(h, v, ap.TreeNonce, depth, hash, ap.PrunedTree[depth][:])
 		}
 	}
 	return hash
@@ -101,12 +90,15 @@ func (ap *AuthenticationPath) authPathHash() []byte {
 // first l bits with l is the Level of the proof node if ap is
 // a proof of absence. It also verifies the value and
 // the commitment (in case of the proof of inclusion).
-// Finally, it recomputes the tree's root node from ap,
-// and compares it to treeHash, which is taken from a STR.
+// Finally, it recomputes the tree's root node from ap using the hash h
+// and version v, and compares it to treeHash, which is taken from a STR.
 // Specifically, treeHash has to come from the STR whose tree returns ap.
 //
 // This should be called after the VRF index is verified successfully.
-func (ap *AuthenticationPath) Verify(key, value, treeHash []byte) error {
+func (ap *AuthenticationPath) Verify(h crypto.Hash, v HashVersion, key, value, treeHash []byte) error {
+	if err := checkSuites(h, v); err != nil {
+		return err
+	}
 	if ap.ProofType() == ProofOfExclusion {
 		// Check if i and j match in the first l bits
 		indexBits := utils.ToBits(ap.Leaf.Index)
@@ -122,21 +114,83 @@ func (ap *AuthenticationPath) Verify(key, value, treeHash []byte) error {
 			return ErrBindingsDiffer
 		}
 	} else {
+		if ap.Leaf.IsEmpty || ap.Leaf.Commitment == nil {
+			return ErrUnverifiableCommitment
+		}
 		// Verify the key-value binding returned in the ProofNode
 		if !bytes.Equal(ap.Leaf.Value, value) {
 			return ErrBindingsDiffer
 		}
-		if !ap.Leaf.Commitment.Verify(key, value) {
+		if !ap.Leaf.Commitment.Verify(h, key, value) {
 			return ErrUnverifiableCommitment
 		}
 	}
 
-	if !bytes.Equal(treeHash, ap.authPathHash()) {
+	if !bytes.Equal(treeHash, ap.authPathHash(h, v)) {
+		return ErrUnequalTreeHashes
+	}
+	return nil
+}
+
+// Membership returns a copy of ap, a proof of inclusion, without the
+// value and the salt of the leaf. It proves that the lookup index is
+// bound to a commitment in the tree without disclosing the value.
+func (ap *AuthenticationPath) Membership() (*AuthenticationPath, error) {
+	if ap.ProofType() != ProofOfInclusion || ap.Leaf.Commitment == nil {
+		return nil, ErrUnverifiableCommitment
+	}
+	leaf := *ap.Leaf
+	leaf.Value = nil
+	leaf.Commitment = &crypto.Commit{
+		Value: ap.Leaf.Commitment.Value,
+	}
+	return &AuthenticationPath{
+		TreeNonce:   ap.TreeNonce,
+		PrunedTree:  ap.PrunedTree,
+		LookupIndex: ap.LookupIndex,
+		Leaf:        &leaf,
+		proofType:   ProofOfInclusion,
+	}, nil
+}
+
+// VerifyMembership verifies that ap, a proof of inclusion with or
+// without its value, binds the lookup index to a commitment in the
+// tree hashed with h and version v whose root is treeHash. The committed
+// value is not checked: use VerifyOpening to check a value disclosed later.
+//
+// This should be called after the VRF index is verified successfully.
+func (ap *AuthenticationPath) VerifyMembership(h crypto.Hash, v HashVersion, treeHash []byte) error {
+	if err := checkSuites(h, v); err != nil {
+		return err
+	}
+	if ap.ProofType() != ProofOfInclusion {
+		return ErrIndicesMismatch
+	}
+	if ap.Leaf.IsEmpty || ap.Leaf.Commitment == nil {
+		return ErrUnverifiableCommitment
+	}
+	if !bytes.Equal(treeHash, ap.authPathHash(h, v)) {
 		return ErrUnequalTreeHashes
 	}
 	return nil
 }
 
+// VerifyOpening verifies ap like VerifyMembership, and that its
+// commitment opens to key and value with salt.
+func (ap *AuthenticationPath) VerifyOpening(h crypto.Hash, v HashVersion, key, value, salt, treeHash []byte) error {
+	if err := ap.VerifyMembership(h, v, treeHash); err != nil {
+		return err
+	}
+	c := crypto.Commit{
+		Salt:  salt,
+		Value: ap.Leaf.Commitment.Value,
+	}
+	if !c.Verify(h, key, value) {
+		return ErrUnverifiableCommitment
+	}
+	return nil
+}
+
 // ProofType returns the type of ap. It does a comparison
 // between the leaf index and the lookup index to determine
 // the proof type, and sets ap's proof type the first time this
@@ -151,3 +205,115 @@ func (ap *AuthenticationPath) ProofType() ProofType {
 	}
 	return ap.proofType
 }
+
+// MarshalBinary encodes ap.
+func (ap *AuthenticationPath) MarshalBinary() ([]byte, error) {
+	if ap.Leaf == nil {
+		return nil, fmt.Errorf("%w: no leaf", ErrInvalidWrite)
+	}
+	b := appendArbitraryLengthBytes(nil, ap.TreeNonce)
+	b = append(b, utils.UInt32ToBytes(uint32(len(ap.PrunedTree)))...)
+	for _, h := range ap.PrunedTree {
+		b = append(b, h[:]...)
+	}
+	b = appendArbitraryLengthBytes(b, ap.LookupIndex)
+	b = append(b, utils.UInt32ToBytes(ap.Leaf.Level)...)
+	b = appendArbitraryLengthBytes(b, ap.Leaf.Index)
+	b = appendOptionalBytes(b, ap.Leaf.Value)
+	if ap.Leaf.IsEmpty {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+	if ap.Leaf.Commitment == nil {
+		return append(b, 0), nil
+	}
+	b = append(b, 1)
+	b = appendOptionalBytes(b, ap.Leaf.Commitment.Salt)
+	return appendArbitraryLengthBytes(b, ap.Leaf.Commitment.Value), nil
+}
+
+// UnmarshalBinary decodes data into ap.
+func (ap *AuthenticationPath) UnmarshalBinary(data []byte) error {
+	r := &boundedReader{data: data}
+	nonce, err := r.readArbitraryLengthBytes()
+	if err != nil {
+		return err
+	}
+	n, err := r.readLevel()
+	if err != nil {
+		return err
+	}
+	if int(n) > (len(data)-r.offset)/crypto.HashSizeByte {
+		return fmt.Errorf("%w: invalid pruned tree size %d", ErrInvalidRead, n)
+	}
+	prunedTree := make([][crypto.HashSizeByte]byte, n)
+	for i := range prunedTree {
+		h, err := r.read(crypto.HashSizeByte)
+		if err != nil {
+			return err
+		}
+		copy(prunedTree[i][:], h)
+	}
+	lookupIndex, err := r.readArbitraryLengthBytes()
+	if err != nil {
+		return err
+	}
+	leaf := new(ProofNode)
+	if leaf.Level, err = r.readLevel(); err != nil {
+		return err
+	}
+	if leaf.Index, err = r.readArbitraryLengthBytes(); err != nil {
+		return err
+	}
+	if leaf.Value, err = r.readOptionalBytes(); err != nil {
+		return err
+	}
+	if leaf.IsEmpty, err = readBool(r); err != nil {
+		return err
+	}
+	hasCommitment, err := readBool(r)
+	if err != nil {
+		return err
+	}
+	if hasCommitment {
+		leaf.Commitment = new(crypto.Commit)
+		if leaf.Commitment.Salt, err = r.readOptionalBytes(); err != nil {
+			return err
+		}
+		if leaf.Commitment.Value, err = r.readArbitraryLengthBytes(); err != nil {
+			return err
+		}
+	}
+	if err := r.done(); err != nil {
+		return err
+	}
+	if leaf.Level > uint32(len(prunedTree)) || int(leaf.Level) > 8*len(leaf.Index) ||
+		int(leaf.Level) > 8*len(lookupIndex) {
+		return fmt.Errorf("%w: invalid level %d", ErrInvalidRead, leaf.Level)
+	}
+	if !leaf.IsEmpty && leaf.Commitment == nil {
+		return fmt.Errorf("%w: no commitment", ErrInvalidRead)
+	}
+	*ap = AuthenticationPath{
+		TreeNonce:   nonce,
+		PrunedTree:  prunedTree,
+		LookupIndex: lookupIndex,
+		Leaf:        leaf,
+	}
+	return nil
+}
+
+func readBool(r *boundedReader) (bool, error) {
+	b, err := r.read(1)
+	if err != nil {
+		return false, err
+	}
+	switch b[0] {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	}
+	return false, fmt.Errorf("%w: invalid boolean %d", ErrInvalidRead, b[0])
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/utils"
 )
 
@@ -96,7 +97,7 @@ func TestVerifyProof(t *testing.T) {
 		if got, want := proof.ProofType(), tt.want; got != want {
 			t.Error("TestVerifyProof() failed with tuple(", tt.key, tt.value, ")")
 		}
-		if proof.Verify([]byte(tt.key), tt.value, m.hash) != nil {
+		if proof.Verify(crypto.SHAKE128, HashV2, []byte(tt.key), tt.value, m.hash) != nil {
 			t.Error("TestVerifyProof() failed with tuple(", tt.key, tt.value, ")")
 		}
 	}
@@ -115,20 +116,20 @@ func TestProofVerificationErrors(t *testing.T) {
 	}
 	// - ErrBindingsDiffer
 	proof1.Leaf.Value[0] += 1
-	if err := proof1.Verify([]byte(key), value, m.hash); err != ErrBindingsDiffer {
+	if err := proof1.Verify(crypto.SHAKE128, HashV2, []byte(key), value, m.hash); err != ErrBindingsDiffer {
 		t.Error("Expect", ErrBindingsDiffer, "got", err)
 	}
 	// - ErrUnverifiableCommitment
 	proof1.Leaf.Value[0] -= 1
 	proof1.Leaf.Commitment.Salt[0] += 1
-	if err := proof1.Verify([]byte(key), value, m.hash); err != ErrUnverifiableCommitment {
+	if err := proof1.Verify(crypto.SHAKE128, HashV2, []byte(key), value, m.hash); err != ErrUnverifiableCommitment {
 		t.Error("Expect", ErrUnverifiableCommitment, "got", err)
 	}
 	// ErrUnequalTreeHashes
 	hash := append([]byte{}, m.hash...)
 	hash[0] += 1
 	proof1.Leaf.Commitment.Salt[0] -= 1
-	if err := proof1.Verify([]byte(key), value, hash); err != ErrUnequalTreeHashes {
+	if err := proof1.Verify(crypto.SHAKE128, HashV2, []byte(key), value, hash); err != ErrUnequalTreeHashes {
 		t.Error("Expect", ErrUnequalTreeHashes, "got", err)
 	}
 
@@ -141,13 +142,111 @@ func TestProofVerificationErrors(t *testing.T) {
 	}
 	// - ErrBindingsDiffer
 	proof2.Leaf.Value = make([]byte, 1)
-	if err := proof2.Verify([]byte(key), value, m.hash); err != ErrBindingsDiffer {
+	if err := proof2.Verify(crypto.SHAKE128, HashV2, []byte(key), value, m.hash); err != ErrBindingsDiffer {
 		t.Error("Expect", ErrBindingsDiffer, "got", err)
 	}
 	// - ErrIndicesMismatch
 	proof2.Leaf.Value = nil
 	proof2.Leaf.Index[0] &= 0x01
-	if err := proof2.Verify([]byte(key), value, m.hash); err != ErrIndicesMismatch {
+	if err := proof2.Verify(crypto.SHAKE128, HashV2, []byte(key), value, m.hash); err != ErrIndicesMismatch {
+		t.Error("Expect", ErrIndicesMismatch, "got", err)
+	}
+}
+
+func TestProofMarshalBinary(t *testing.T) {
+	m, tests := setupTestProofs(t)
+
+	for _, tt := range tests {
+		proof, err := m.Get(tt.index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := proof.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got AuthenticationPath
+		if err := got.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+		if got.ProofType() != tt.want {
+			t.Error("TestProofMarshalBinary() failed with tuple(", tt.key, tt.value, ")")
+		}
+		if err := got.Verify(crypto.SHAKE128, HashV2, tt.key, tt.value, m.hash); err != nil {
+			t.Error("TestProofMarshalBinary() failed with tuple(", tt.key, tt.value, "):", err)
+		}
+		// Truncated or extended encodings are rejected.
+		if err := got.UnmarshalBinary(b[:len(b)-1]); err == nil {
+			t.Error("expected error for truncated proof")
+		}
+		if err := got.UnmarshalBinary(append(b, 0)); err == nil {
+			t.Error("expected error for trailing data")
+		}
+	}
+}
+
+func TestMembershipProof(t *testing.T) {
+	m, tuple := setupTestProofs(t)
+
+	index, key, value := tuple[0].index, tuple[0].key, tuple[0].value
+	full, err := m.Get(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := append([]byte{}, full.Leaf.Commitment.Salt...)
+	proof, err := full.Membership()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proof.Leaf.Value != nil || proof.Leaf.Commitment.Salt != nil {
+		t.Fatal("membership proof discloses the value")
+	}
+	// Round trip the encoding.
+	b, err := proof.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got AuthenticationPath
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := got.VerifyMembership(crypto.SHAKE128, HashV2, m.hash); err != nil {
+		t.Fatal(err)
+	}
+	if err := got.VerifyOpening(crypto.SHAKE128, HashV2, key, value, salt, m.hash); err != nil {
+		t.Fatal(err)
+	}
+	// A full proof also proves membership.
+	if err := full.VerifyMembership(crypto.SHAKE128, HashV2, m.hash); err != nil {
+		t.Fatal(err)
+	}
+	// But a membership proof is not a proof of inclusion of a value.
+	if err := got.Verify(crypto.SHAKE128, HashV2, key, value, m.hash); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Wrong openings.
+	if err := got.VerifyOpening(crypto.SHAKE128, HashV2, key, append(value, 0), salt, m.hash); err != ErrUnverifiableCommitment {
+		t.Error("Expect", ErrUnverifiableCommitment, "got", err)
+	}
+	if err := got.VerifyOpening(crypto.SHAKE128, HashV2, tuple[1].key, value, salt, m.hash); err != ErrUnverifiableCommitment {
+		t.Error("Expect", ErrUnverifiableCommitment, "got", err)
+	}
+	hash := append([]byte{}, m.hash...)
+	hash[0] += 1
+	if err := got.VerifyMembership(crypto.SHAKE128, HashV2, hash); err != ErrUnequalTreeHashes {
+		t.Error("Expect", ErrUnequalTreeHashes, "got", err)
+	}
+
+	// Proofs of exclusion do not prove membership.
+	absent, err := m.Get(tuple[N].index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := absent.Membership(); err == nil {
+		t.Error("expected error")
+	}
+	if err := absent.VerifyMembership(crypto.SHAKE128, HashV2, m.hash); err != ErrIndicesMismatch {
 		t.Error("Expect", ErrIndicesMismatch, "got", err)
 	}
 }
@@ -0,0 +1,92 @@
+package merkletree
+
+import (
+	"bytes"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/utils"
+)
+
+const (
+	// ShardIdentifier is the domain separation prefix for
+	// shard roots in a root of roots.
+	ShardIdentifier = 'S'
+
+	// RootsIdentifier is the domain separation prefix for
+	// interior nodes of a root of roots.
+	RootsIdentifier = 'R'
+)
+
+// RootOfRoots binds the roots of several trees together, using the
+// hash h. The roots are the leaves of a complete binary tree, so their
+// number must be a power of two.
+func RootOfRoots(h crypto.Hash, roots [][]byte) []byte {
+	level := make([][]byte, len(roots))
+	for i, r := range roots {
+		level[i] = shardHash(h, uint32(i), r)
+	}
+	for len(level) > 1 {
+		next := make([][]byte, len(level)/2)
+		for i := range next {
+			next[i] = rootsHash(h, level[2*i], level[2*i+1])
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// RootsPath returns the siblings of roots[i] in the root of roots,
+// from the leaf up.
+func RootsPath(h crypto.Hash, roots [][]byte, i uint32) [][crypto.HashSizeByte]byte {
+	level := make([][]byte, len(roots))
+	for j, r := range roots {
+		level[j] = shardHash(h, uint32(j), r)
+	}
+	var path [][crypto.HashSizeByte]byte
+	for len(level) > 1 {
+		var sibling [crypto.HashSizeByte]byte
+		copy(sibling[:], level[i^1])
+		path = append(path, sibling)
+		next := make([][]byte, len(level)/2)
+		for j := range next {
+			next[j] = rootsHash(h, level[2*j], level[2*j+1])
+		}
+		level = next
+		i /= 2
+	}
+	return path
+}
+
+// VerifyRootsPath verifies that root is the i-th of n roots
+// bound by rootOfRoots.
+func VerifyRootsPath(h crypto.Hash, rootOfRoots, root []byte, i, n uint32, path [][crypto.HashSizeByte]byte) bool {
+	if !h.Available() || i >= n || 1<<len(path) != n {
+		return false
+	}
+	hash := shardHash(h, i, root)
+	for _, sibling := range path {
+		if i%2 == 1 {
+			hash = rootsHash(h, sibling[:], hash)
+		} else {
+			hash = rootsHash(h, hash, sibling[:])
+		}
+		i /= 2
+	}
+	return bytes.Equal(rootOfRoots, hash)
+}
+
+func shardHash(h crypto.Hash, i uint32, root []byte) []byte {
+	return h.Digest(
+		[]byte{ShardIdentifier},        // K_shard
+		[]byte(utils.UInt32ToBytes(i)), // i
+		root,                           // root of shard i
+	)
+}
+
+func rootsHash(h crypto.Hash, left, right []byte) []byte {
+	return h.Digest(
+		[]byte{RootsIdentifier}, // K_roots
+		left,
+		right,
+	)
+}
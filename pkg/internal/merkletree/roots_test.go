@@ -0,0 +1,29 @@
+package merkletree
+
+import (
+	"testing"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
+)
+
+func TestRootOfRoots(t *testing.T) {
+	for _, n := range []uint32{1, 2, 8} {
+		roots := make([][]byte, n)
+		for i := range roots {
+			roots[i] = crypto.Digest([]byte{byte(i)})
+		}
+		root := RootOfRoots(crypto.SHAKE128, roots)
+		for i := uint32(0); i < n; i++ {
+			path := RootsPath(crypto.SHAKE128, roots, i)
+			if !VerifyRootsPath(crypto.SHAKE128, root, roots[i], i, n, path) {
+				t.Fatalf("%d roots: cannot verify root %d", n, i)
+			}
+			if n > 1 && VerifyRootsPath(crypto.SHAKE128, root, roots[i], (i+1)%n, n, path) {
+				t.Fatalf("%d roots: root %d verified at another position", n, i)
+			}
+			if VerifyRootsPath(crypto.SHAKE128, root, roots[i], i, 2*n, path) {
+				t.Fatalf("%d roots: root %d verified with another count", n, i)
+			}
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package merkletree
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/utils"
+)
+
+// DiscardedLeaf is a leaf that was read from a damaged
+// tree but could not be trusted.
+type DiscardedLeaf struct {
+	Index  []byte
+	Reason string
+}
+
+// SalvageResult describes what was recovered from a damaged tree.
+type SalvageResult struct {
+	// Tree is a fresh tree containing the intact leaves.
+	Tree *MerkleTree
+	// StoredHash is the root hash stored in the damaged tree,
+	// or nil if it could not be read.
+	StoredHash []byte
+	// NonceRecovered is true if the tree nonce could be read.
+	// If false, Tree uses a new random nonce.
+	NonceRecovered bool
+	// Recovered is the number of intact leaves.
+	Recovered uint64
+	// Discarded are the leaves read but not trusted.
+	Discarded []DiscardedLeaf
+	// Offset is the number of bytes walked.
+	Offset int64
+	// Err is the error that stopped the walk, or nil
+	// if the whole node stream was read.
+	Err error
+}
+
+// Salvage walks the serialized tree in data as far as it can, and
+// collects the leaves that are intact. A leaf is intact if it is
+// fully read, its level and index are consistent with its position
+// in the tree and, if the leaf stores its key, its commitment opens
+// to its key and value. It returns a fresh tree with these leaves. The nonce
+// of the damaged tree is re-used if it can be read, so that an
+// undamaged tree yields the same root. The tree must be hashed with h
+// and version v.
+func Salvage(data []byte, h crypto.Hash, v HashVersion) (*SalvageResult, error) {
+	if err := checkSuites(h, v); err != nil {
+		return nil, err
+	}
+	s := &salvager{boundedReader: boundedReader{data: data}, suite: h}
+	res := &SalvageResult{}
+	nonce, err := s.read(crypto.HashSizeByte)
+	if err == nil {
+		res.NonceRecovered = true
+		res.StoredHash, err = s.read(crypto.HashSizeByte)
+	}
+	if err == nil {
+		err = s.walk(0, make([]bool, 0, maxDepth))
+	}
+	if err == nil {
+		err = s.done()
+	}
+	res.Err = err
+	res.Offset = int64(s.offset)
+	res.Discarded = s.discarded
+
+	if !res.NonceRecovered {
+		nonce, err = crypto.MakeRand()
+		if err != nil {
+			return nil, err
+		}
+	}
+	m := &MerkleTree{
+		suite:   h,
+		version: v,
+		nonce:   append([]byte{}, nonce...),
+		root:    newInteriorNode(nil, 0, []bool{}),
+		dirty:   true,
+	}
+	for _, l := range s.leaves {
+		m.insertNode(l.index, l)
+	}
+	res.Tree = m
+	res.Recovered = uint64(len(s.leaves))
+	return res, nil
+}
+
+// salvager reads a serialized tree with bound checks,
+// so that corrupted lengths are reported as errors.
+type salvager struct {
+	boundedReader
+	suite     crypto.Hash
+	leaves    []*userLeafNode
+	seen      map[string]bool
+	discarded []DiscardedLeaf
+}
+
+func (s *salvager) discard(index []byte, format string, args ...interface{}) {
+	s.discarded = append(s.discarded, DiscardedLeaf{
+		Index:  index,
+		Reason: fmt.Sprintf(format, args...),
+	})
+}
+
+// maxDepth is the depth of the deepest interior node of a valid
+// tree, whose children are told apart by the last bit of their
+// indexes.
+const maxDepth = 8 * crypto.HashSizeByte
+
+// walk reads the node at the given depth, whose path from the root
+// is prefix. The walk shares the backing array of prefix, whose
+// capacity is maxDepth, so that children do not copy it.
+func (s *salvager) walk(depth uint32, prefix []bool) error {
+	header, err := s.read(1)
+	if err != nil {
+		return err
+	}
+	switch {
+	case bytes.Equal([]byte("I"), header):
+		if depth >= maxDepth {
+			return fmt.Errorf("%w: interior node deeper than %d at offset %d", ErrInvalidRead, maxDepth, s.offset-1)
+		}
+		if _, err := s.readLevel(); err != nil {
+			return err
+		}
+		// The children's positions are given by the walk,
+		// so a wrong level is not fatal.
+		if err := s.walk(depth+1, append(prefix, false)); err != nil {
+			return err
+		}
+		return s.walk(depth+1, append(prefix, true))
+	case bytes.Equal([]byte("E"), header):
+		if _, err := s.readLevel(); err != nil {
+			return err
+		}
+		// Empty nodes are re-created when the tree is rebuilt.
+		_, err := s.readArbitraryLengthBytes()
+		return err
+	case bytes.Equal([]byte("L"), header), bytes.Equal([]byte("K"), header):
+		level, err := s.readLevel()
+		if err != nil {
+			return err
+		}
+		index, err := s.readArbitraryLengthBytes()
+		if err != nil {
+			return err
+		}
+		var key []byte
+		if header[0] == 'K' {
+			key, err = s.readArbitraryLengthBytes()
+			if err != nil {
+				return err
+			}
+		}
+		value, err := s.readArbitraryLengthBytes()
+		if err != nil {
+			return err
+		}
+		salt, err := s.read(crypto.HashSizeByte)
+		if err != nil {
+			return err
+		}
+		commitment, err := s.readArbitraryLengthBytes()
+		if err != nil {
+			return err
+		}
+		s.addLeaf(depth, prefix, &userLeafNode{
+			node: node{
+				level: level,
+			},
+			value: value,
+			index: index,
+			key:   key,
+			commitment: &crypto.Commit{
+				Salt:  salt,
+				Value: commitment,
+			},
+		})
+		return nil
+	}
+	return fmt.Errorf("%w: invalid node header %q at offset %d", ErrInvalidRead, header, s.offset-1)
+}
+
+func (s *salvager) addLeaf(depth uint32, prefix []bool, l *userLeafNode) {
+	if l.level != depth {
+		s.discard(l.index, "level %d at depth %d", l.level, depth)
+		return
+	}
+	if int(depth) > 8*len(l.index) {
+		s.discard(l.index, "index too short for depth %d", depth)
+		return
+	}
+	indexBits := utils.ToBits(l.index)
+	for i := range prefix {
+		if indexBits[i] != prefix[i] {
+			s.discard(l.index, "index does not match its position in the tree")
+			return
+		}
+	}
+	if len(l.commitment.Value) != crypto.HashSizeByte {
+		s.discard(l.index, "invalid commitment size %d", len(l.commitment.Value))
+		return
+	}
+	// Leaves that store their key can be checked against
+	// their commitment.
+	if l.key != nil && !l.commitment.Verify(s.suite, l.key, l.value) {
+		s.discard(l.index, "commitment does not match key and value")
+		return
+	}
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	if s.seen[string(l.index)] {
+		s.discard(l.index, "duplicate index")
+		return
+	}
+	s.seen[string(l.index)] = true
+	s.leaves = append(s.leaves, l)
+}
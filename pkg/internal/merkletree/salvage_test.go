@@ -0,0 +1,139 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/utils"
+)
+
+// leafOffsets returns the offset of each leaf in the serialized tree.
+func leafOffsets(t *testing.T, m *MerkleTree) []int {
+	offset := 2 * len(m.nonce)
+	var offsets []int
+	var walk func(n merkleNode)
+	walk = func(n merkleNode) {
+		var b bytes.Buffer
+		var err error
+		switch v := n.(type) {
+		case *interiorNode:
+			err = writeInteriorNode(&b, v)
+		case *emptyNode:
+			err = writeEmptyNode(&b, v)
+		case *userLeafNode:
+			offsets = append(offsets, offset)
+			err = writeLeafNode(&b, v)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset += b.Len()
+		if v, ok := n.(*interiorNode); ok {
+			walk(v.leftChild)
+			walk(v.rightChild)
+		}
+	}
+	walk(m.root)
+	return offsets
+}
+
+func TestSalvage(t *testing.T) {
+	m := newEmptyTreeForTest(t)
+	for i := 0; i < 10; i++ {
+		key := []byte{byte(i)}
+		if err := m.Set(staticVRFKey.Compute(key), key, []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var b bytes.Buffer
+	if err := m.WriteInternal(&b); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+	offsets := leafOffsets(t, m)
+	if len(offsets) != 10 {
+		t.Fatalf("found %d leaves", len(offsets))
+	}
+
+	// Intact tree.
+	res, err := Salvage(data, crypto.SHAKE128, HashV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Err != nil || res.Recovered != 10 || len(res.Discarded) != 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if !bytes.Equal(res.Tree.Hash(), m.Hash()) {
+		t.Fatal("hash mismatch")
+	}
+
+	// Flip a bit in the level of the first leaf.
+	flipped := append([]byte{}, data...)
+	flipped[offsets[0]+1] ^= 0x01
+	res, err = Salvage(flipped, crypto.SHAKE128, HashV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Err != nil || res.Recovered != 9 || len(res.Discarded) != 1 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if !bytes.Equal(res.StoredHash, m.Hash()) {
+		t.Fatal("stored hash mismatch")
+	}
+
+	// Flip a bit in the header of the last leaf: the walk stops.
+	flipped = append([]byte{}, data...)
+	flipped[offsets[9]] ^= 0x80
+	res, err = Salvage(flipped, crypto.SHAKE128, HashV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Err == nil || res.Recovered != 9 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	// Truncate in the middle of the nonce: a new nonce is used.
+	res, err = Salvage(data[:10], crypto.SHAKE128, HashV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Err == nil || res.NonceRecovered || res.Recovered != 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	// A corrupted length does not allocate.
+	flipped = append([]byte{}, data...)
+	copy(flipped[offsets[0]+5:], utils.LongToBytes(1<<60))
+	res, err = Salvage(flipped, crypto.SHAKE128, HashV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Err == nil || res.Recovered != 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+}
+
+func TestSalvageDepth(t *testing.T) {
+	m := newEmptyTreeForTest(t)
+	var b bytes.Buffer
+	if err := m.WriteInternal(&b); err != nil {
+		t.Fatal(err)
+	}
+	// A stream of interior nodes deeper than any valid tree.
+	data := append([]byte{}, b.Bytes()[:2*crypto.HashSizeByte]...)
+	for i := 0; i < 100000; i++ {
+		data = append(data, 'I', 0, 0, 0, 0)
+	}
+	res, err := Salvage(data, crypto.SHAKE128, HashV2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(res.Err, ErrInvalidRead) || res.Offset != int64(2*crypto.HashSizeByte+5*maxDepth+1) {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if !bytes.Equal(res.Tree.Hash(), m.Hash()) {
+		t.Fatal("hash mismatch")
+	}
+}
@@ -0,0 +1,231 @@
+// Package note implements the signed notes of the Go checksum
+// database, https://c2sp.org/signed-note, with Ed25519 signatures
+// and the witness cosignatures of https://c2sp.org/tlog-cosignature.
+package note
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Signature algorithms of notes.
+const (
+	AlgEd25519       = 0x01
+	AlgCosignatureV1 = 0x04
+)
+
+var (
+	// ErrMalformedNote indicates a note is not well formed.
+	ErrMalformedNote = errors.New("[note] malformed note")
+	// ErrMalformedKey indicates a key is not well formed.
+	ErrMalformedKey = errors.New("[note] malformed key")
+)
+
+// signaturePrefix starts the signature lines.
+const signaturePrefix = "— "
+
+// Signature is a signature line of a note.
+type Signature struct {
+	// Name is the name of the key.
+	Name string
+	// Hash identifies the key.
+	Hash uint32
+	// Value is the signature, without the key hash.
+	Value []byte
+}
+
+// Note is a text with signatures.
+type Note struct {
+	// Text ends with a newline.
+	Text       string
+	Signatures []Signature
+}
+
+// KeyHash returns the hash identifying the key of name
+// and algorithm alg.
+func KeyHash(name string, alg byte, public []byte) uint32 {
+	h := sha256.New()
+	h.Write([]byte(name))
+	h.Write([]byte{'\n', alg})
+	h.Write(public)
+	return binary.BigEndian.Uint32(h.Sum(nil))
+}
+
+func validName(name string) bool {
+	return name != "" && utf8.ValidString(name) &&
+		strings.IndexFunc(name, unicode.IsSpace) < 0 && !strings.Contains(name, "+")
+}
+
+// VerifierKey returns the encoding of the public key
+// of name and algorithm alg.
+func VerifierKey(name string, alg byte, public ed25519.PublicKey) (string, error) {
+	if !validName(name) {
+		return "", fmt.Errorf("%w: name %q", ErrMalformedKey, name)
+	}
+	return fmt.Sprintf("%s+%08x+%s", name, KeyHash(name, alg, public),
+		base64.StdEncoding.EncodeToString(append([]byte{alg}, public...))), nil
+}
+
+// ParseVerifierKey parses a key encoded by VerifierKey.
+func ParseVerifierKey(s string) (name string, alg byte, public ed25519.PublicKey, err error) {
+	// The encoded key may contain '+'.
+	name, rest, ok1 := strings.Cut(s, "+")
+	hash, key, ok2 := strings.Cut(rest, "+")
+	if !ok1 || !ok2 || !validName(name) || len(hash) != 8 {
+		return "", 0, nil, ErrMalformedKey
+	}
+	h, err := hex.DecodeString(hash)
+	if err != nil {
+		return "", 0, nil, ErrMalformedKey
+	}
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(b) != 1+ed25519.PublicKeySize {
+		return "", 0, nil, ErrMalformedKey
+	}
+	alg, public = b[0], b[1:]
+	if alg != AlgEd25519 && alg != AlgCosignatureV1 {
+		return "", 0, nil, fmt.Errorf("%w: algorithm %d", ErrMalformedKey, alg)
+	}
+	if KeyHash(name, alg, public) != binary.BigEndian.Uint32(h) {
+		return "", 0, nil, fmt.Errorf("%w: key hash", ErrMalformedKey)
+	}
+	return name, alg, public, nil
+}
+
+// Parse parses a note. It does not verify its signatures.
+func Parse(b []byte) (*Note, error) {
+	if !utf8.Valid(b) {
+		return nil, fmt.Errorf("%w: invalid UTF-8", ErrMalformedNote)
+	}
+	s := string(b)
+	i := strings.LastIndex(s, "\n\n")
+	if i < 0 || !strings.HasSuffix(s, "\n") {
+		return nil, fmt.Errorf("%w: no signatures", ErrMalformedNote)
+	}
+	n := &Note{Text: s[:i+1]}
+	if strings.IndexFunc(n.Text, func(r rune) bool {
+		return r != '\n' && unicode.IsControl(r)
+	}) >= 0 {
+		return nil, fmt.Errorf("%w: control character", ErrMalformedNote)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(s[i+2:], "\n"), "\n") {
+		rest, ok := strings.CutPrefix(line, signaturePrefix)
+		if !ok {
+			return nil, fmt.Errorf("%w: signature line %q", ErrMalformedNote, line)
+		}
+		name, value, ok := strings.Cut(rest, " ")
+		if !ok || !validName(name) {
+			return nil, fmt.Errorf("%w: signature line %q", ErrMalformedNote, line)
+		}
+		v, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(v) < 5 {
+			return nil, fmt.Errorf("%w: signature line %q", ErrMalformedNote, line)
+		}
+		n.Signatures = append(n.Signatures, Signature{
+			Name:  name,
+			Hash:  binary.BigEndian.Uint32(v),
+			Value: v[4:],
+		})
+	}
+	return n, nil
+}
+
+// Marshal returns the encoding of the note.
+func (n *Note) Marshal() ([]byte, error) {
+	if !strings.HasSuffix(n.Text, "\n") || strings.Contains(n.Text, "\n\n") {
+		return nil, fmt.Errorf("%w: text", ErrMalformedNote)
+	}
+	if len(n.Signatures) == 0 {
+		return nil, fmt.Errorf("%w: no signatures", ErrMalformedNote)
+	}
+	var b bytes.Buffer
+	b.WriteString(n.Text)
+	b.WriteString("\n")
+	for _, sig := range n.Signatures {
+		v := binary.BigEndian.AppendUint32(nil, sig.Hash)
+		fmt.Fprintf(&b, "%s%s %s\n", signaturePrefix, sig.Name, base64.StdEncoding.EncodeToString(append(v, sig.Value...)))
+	}
+	return b.Bytes(), nil
+}
+
+// find returns the signatures of the key.
+func (n *Note) find(name string, hash uint32) []Signature {
+	var sigs []Signature
+	for _, sig := range n.Signatures {
+		if sig.Name == name && sig.Hash == hash {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+// Sign adds the Ed25519 signature of the key of name to the note.
+func (n *Note) Sign(name string, private ed25519.PrivateKey) error {
+	if !validName(name) {
+		return fmt.Errorf("%w: name %q", ErrMalformedKey, name)
+	}
+	public := private.Public().(ed25519.PublicKey)
+	n.Signatures = append(n.Signatures, Signature{
+		Name:  name,
+		Hash:  KeyHash(name, AlgEd25519, public),
+		Value: ed25519.Sign(private, []byte(n.Text)),
+	})
+	return nil
+}
+
+// Verify returns true if the note has a valid Ed25519
+// signature of the key of name.
+func (n *Note) Verify(name string, public ed25519.PublicKey) bool {
+	for _, sig := range n.find(name, KeyHash(name, AlgEd25519, public)) {
+		if ed25519.Verify(public, []byte(n.Text), sig.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// cosignedMessage returns the message signed by cosignatures.
+func cosignedMessage(text string, t uint64) []byte {
+	return []byte("cosignature/v1\ntime " + strconv.FormatUint(t, 10) + "\n" + text)
+}
+
+// Cosign adds the cosignature at time t of the key of name to the note.
+func (n *Note) Cosign(name string, private ed25519.PrivateKey, t time.Time) error {
+	if !validName(name) {
+		return fmt.Errorf("%w: name %q", ErrMalformedKey, name)
+	}
+	public := private.Public().(ed25519.PublicKey)
+	ts := uint64(t.Unix())
+	n.Signatures = append(n.Signatures, Signature{
+		Name:  name,
+		Hash:  KeyHash(name, AlgCosignatureV1, public),
+		Value: append(binary.BigEndian.AppendUint64(nil, ts), ed25519.Sign(private, cosignedMessage(n.Text, ts))...),
+	})
+	return nil
+}
+
+// VerifyCosignature returns the time of a valid cosignature
+// of the key of name.
+func (n *Note) VerifyCosignature(name string, public ed25519.PublicKey) (time.Time, bool) {
+	for _, sig := range n.find(name, KeyHash(name, AlgCosignatureV1, public)) {
+		if len(sig.Value) != 8+ed25519.SignatureSize {
+			continue
+		}
+		ts := binary.BigEndian.Uint64(sig.Value)
+		if ed25519.Verify(public, cosignedMessage(n.Text, ts), sig.Value[8:]) {
+			return time.Unix(int64(ts), 0).UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,119 @@
+package note
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNote(t *testing.T) {
+	t.Parallel()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wpub, wpriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &Note{Text: "example.com/log\n3\nAAAA\n"}
+	if err := n.Sign("example.com/log", priv); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0).UTC()
+	if err := n.Cosign("witness.example", wpriv, now); err != nil {
+		t.Fatal(err)
+	}
+	b, err := n.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Parse(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != n.Text || len(got.Signatures) != 2 {
+		t.Fatalf("unexpected note: %+v", got)
+	}
+	if !got.Verify("example.com/log", pub) {
+		t.Fatalf("cannot verify signature")
+	}
+	if got.Verify("example.com/other", pub) || got.Verify("example.com/log", wpub) {
+		t.Fatalf("verified signature of another key")
+	}
+	// Cosignatures are not signatures, and the reverse.
+	if got.Verify("witness.example", wpub) {
+		t.Fatalf("verified cosignature as signature")
+	}
+	if _, ok := got.VerifyCosignature("example.com/log", pub); ok {
+		t.Fatalf("verified signature as cosignature")
+	}
+	ts, ok := got.VerifyCosignature("witness.example", wpub)
+	if !ok || !ts.Equal(now) {
+		t.Fatalf("cannot verify cosignature: %v", ts)
+	}
+	got.Text = "example.com/log\n4\nAAAA\n"
+	if got.Verify("example.com/log", pub) {
+		t.Fatalf("verified signature of another text")
+	}
+	if _, ok := got.VerifyCosignature("witness.example", wpub); ok {
+		t.Fatalf("verified cosignature of another text")
+	}
+}
+
+func TestVerifierKey(t *testing.T) {
+	t.Parallel()
+
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, alg := range []byte{AlgEd25519, AlgCosignatureV1} {
+		k, err := VerifierKey("example.com/log", alg, pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, a, p, err := ParseVerifierKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "example.com/log" || a != alg || !p.Equal(pub) {
+			t.Fatalf("unexpected key: %s, %d, %x", name, a, p)
+		}
+		if _, _, _, err := ParseVerifierKey(strings.Replace(k, "example.com", "example.org", 1)); !errors.Is(err, ErrMalformedKey) {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	for _, name := range []string{"", "a b", "a+b"} {
+		if _, err := VerifierKey(name, AlgEd25519, pub); !errors.Is(err, ErrMalformedKey) {
+			t.Fatalf("%q: unexpected err: %v", name, err)
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	t.Parallel()
+
+	sig := "— name AAAAAAA=\n"
+	for _, b := range []string{
+		"text\n",
+		"text\n\n",
+		"text\n\n" + sig[:len(sig)-1],
+		"text\n\n- name AAAAAAA=\n",
+		"text\n\n— name\n",
+		"text\n\n— name AAAA\n",
+		"text\n\n— name !!!!\n",
+		"te\x01xt\n\n" + sig,
+		"te\xffxt\n\n" + sig,
+	} {
+		if _, err := Parse([]byte(b)); !errors.Is(err, ErrMalformedNote) {
+			t.Fatalf("%q: unexpected err: %v", b, err)
+		}
+	}
+	if _, err := Parse([]byte("text\n\n" + sig)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,12 +1,15 @@
 package pad
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto/vrf"
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/merkletree"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/utils"
 )
 
 var (
@@ -14,13 +17,48 @@ var (
 	// memory, because the maximum number of cached PAD snapshots
 	// has been exceeded.
 	ErrSTRNotFound = errors.New("[merkletree] STR not found")
+	// ErrMissingKey indicates that a record was stored
+	// without its key.
+	ErrMissingKey = errors.New("[pad] record key not stored")
+	// ErrInvalidProof indicates a proof cannot be decoded.
+	ErrInvalidProof = errors.New("[pad] invalid proof")
+	// ErrInvalidPublic indicates public data cannot be decoded.
+	ErrInvalidPublic = errors.New("[pad] invalid public data")
+	// ErrKeyNotFound indicates that no record is stored for a key.
+	ErrKeyNotFound = errors.New("[pad] key not found")
 )
 
+// PublicIndex is the VRF suite of PADs in public-index mode, for
+// datasets whose keys are public. The index of a key is a hash of the
+// key that verifiers recompute, so there is no VRF key and proofs carry
+// no VRF proof. The private key of such PADs, if any, only derives the
+// salts of deterministic PADs.
+const PublicIndex vrf.Suite = 0
+
+// Index modes of the public data.
+const (
+	// IndexModeVRF computes indices with the VRF. It is the default,
+	// and is omitted from the public data.
+	IndexModeVRF = "vrf"
+	// IndexModePublic computes indices with HashIndex.
+	IndexModePublic = "public"
+)
+
+// PublicIndexIdentifier is the domain separation prefix
+// of indices in public-index mode.
+const PublicIndexIdentifier = 'P'
+
+// HashIndex returns the index of key in public-index mode.
+func HashIndex(h crypto.Hash, key []byte) []byte {
+	return h.Digest([]byte{PublicIndexIdentifier}, key)
+}
+
 // A PAD represents a persistent authenticated dictionary,
 // and includes the underlying MerkleTree and VRF key.
 type PAD struct {
-	vrfKey vrf.PrivateKey
-	tree   *merkletree.MerkleTree
+	vrfKey   vrf.PrivateKey
+	vrfSuite vrf.Suite
+	tree     *merkletree.MerkleTree
 }
 
 type Proof struct {
@@ -28,32 +66,147 @@ type Proof struct {
 	vrfProof  []byte
 }
 
-type Public []byte
+// Public is the public data used to verify proofs of a PAD.
+type Public struct {
+	HashSuite string `json:"hashSuite"`
+	VRFSuite  string `json:"vrfSuite"`
+	IndexMode string `json:"indexMode,omitempty"`
+	// TreeVersion is the hash version of the tree. It is
+	// omitted for HashV1, which predates hash versions.
+	TreeVersion uint8  `json:"treeVersion,omitempty"`
+	TreeHash    []byte `json:"treeHash"`
+	VRFKey      []byte `json:"vrfKey"`
+}
+
+// legacyPublicSize is the size of public data that predates
+// suites: the tree hash followed by the VRF public key.
+const legacyPublicSize = crypto.HashSizeByte + vrf.PublicKeySize
+
+// ParsePublic decodes public data returned by PAD.Public().
+func ParsePublic(b []byte) (*Public, error) {
+	if len(b) == legacyPublicSize && b[0] != '{' {
+		return &Public{
+			HashSuite:   crypto.DefaultHash.String(),
+			VRFSuite:    vrf.DefaultSuite.String(),
+			TreeVersion: uint8(merkletree.HashV1),
+			TreeHash:    append([]byte{}, b[:crypto.HashSizeByte]...),
+			VRFKey:      append([]byte{}, b[crypto.HashSizeByte:]...),
+		}, nil
+	}
+	var p Public
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPublic, err)
+	}
+	if len(p.TreeHash) != crypto.HashSizeByte {
+		return nil, fmt.Errorf("%w: tree hash size %d", ErrInvalidPublic, len(p.TreeHash))
+	}
+	if p.TreeVersion == 0 {
+		p.TreeVersion = uint8(merkletree.HashV1)
+	}
+	if !merkletree.HashVersion(p.TreeVersion).Available() {
+		return nil, fmt.Errorf("%w: tree version %d", ErrInvalidPublic, p.TreeVersion)
+	}
+	switch p.IndexMode {
+	case "", IndexModeVRF:
+		if p.VRFSuite == "" {
+			p.VRFSuite = vrf.DefaultSuite.String()
+		}
+	case IndexModePublic:
+		if p.VRFSuite != "" || len(p.VRFKey) != 0 {
+			return nil, fmt.Errorf("%w: vrf in public-index mode", ErrInvalidPublic)
+		}
+	default:
+		return nil, fmt.Errorf("%w: index mode %q", ErrInvalidPublic, p.IndexMode)
+	}
+	return &p, nil
+}
+
+// Hash returns the hash suite of the public data.
+func (p *Public) Hash() (crypto.Hash, error) {
+	return crypto.ParseHash(p.HashSuite)
+}
+
+// Version returns the hash version of the tree.
+func (p *Public) Version() merkletree.HashVersion {
+	return merkletree.HashVersion(p.TreeVersion)
+}
 
-// NewEmpty creates an empty PAD.
-func NewEmpty(vrfKey vrf.PrivateKey) (*PAD, error) {
+// Suite returns the VRF suite of the public data,
+// which is PublicIndex in public-index mode.
+func (p *Public) Suite() (vrf.Suite, error) {
+	if p.IndexMode == IndexModePublic {
+		return PublicIndex, nil
+	}
+	return vrf.ParseSuite(p.VRFSuite)
+}
+
+// NewEmpty creates an empty PAD hashed with h and version v,
+// whose indices are computed with the VRF suite s, or with
+// HashIndex if s is PublicIndex.
+func NewEmpty(vrfKey vrf.PrivateKey, s vrf.Suite, h crypto.Hash, v merkletree.HashVersion) (*PAD, error) {
+	if s != PublicIndex && !s.Available() {
+		return nil, fmt.Errorf("%w: %v", vrf.ErrUnknownSuite, s)
+	}
 	var err error
 	pad := new(PAD)
 	pad.vrfKey = vrfKey
-	pad.tree, err = merkletree.NewEmpty()
+	pad.vrfSuite = s
+	pad.tree, err = merkletree.NewEmpty(h, v)
 	if err != nil {
 		return nil, err
 	}
 	return pad, nil
 }
 
-// Load a pad from a reader and vrf private key.
-func NewFromReader(reader io.Reader, vrfKey vrf.PrivateKey) (*PAD, error) {
+// NewEmptyDeterministic creates an empty PAD like NewEmpty, whose tree
+// nonce and commitment salts are derived from the VRF private key. The
+// same records and key always give the same tree.
+func NewEmptyDeterministic(vrfKey vrf.PrivateKey, s vrf.Suite, h crypto.Hash, v merkletree.HashVersion) (*PAD, error) {
+	if s != PublicIndex && !s.Available() {
+		return nil, fmt.Errorf("%w: %v", vrf.ErrUnknownSuite, s)
+	}
 	var err error
 	pad := new(PAD)
 	pad.vrfKey = vrfKey
-	pad.tree, err = merkletree.NewFromReader(reader)
+	pad.vrfSuite = s
+	pad.tree, err = merkletree.NewEmptyDeterministic(h, v, saltKey(vrfKey))
 	if err != nil {
 		return nil, err
 	}
 	return pad, nil
 }
 
+// saltKey derives the key of the tree salts from the VRF
+// private key, so that it need not be stored separately.
+func saltKey(vrfKey vrf.PrivateKey) []byte {
+	return crypto.PRF(vrfKey, "pad salt key")
+}
+
+// Load a pad hashed with h and version v from a reader and vrf private key of suite s.
+func NewFromReader(reader io.Reader, vrfKey vrf.PrivateKey, s vrf.Suite, h crypto.Hash, v merkletree.HashVersion) (*PAD, error) {
+	if s != PublicIndex && !s.Available() {
+		return nil, fmt.Errorf("%w: %v", vrf.ErrUnknownSuite, s)
+	}
+	var err error
+	pad := new(PAD)
+	pad.vrfKey = vrfKey
+	pad.vrfSuite = s
+	pad.tree, err = merkletree.NewFromReader(reader, h, v)
+	if err != nil {
+		return nil, err
+	}
+	return pad, nil
+}
+
+// NewFromTree creates a pad from an existing tree and vrf private key of suite s.
+func NewFromTree(tree *merkletree.MerkleTree, vrfKey vrf.PrivateKey, s vrf.Suite) *PAD {
+	return &PAD{
+		vrfKey:   vrfKey,
+		vrfSuite: s,
+		tree:     tree,
+	}
+}
+
 // WriteInternal saves a pad to a writer.
 func (pad *PAD) WriteInternal(writer io.Writer) error {
 	// NOTE: We do not save the key.
@@ -68,27 +221,123 @@ func (pad *PAD) Hash() []byte {
 	return pad.tree.Hash()
 }
 
+// HashSuite returns the hash used by the PAD.
+func (pad *PAD) HashSuite() crypto.Hash {
+	return pad.tree.HashSuite()
+}
+
+// HashVersion returns the hash version of the tree.
+func (pad *PAD) HashVersion() merkletree.HashVersion {
+	return pad.tree.HashVersion()
+}
+
+// VRFSuite returns the VRF suite used by the PAD.
+func (pad *PAD) VRFSuite() vrf.Suite {
+	return pad.vrfSuite
+}
+
+// SetDeterministic derives the commitment salts of later insertions
+// from the VRF private key, as for a PAD created with NewEmptyDeterministic.
+func (pad *PAD) SetDeterministic() {
+	pad.tree.SetSaltKey(saltKey(pad.vrfKey))
+}
+
+// Deterministic returns true if the commitment salts
+// are derived from the VRF private key.
+func (pad *PAD) Deterministic() bool {
+	return pad.tree.Deterministic()
+}
+
+// Len returns the number of records in the PAD.
+func (pad *PAD) Len() uint64 {
+	return pad.tree.Len()
+}
+
 func (pad *PAD) Public() ([]byte, error) {
-	pubKey, err := pad.vrfKey.Public()
+	if pad.vrfSuite == PublicIndex {
+		return json.Marshal(&Public{
+			HashSuite:   pad.HashSuite().String(),
+			IndexMode:   IndexModePublic,
+			TreeVersion: pad.treeVersion(),
+			TreeHash:    pad.Hash(),
+		})
+	}
+	pubKey, err := pad.vrfSuite.Public(pad.vrfKey)
 	if err != nil {
 		return nil, err
 	}
 
-	return append([]byte(pad.Hash()), []byte(pubKey)...), nil
+	return json.Marshal(&Public{
+		HashSuite:   pad.HashSuite().String(),
+		VRFSuite:    pad.vrfSuite.String(),
+		TreeVersion: pad.treeVersion(),
+		TreeHash:    pad.Hash(),
+		VRFKey:      pubKey,
+	})
 }
 
-func (b Public) VerificationKey() []byte {
-	return append([]byte{}, b[crypto.HashSizeByte:]...)
-}
-
-func (b Public) TreeHash() []byte {
-	return append([]byte{}, b[:crypto.HashSizeByte]...)
+// treeVersion returns the TreeVersion of the public data,
+// which is omitted for trees that predate hash versions.
+func (pad *PAD) treeVersion() uint8 {
+	if v := pad.HashVersion(); v != merkletree.HashV1 {
+		return uint8(v)
+	}
+	return 0
 }
 
 func (p *Proof) PathProof() merkletree.AuthenticationPath {
 	return p.pathProof
 }
 
+// VRFProof returns the proof that the lookup index
+// is the VRF value of the key.
+func (p *Proof) VRFProof() []byte {
+	return p.vrfProof
+}
+
+// Membership returns a copy of p, a proof of inclusion, that
+// does not disclose the value. See AuthenticationPath.Membership.
+func (p *Proof) Membership() (*Proof, error) {
+	path, err := p.pathProof.Membership()
+	if err != nil {
+		return nil, err
+	}
+	return &Proof{
+		pathProof: *path,
+		vrfProof:  p.vrfProof,
+	}, nil
+}
+
+// MarshalBinary encodes the proof.
+func (p *Proof) MarshalBinary() ([]byte, error) {
+	path, err := p.pathProof.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	b := append([]byte{}, utils.LongToBytes(int64(len(path)))...)
+	b = append(b, path...)
+	return append(b, p.vrfProof...), nil
+}
+
+// UnmarshalBinary decodes data into the proof.
+func (p *Proof) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 {
+		return fmt.Errorf("%w: too short", ErrInvalidProof)
+	}
+	n := utils.BytesToLong(data[:8])
+	data = data[8:]
+	if n < 0 || n > int64(len(data)) {
+		return fmt.Errorf("%w: invalid length %d", ErrInvalidProof, n)
+	}
+	var path merkletree.AuthenticationPath
+	if err := path.UnmarshalBinary(data[:n]); err != nil {
+		return err
+	}
+	p.pathProof = path
+	p.vrfProof = append([]byte{}, data[n:]...)
+	return nil
+}
+
 // Index uses the VRF private key of the PAD to compute
 // the private index for the requested key.
 func (pad *PAD) Index(key []byte) []byte {
@@ -119,14 +368,48 @@ func (pad *PAD) Get(key []byte) (*Proof, error) {
 	}, nil
 }
 
+// Open returns the value stored for key and the salt of
+// its commitment. It returns ErrKeyNotFound if there is none.
+func (pad *PAD) Open(key []byte) (value, salt []byte, err error) {
+	ap, err := pad.tree.Get(pad.Index(key))
+	if err != nil {
+		return nil, nil, err
+	}
+	if ap.ProofType() != merkletree.ProofOfInclusion {
+		return nil, nil, ErrKeyNotFound
+	}
+	value = append([]byte{}, ap.Leaf.Value...)
+	salt = append([]byte{}, ap.Leaf.Commitment.Salt...)
+	return value, salt, nil
+}
+
+// Records calls fn on the key and value of each record,
+// ordered by index. It returns ErrMissingKey if a record
+// was stored without its key.
+func (pad *PAD) Records(fn func(key, value []byte) error) error {
+	for _, l := range pad.tree.Leaves() {
+		if l.Key == nil {
+			return fmt.Errorf("%w: index %x", ErrMissingKey, l.Index)
+		}
+		if err := fn(l.Key, l.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (pad *PAD) computePrivateIndex(key []byte, vrfKey vrf.PrivateKey) (index, proof []byte) {
-	index, proof = vrfKey.Prove(key)
+	if pad.vrfSuite == PublicIndex {
+		return HashIndex(pad.HashSuite(), key), nil
+	}
+	index, proof = pad.vrfSuite.Prove(vrfKey, key)
 	return
 }
 
 func (pad *PAD) Clone() *PAD {
 	return &PAD{
-		vrfKey: vrf.PrivateKey(append([]byte{}, []byte(pad.vrfKey)...)), // Make a copy of the key.
-		tree:   pad.tree.Clone(),
+		vrfKey:   vrf.PrivateKey(append([]byte{}, []byte(pad.vrfKey)...)), // Make a copy of the key.
+		vrfSuite: pad.vrfSuite,
+		tree:     pad.tree.Clone(),
 	}
 }
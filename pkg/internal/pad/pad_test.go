@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto/vrf"
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/merkletree"
 )
@@ -47,7 +48,7 @@ func TestNewPADErrorWhileCreatingTree(t *testing.T) {
 	origRand := mockRandReadWithErroringReader()
 	defer unMockRandReader(origRand)
 
-	pad, err := NewEmpty(vrfKey)
+	pad, err := NewEmpty(vrfKey, vrf.CONIKS, crypto.SHAKE128, merkletree.HashV2)
 	if err == nil || pad != nil {
 		t.Fatal("NewPad should return an error in case the tree creation failed")
 	}
@@ -160,7 +161,7 @@ func benchPADGet(b *testing.B, entries uint64) {
 // `afterCreateCB` and `afterInsertCB` are 2 callbacks which would be called
 // before creating the PAD and after every inserting, respectively.
 func createPad(N uint64, keyPrefix string, valuePrefix []byte) (*PAD, error) {
-	pad, err := NewEmpty(vrfKey)
+	pad, err := NewEmpty(vrfKey, vrf.CONIKS, crypto.SHAKE128, merkletree.HashV2)
 	if err != nil {
 		return nil, err
 	}
@@ -182,7 +183,7 @@ func TestNewFromReader(t *testing.T) {
 	entries := uint64(10)
 	var i uint64
 	// Create pad1.
-	pad1, err := NewEmpty(vrfKey)
+	pad1, err := NewEmpty(vrfKey, vrf.CONIKS, crypto.SHAKE128, merkletree.HashV2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -236,7 +237,7 @@ func TestNewFromReader(t *testing.T) {
 	}
 	cpyb1.Write(b1.Bytes())
 	// Create a new pad from b1.
-	pad2, err := NewFromReader(&b1, vrfKey)
+	pad2, err := NewFromReader(&b1, vrfKey, vrf.CONIKS, crypto.SHAKE128, merkletree.HashV2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,199 @@
+package timestamp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// Authority is a minimal time-stamp authority, for tests and local
+// deployments. It signs with ECDSA or RSA keys and SHA-256.
+type Authority struct {
+	// Signer is the key of Certificate.
+	Signer      crypto.Signer
+	Certificate *x509.Certificate
+	// Intermediates are included in tokens to build the chain.
+	Intermediates []*x509.Certificate
+	Policy        asn1.ObjectIdentifier
+	// Now returns the time of tokens. If nil, time.Now is used.
+	Now func() time.Time
+	// SigningCertificateV1 identifies the certificate with the ESS
+	// SigningCertificate attribute, with a SHA-1 hash, instead of
+	// SigningCertificateV2.
+	SigningCertificateV1 bool
+
+	mu     sync.Mutex
+	serial int64
+}
+
+// Respond returns the DER TimeStampResp to a DER TimeStampReq.
+func (a *Authority) Respond(b []byte) ([]byte, error) {
+	var req request
+	if rest, err := asn1.Unmarshal(b, &req); err != nil || len(rest) != 0 {
+		return asn1.Marshal(response{Status: pkiStatusInfo{Status: 2}})
+	}
+	if _, ok := hashOf(req.MessageImprint.HashAlgorithm.Algorithm); !ok || req.Version != 1 {
+		return asn1.Marshal(response{Status: pkiStatusInfo{Status: 2}})
+	}
+	token, err := a.token(&req)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(response{
+		Status:         pkiStatusInfo{Status: 0},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+}
+
+func (a *Authority) token(req *request) ([]byte, error) {
+	now := time.Now
+	if a.Now != nil {
+		now = a.Now
+	}
+	a.mu.Lock()
+	a.serial++
+	serial := a.serial
+	a.mu.Unlock()
+
+	content, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         a.Policy,
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   big.NewInt(serial),
+		GenTime:        now().UTC().Truncate(time.Second),
+		Nonce:          req.Nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := a.signedAttributes(content)
+	if err != nil {
+		return nil, err
+	}
+	var sigAlg asn1.ObjectIdentifier
+	switch a.Signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		sigAlg = oidECDSAWithSHA256
+	case *rsa.PublicKey:
+		sigAlg = oidSHA256WithRSA
+	default:
+		return nil, fmt.Errorf("unsupported key %T", a.Signer.Public())
+	}
+	sig, err := a.Signer.Sign(rand.Reader, digest(crypto.SHA256, attrs), crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	// The signed attributes are stored with their implicit tag.
+	attrs[0] = 0xa0
+
+	var certs []byte
+	if req.CertReq {
+		certs = append(certs, a.Certificate.Raw...)
+		for _, c := range a.Intermediates {
+			certs = append(certs, c.Raw...)
+		}
+	}
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256ID},
+		EncapContentInfo: encapsulatedContentInfo{
+			EContentType: oidTSTInfo,
+			EContent:     content,
+		},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			SID: issuerAndSerial{
+				Issuer: asn1.RawValue{FullBytes: a.Certificate.RawIssuer},
+				Serial: a.Certificate.SerialNumber,
+			},
+			DigestAlgorithm:    sha256ID,
+			SignedAttrs:        asn1.RawValue{FullBytes: attrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: sigAlg},
+			Signature:          sig,
+		}},
+	}
+	if certs != nil {
+		sd.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs}
+	}
+	b, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b},
+	})
+}
+
+// signedAttributes returns the DER SET of the signed attributes.
+func (a *Authority) signedAttributes(content []byte) ([]byte, error) {
+	sc, err := a.signingCertificate()
+	if err != nil {
+		return nil, err
+	}
+	contentType, err := asn1.Marshal(oidTSTInfo)
+	if err != nil {
+		return nil, err
+	}
+	messageDigest, err := asn1.Marshal(digest(crypto.SHA256, content))
+	if err != nil {
+		return nil, err
+	}
+	set := func(v []byte) asn1.RawValue {
+		return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: v}
+	}
+	scType := oidSigningCertificateV2
+	if a.SigningCertificateV1 {
+		scType = oidSigningCertificate
+	}
+	return asn1.MarshalWithParams([]attribute{
+		{Type: oidContentType, Values: set(contentType)},
+		{Type: oidMessageDigest, Values: set(messageDigest)},
+		{Type: scType, Values: set(sc)},
+	}, "set")
+}
+
+// signingCertificate returns the DER signing certificate attribute
+// value, which identifies the certificate by its hash, issuer and
+// serial number.
+func (a *Authority) signingCertificate() ([]byte, error) {
+	issuer, err := asn1.Marshal([]asn1.RawValue{{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        4,
+		IsCompound: true,
+		Bytes:      a.Certificate.RawIssuer,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	is, err := asn1.Marshal(issuerSerial{
+		Issuer: asn1.RawValue{FullBytes: issuer},
+		Serial: a.Certificate.SerialNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if a.SigningCertificateV1 {
+		return asn1.Marshal(signingCertificate{
+			Certs: []essCertID{{
+				CertHash:     digest(crypto.SHA1, a.Certificate.Raw),
+				IssuerSerial: asn1.RawValue{FullBytes: is},
+			}},
+		})
+	}
+	return asn1.Marshal(signingCertificateV2{
+		Certs: []essCertIDv2{{
+			CertHash:     digest(crypto.SHA256, a.Certificate.Raw),
+			IssuerSerial: asn1.RawValue{FullBytes: is},
+		}},
+	})
+}
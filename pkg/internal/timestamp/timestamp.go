@@ -0,0 +1,490 @@
+// Package timestamp implements the RFC 3161 time-stamp protocol:
+// requests, responses and the verification of time-stamp tokens,
+// which are CMS SignedData of a TSTInfo. Only the subset used by
+// time-stamp authorities is supported: a single signer identified
+// by issuer and serial number, with signed attributes.
+package timestamp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+var (
+	// ErrInvalidToken indicates a token is malformed, or its
+	// signature does not verify.
+	ErrInvalidToken = errors.New("[timestamp] invalid token")
+	// ErrImprintMismatch indicates a token does not time-stamp
+	// the expected message.
+	ErrImprintMismatch = errors.New("[timestamp] mismatch message imprint")
+	// ErrRejected indicates the authority rejected the request.
+	ErrRejected = errors.New("[timestamp] request rejected")
+)
+
+var (
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECPublicKey     = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+
+	oidSignedData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningCertificate   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 12}
+	oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type request struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional"`
+	Extensions     []pkix.Extension      `asn1:"tag:0,optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.BitString  `asn1:"optional"`
+}
+
+type response struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"tag:0,optional"`
+	Micros  int `asn1:"tag:1,optional"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time        `asn1:"generalized"`
+	Accuracy       accuracy         `asn1:"optional"`
+	Ordering       bool             `asn1:"optional"`
+	Nonce          *big.Int         `asn1:"optional"`
+	TSA            asn1.RawValue    `asn1:"tag:0,explicit,optional"`
+	Extensions     []pkix.Extension `asn1:"tag:1,optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// essCertID identifies a certificate by its SHA-1 hash, in the
+// SigningCertificate attribute of RFC 2634.
+type essCertID struct {
+	CertHash     []byte
+	IssuerSerial asn1.RawValue `asn1:"optional"`
+}
+
+type signingCertificate struct {
+	Certs    []essCertID
+	Policies asn1.RawValue `asn1:"optional"`
+}
+
+type essCertIDv2 struct {
+	HashAlgorithm pkix.AlgorithmIdentifier `asn1:"optional"`
+	CertHash      []byte
+	IssuerSerial  asn1.RawValue `asn1:"optional"`
+}
+
+type signingCertificateV2 struct {
+	Certs    []essCertIDv2
+	Policies asn1.RawValue `asn1:"optional"`
+}
+
+// issuerSerial is the optional issuer and serial number of
+// ESS certificate identifiers. The issuer is GeneralNames.
+type issuerSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+// hashes maps digest algorithms to their hash functions.
+var hashes = []struct {
+	oid  asn1.ObjectIdentifier
+	hash crypto.Hash
+}{
+	{oidSHA256, crypto.SHA256},
+	{oidSHA384, crypto.SHA384},
+	{oidSHA512, crypto.SHA512},
+}
+
+func hashOf(oid asn1.ObjectIdentifier) (crypto.Hash, bool) {
+	for _, h := range hashes {
+		if h.oid.Equal(oid) {
+			return h.hash, true
+		}
+	}
+	return 0, false
+}
+
+func digest(h crypto.Hash, m []byte) []byte {
+	switch h {
+	case crypto.SHA1:
+		d := sha1.Sum(m)
+		return d[:]
+	case crypto.SHA256:
+		d := sha256.Sum256(m)
+		return d[:]
+	case crypto.SHA384:
+		d := sha512.Sum384(m)
+		return d[:]
+	}
+	d := sha512.Sum512(m)
+	return d[:]
+}
+
+// signatureAlgorithm returns the x509 algorithm of a signer
+// info. Some authorities only give the key algorithm, whose
+// digest is then the digest algorithm of the signer.
+func signatureAlgorithm(sig, dig asn1.ObjectIdentifier) (x509.SignatureAlgorithm, error) {
+	h, _ := hashOf(dig)
+	switch {
+	case sig.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256, nil
+	case sig.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384, nil
+	case sig.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512, nil
+	case sig.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA, nil
+	case sig.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA, nil
+	case sig.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA, nil
+	case sig.Equal(oidECPublicKey):
+		switch h {
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	case sig.Equal(oidRSAEncryption):
+		switch h {
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: signature algorithm %v", ErrInvalidToken, sig)
+}
+
+// NewRequest returns a DER TimeStampReq for the SHA-256 digest
+// of message. The authority is asked to include its certificate.
+func NewRequest(message []byte, nonce *big.Int) ([]byte, error) {
+	return asn1.Marshal(request{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest(crypto.SHA256, message),
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+}
+
+// ParseResponse returns the token of a DER TimeStampResp,
+// if the request was granted.
+func ParseResponse(b []byte) ([]byte, error) {
+	var resp response
+	if rest, err := asn1.Unmarshal(b, &resp); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: malformed response", ErrRejected)
+	}
+	// Statuses 0 and 1 are granted, and granted with modifications.
+	if resp.Status.Status > 1 {
+		return nil, fmt.Errorf("%w: status %d", ErrRejected, resp.Status.Status)
+	}
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, fmt.Errorf("%w: no token", ErrRejected)
+	}
+	return resp.TimeStampToken.FullBytes, nil
+}
+
+// Info describes a verified token.
+type Info struct {
+	// Time is the time asserted by the authority.
+	Time   time.Time
+	Nonce  *big.Int
+	Policy asn1.ObjectIdentifier
+	Serial *big.Int
+	// Certificate is the certificate of the authority.
+	Certificate *x509.Certificate
+	// certificates are all the certificates of the token.
+	certificates []*x509.Certificate
+}
+
+// ParseToken parses a DER TimeStampToken, and checks that it
+// time-stamps message and is signed by the certificate it
+// carries. It does not verify the certificate chain.
+func ParseToken(token, message []byte) (*Info, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(token, &ci); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: malformed content info", ErrInvalidToken)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("%w: content type %v", ErrInvalidToken, ci.ContentType)
+	}
+	var sd signedData
+	if rest, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: malformed signed data", ErrInvalidToken)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) || len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("%w: not a time-stamp token", ErrInvalidToken)
+	}
+	var info tstInfo
+	if rest, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil || len(rest) != 0 {
+		return nil, fmt.Errorf("%w: malformed TSTInfo", ErrInvalidToken)
+	}
+	h, ok := hashOf(info.MessageImprint.HashAlgorithm.Algorithm)
+	if !ok {
+		return nil, fmt.Errorf("%w: imprint algorithm %v", ErrInvalidToken, info.MessageImprint.HashAlgorithm.Algorithm)
+	}
+	if !bytes.Equal(info.MessageImprint.HashedMessage, digest(h, message)) {
+		return nil, ErrImprintMismatch
+	}
+
+	certs, err := parseCertificates(sd.Certificates)
+	if err != nil {
+		return nil, err
+	}
+	si := sd.SignerInfos[0]
+	var signer *x509.Certificate
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, si.SID.Issuer.FullBytes) && c.SerialNumber.Cmp(si.SID.Serial) == 0 {
+			signer = c
+		}
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("%w: no signer certificate", ErrInvalidToken)
+	}
+	if err := verifySignerInfo(&si, sd.EncapContentInfo.EContent, signer); err != nil {
+		return nil, err
+	}
+	return &Info{
+		Time:         info.GenTime,
+		Nonce:        info.Nonce,
+		Policy:       info.Policy,
+		Serial:       info.SerialNumber,
+		Certificate:  signer,
+		certificates: certs,
+	}, nil
+}
+
+func parseCertificates(raw asn1.RawValue) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := raw.Bytes
+	for len(rest) > 0 {
+		var c asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &c); err != nil {
+			return nil, fmt.Errorf("%w: malformed certificates", ErrInvalidToken)
+		}
+		cert, err := x509.ParseCertificate(c.FullBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// verifySignerInfo verifies the signed attributes of si, and
+// that they are signed by signer.
+func verifySignerInfo(si *signerInfo, content []byte, signer *x509.Certificate) error {
+	if len(si.SignedAttrs.FullBytes) == 0 {
+		return fmt.Errorf("%w: no signed attributes", ErrInvalidToken)
+	}
+	// The signature covers the attributes with a SET tag
+	// instead of the implicit tag.
+	signed := append([]byte{}, si.SignedAttrs.FullBytes...)
+	signed[0] = 0x31
+	var attrs []attribute
+	if rest, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil || len(rest) != 0 {
+		return fmt.Errorf("%w: malformed signed attributes", ErrInvalidToken)
+	}
+	h, ok := hashOf(si.DigestAlgorithm.Algorithm)
+	if !ok {
+		return fmt.Errorf("%w: digest algorithm %v", ErrInvalidToken, si.DigestAlgorithm.Algorithm)
+	}
+	var contentType, messageDigest, signingCert bool
+	for _, a := range attrs {
+		switch {
+		case a.Type.Equal(oidContentType):
+			var oid asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(a.Values.Bytes, &oid); err != nil || !oid.Equal(oidTSTInfo) {
+				return fmt.Errorf("%w: content type attribute", ErrInvalidToken)
+			}
+			contentType = true
+		case a.Type.Equal(oidMessageDigest):
+			var d []byte
+			if _, err := asn1.Unmarshal(a.Values.Bytes, &d); err != nil || !bytes.Equal(d, digest(h, content)) {
+				return fmt.Errorf("%w: message digest attribute", ErrInvalidToken)
+			}
+			messageDigest = true
+		case a.Type.Equal(oidSigningCertificate):
+			var sc signingCertificate
+			if _, err := asn1.Unmarshal(a.Values.Bytes, &sc); err != nil || len(sc.Certs) == 0 {
+				return fmt.Errorf("%w: signing certificate attribute", ErrInvalidToken)
+			}
+			if err := checkCertID(crypto.SHA1, sc.Certs[0].CertHash, sc.Certs[0].IssuerSerial, signer); err != nil {
+				return err
+			}
+			signingCert = true
+		case a.Type.Equal(oidSigningCertificateV2):
+			var sc signingCertificateV2
+			if _, err := asn1.Unmarshal(a.Values.Bytes, &sc); err != nil || len(sc.Certs) == 0 {
+				return fmt.Errorf("%w: signing certificate attribute", ErrInvalidToken)
+			}
+			ch := crypto.SHA256
+			if alg := sc.Certs[0].HashAlgorithm.Algorithm; len(alg) != 0 {
+				if ch, ok = hashOf(alg); !ok {
+					return fmt.Errorf("%w: signing certificate algorithm %v", ErrInvalidToken, alg)
+				}
+			}
+			if err := checkCertID(ch, sc.Certs[0].CertHash, sc.Certs[0].IssuerSerial, signer); err != nil {
+				return err
+			}
+			signingCert = true
+		}
+	}
+	// The signing certificate attribute binds the
+	// signature to the certificate, as RFC 5816 requires.
+	if !contentType || !messageDigest || !signingCert {
+		return fmt.Errorf("%w: missing signed attributes", ErrInvalidToken)
+	}
+	alg, err := signatureAlgorithm(si.SignatureAlgorithm.Algorithm, si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	if err := signer.CheckSignature(alg, signed, si.Signature); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return nil
+}
+
+// checkCertID checks that the ESS certificate identifier, the hash
+// of the certificate with h and its optional issuer and serial
+// number, identifies signer.
+func checkCertID(h crypto.Hash, certHash []byte, rawIssuerSerial asn1.RawValue, signer *x509.Certificate) error {
+	if !bytes.Equal(certHash, digest(h, signer.Raw)) {
+		return fmt.Errorf("%w: signing certificate mismatch", ErrInvalidToken)
+	}
+	if len(rawIssuerSerial.FullBytes) == 0 {
+		return nil
+	}
+	var is issuerSerial
+	if rest, err := asn1.Unmarshal(rawIssuerSerial.FullBytes, &is); err != nil || len(rest) != 0 {
+		return fmt.Errorf("%w: signing certificate issuer", ErrInvalidToken)
+	}
+	if is.Serial == nil || is.Serial.Cmp(signer.SerialNumber) != 0 {
+		return fmt.Errorf("%w: signing certificate serial mismatch", ErrInvalidToken)
+	}
+	// The issuer must be a directory name, [4] EXPLICIT Name.
+	rest := is.Issuer.Bytes
+	for len(rest) > 0 {
+		var name asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &name); err != nil {
+			return fmt.Errorf("%w: signing certificate issuer", ErrInvalidToken)
+		}
+		if name.Class == asn1.ClassContextSpecific && name.Tag == 4 && bytes.Equal(name.Bytes, signer.RawIssuer) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: signing certificate issuer mismatch", ErrInvalidToken)
+}
+
+// Verify verifies the token like ParseToken, and that the
+// certificate of the authority chains to roots and is valid
+// for time-stamping at the time of the token.
+func Verify(token, message []byte, roots *x509.CertPool) (*Info, error) {
+	info, err := ParseToken(token, message)
+	if err != nil {
+		return nil, err
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range info.certificates {
+		intermediates.AddCert(c)
+	}
+	if _, err := info.Certificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   info.Time,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return info, nil
+}
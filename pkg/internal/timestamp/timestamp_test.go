@@ -0,0 +1,281 @@
+package timestamp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newCertificate(t *testing.T, template, parent *x509.Certificate, pub crypto.PublicKey, priv crypto.Signer) *x509.Certificate {
+	t.Helper()
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// newAuthority returns an authority whose certificate
+// is issued by a new root, and the root.
+func newAuthority(t *testing.T, key crypto.Signer) (*Authority, *x509.CertPool) {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	root := newCertificate(t, rootTemplate, rootTemplate, rootKey.Public(), rootKey)
+	// RFC 3161 requires a critical extended key usage
+	// extension, which x509 does not mark as such.
+	eku, err := asn1.Marshal([]asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 8}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := newCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "test tsa"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{2, 5, 29, 37}, Critical: true, Value: eku},
+		},
+	}, root, key.Public(), rootKey)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return &Authority{
+		Signer:      key,
+		Certificate: cert,
+		Policy:      asn1.ObjectIdentifier{1, 2, 3, 4},
+	}, roots
+}
+
+func TestTimestamp(t *testing.T) {
+	t.Parallel()
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []crypto.Signer{ecKey, rsaKey} {
+		tsa, roots := newAuthority(t, key)
+		message := []byte("message")
+		req, err := NewRequest(message, big.NewInt(42))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := tsa.Respond(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := ParseResponse(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := Verify(token, message, roots)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Nonce.Int64() != 42 || time.Since(info.Time) > time.Minute || !info.Policy.Equal(tsa.Policy) {
+			t.Fatalf("unexpected info: %+v", info)
+		}
+
+		if _, err := Verify(token, []byte("other"), roots); !errors.Is(err, ErrImprintMismatch) {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		_, otherRoots := newAuthority(t, key)
+		if _, err := Verify(token, message, otherRoots); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		// Any altered byte invalidates the token.
+		for _, i := range []int{len(token) / 3, len(token) / 2, len(token) - 10} {
+			altered := append([]byte{}, token...)
+			altered[i] ^= 1
+			if _, err := Verify(altered, message, roots); err == nil {
+				t.Fatalf("token altered at %d verifies", i)
+			}
+		}
+	}
+}
+
+func TestTimestampExpiredAuthority(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsa, roots := newAuthority(t, key)
+	// Tokens issued after the certificate expired do not verify.
+	tsa.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	req, err := NewRequest([]byte("message"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tsa.Respond(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := ParseResponse(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseToken(token, []byte("message")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(token, []byte("message"), roots); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func TestRejected(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsa, _ := newAuthority(t, key)
+	resp, err := tsa.Respond([]byte("not a request"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseResponse(resp); !errors.Is(err, ErrRejected) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+// newToken returns a token of message by tsa.
+func newToken(t *testing.T, tsa *Authority, message []byte) []byte {
+	t.Helper()
+	req, err := NewRequest(message, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tsa.Respond(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := ParseResponse(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// resign returns token with its signed attributes altered by
+// alter, and signed again with the ECDSA key.
+func resign(t *testing.T, token []byte, key crypto.Signer, alter func([]attribute) []attribute) []byte {
+	t.Helper()
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(token, &ci); err != nil {
+		t.Fatal(err)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		t.Fatal(err)
+	}
+	si := &sd.SignerInfos[0]
+	signed := append([]byte{}, si.SignedAttrs.FullBytes...)
+	signed[0] = 0x31
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := asn1.MarshalWithParams(alter(attrs), "set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si.Signature, err = key.Sign(rand.Reader, digest(crypto.SHA256, signed), crypto.SHA256); err != nil {
+		t.Fatal(err)
+	}
+	signed[0] = 0xa0
+	si.SignedAttrs = asn1.RawValue{FullBytes: signed}
+	b, err := asn1.Marshal(sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci.Content = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b}
+	if token, err = asn1.Marshal(ci); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestSigningCertificate(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tsa, roots := newAuthority(t, key)
+	message := []byte("message")
+	for _, v1 := range []bool{false, true} {
+		tsa.SigningCertificateV1 = v1
+		token := newToken(t, tsa, message)
+		if _, err := Verify(token, message, roots); err != nil {
+			t.Fatalf("v1 %v: %v", v1, err)
+		}
+		// Re-signing keeps the token valid.
+		same := resign(t, token, key, func(attrs []attribute) []attribute { return attrs })
+		if _, err := Verify(same, message, roots); err != nil {
+			t.Fatalf("v1 %v: %v", v1, err)
+		}
+	}
+
+	// The attribute is required.
+	tsa.SigningCertificateV1 = false
+	token := newToken(t, tsa, message)
+	missing := resign(t, token, key, func(attrs []attribute) []attribute {
+		return attrs[:2]
+	})
+	if _, err := Verify(missing, message, roots); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// The attribute must identify the certificate of the token,
+	// by hash and by issuer and serial number.
+	other, _ := newAuthority(t, key)
+	serial := *tsa.Certificate
+	serial.SerialNumber = big.NewInt(3)
+	for _, a := range []*Authority{other, {Certificate: &serial}} {
+		sc, err := a.signingCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		altered := resign(t, token, key, func(attrs []attribute) []attribute {
+			attrs[2].Values.Bytes = sc
+			attrs[2].Values.FullBytes = nil
+			return attrs
+		})
+		if _, err := Verify(altered, message, roots); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+}
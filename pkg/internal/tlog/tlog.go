@@ -0,0 +1,187 @@
+// Package tlog implements the Merkle trees of append-only
+// logs, as in RFC 9162 section 2.1.
+package tlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/bits"
+)
+
+// HashSize is the size of the hashes of the tree.
+const HashSize = sha256.Size
+
+var (
+	// ErrInvalidProof indicates a proof does not verify.
+	ErrInvalidProof = errors.New("[tlog] invalid proof")
+	// ErrInvalidRange indicates indices or sizes outside the tree.
+	ErrInvalidRange = errors.New("[tlog] invalid range")
+)
+
+// LeafHash returns the hash of the leaf with data.
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// NodeHash returns the hash of the interior node
+// with children left and right.
+func NodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// split returns the largest power of two smaller than n, for n > 1.
+func split(n uint64) uint64 {
+	return 1 << (bits.Len64(n-1) - 1)
+}
+
+// RootHash returns the root of the tree of the leaf hashes.
+func RootHash(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		h := sha256.Sum256(nil)
+		return h[:]
+	case 1:
+		return leaves[0]
+	}
+	k := split(uint64(len(leaves)))
+	return NodeHash(RootHash(leaves[:k]), RootHash(leaves[k:]))
+}
+
+// InclusionProof returns the proof that the leaf at index is
+// in the tree of the leaf hashes.
+func InclusionProof(index uint64, leaves [][]byte) ([][]byte, error) {
+	if index >= uint64(len(leaves)) {
+		return nil, ErrInvalidRange
+	}
+	return inclusionProof(index, leaves), nil
+}
+
+func inclusionProof(index uint64, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := split(uint64(len(leaves)))
+	if index < k {
+		return append(inclusionProof(index, leaves[:k]), RootHash(leaves[k:]))
+	}
+	return append(inclusionProof(index-k, leaves[k:]), RootHash(leaves[:k]))
+}
+
+// ConsistencyProof returns the proof that the tree of the first
+// size leaf hashes is a prefix of the tree of the leaf hashes.
+func ConsistencyProof(size uint64, leaves [][]byte) ([][]byte, error) {
+	if size > uint64(len(leaves)) {
+		return nil, ErrInvalidRange
+	}
+	if size == 0 || size == uint64(len(leaves)) {
+		return nil, nil
+	}
+	return consistencyProof(size, leaves, true), nil
+}
+
+// consistencyProof is SUBPROOF of RFC 9162 section 2.1.4.1.
+func consistencyProof(m uint64, leaves [][]byte, complete bool) [][]byte {
+	n := uint64(len(leaves))
+	if m == n {
+		if complete {
+			return nil
+		}
+		return [][]byte{RootHash(leaves)}
+	}
+	k := split(n)
+	if m <= k {
+		return append(consistencyProof(m, leaves[:k], complete), RootHash(leaves[k:]))
+	}
+	return append(consistencyProof(m-k, leaves[k:], false), RootHash(leaves[:k]))
+}
+
+// VerifyInclusion verifies that the leaf with hash leaf is at index
+// in the tree of size leaves with root hash root.
+func VerifyInclusion(index, size uint64, leaf []byte, proof [][]byte, root []byte) error {
+	if index >= size {
+		return ErrInvalidRange
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range proof {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			r = NodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = NodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(r, root) {
+		return ErrInvalidProof
+	}
+	return nil
+}
+
+// VerifyConsistency verifies that the tree of size1 leaves with
+// root hash root1 is a prefix of the tree of size2 leaves with
+// root hash root2.
+func VerifyConsistency(size1, size2 uint64, proof [][]byte, root1, root2 []byte) error {
+	switch {
+	case size1 > size2:
+		return ErrInvalidRange
+	case size1 == size2:
+		if len(proof) != 0 || !bytes.Equal(root1, root2) {
+			return ErrInvalidProof
+		}
+		return nil
+	case size1 == 0:
+		if len(proof) != 0 {
+			return ErrInvalidProof
+		}
+		return nil
+	case len(proof) == 0:
+		return ErrInvalidProof
+	}
+	// A complete first tree is its own first node.
+	if size1&(size1-1) == 0 {
+		proof = append([][]byte{root1}, proof...)
+	}
+	fn, sn := size1-1, size2-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrInvalidProof
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = NodeHash(c, fr)
+			sr = NodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = NodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(fr, root1) || !bytes.Equal(sr, root2) {
+		return ErrInvalidProof
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package tlog
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// leaves are the leaves of the test vectors of RFC 6962
+// implementations.
+var leaves = []string{
+	"",
+	"00",
+	"10",
+	"2021",
+	"3031",
+	"40414243",
+	"5051525354555657",
+	"606162636465666768696a6b6c6d6e6f",
+}
+
+func leafHashes(t *testing.T, n int) [][]byte {
+	t.Helper()
+	hashes := make([][]byte, n)
+	for i := range hashes {
+		b, err := hex.DecodeString(leaves[i%len(leaves)])
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[i] = LeafHash(append(b, byte(i/len(leaves))))
+		if i < len(leaves) {
+			hashes[i] = LeafHash(b)
+		}
+	}
+	return hashes
+}
+
+func TestRootHash(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		size int
+		root string
+	}{
+		{0, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{1, "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d"},
+		{8, "5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(RootHash(leafHashes(t, tt.size)))
+		if got != tt.root {
+			t.Fatalf("size %d: got %s, want %s", tt.size, got, tt.root)
+		}
+	}
+}
+
+func TestInclusionProof(t *testing.T) {
+	t.Parallel()
+
+	all := leafHashes(t, 20)
+	for size := uint64(1); size <= uint64(len(all)); size++ {
+		tree := all[:size]
+		root := RootHash(tree)
+		for i := uint64(0); i < size; i++ {
+			proof, err := InclusionProof(i, tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyInclusion(i, size, tree[i], proof, root); err != nil {
+				t.Fatalf("size %d, index %d: %v", size, i, err)
+			}
+			if size > 1 {
+				if err := VerifyInclusion((i+1)%size, size, tree[i], proof, root); err == nil {
+					t.Fatalf("size %d, index %d: verified at another index", size, i)
+				}
+				altered := append([][]byte{}, proof...)
+				altered[0] = NodeHash(proof[0], proof[0])
+				if err := VerifyInclusion(i, size, tree[i], altered, root); !errors.Is(err, ErrInvalidProof) {
+					t.Fatalf("size %d, index %d: altered proof: %v", size, i, err)
+				}
+			}
+		}
+		if _, err := InclusionProof(size, tree); !errors.Is(err, ErrInvalidRange) {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+}
+
+func TestConsistencyProof(t *testing.T) {
+	t.Parallel()
+
+	all := leafHashes(t, 20)
+	for size2 := uint64(1); size2 <= uint64(len(all)); size2++ {
+		root2 := RootHash(all[:size2])
+		for size1 := uint64(0); size1 <= size2; size1++ {
+			root1 := RootHash(all[:size1])
+			proof, err := ConsistencyProof(size1, all[:size2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := VerifyConsistency(size1, size2, proof, root1, root2); err != nil {
+				t.Fatalf("sizes %d, %d: %v", size1, size2, err)
+			}
+			if size1 == 0 || size1 == size2 {
+				continue
+			}
+			if err := VerifyConsistency(size1, size2, proof, root2, root2); err == nil {
+				t.Fatalf("sizes %d, %d: verified with another first root", size1, size2)
+			}
+			if err := VerifyConsistency(size1, size2, proof, root1, root1); err == nil {
+				t.Fatalf("sizes %d, %d: verified with another second root", size1, size2)
+			}
+			if err := VerifyConsistency(size1, size2, proof[1:], root1, root2); err == nil {
+				t.Fatalf("sizes %d, %d: verified a truncated proof", size1, size2)
+			}
+		}
+	}
+	if _, err := ConsistencyProof(3, all[:2]); !errors.Is(err, ErrInvalidRange) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := VerifyConsistency(3, 2, nil, nil, nil); !errors.Is(err, ErrInvalidRange) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package pkg
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
+)
+
+// Types of in-toto statements and of their predicates.
+const (
+	// StatementType is the type of in-toto v1 statements.
+	StatementType = "https://in-toto.io/Statement/v1"
+	// DatasetPredicateType is the type of predicates
+	// describing a recorded dataset.
+	DatasetPredicateType = "https://github.com/laurentsimon/dataset-recorder/dataset/v1"
+)
+
+// modulePath is the path of this module, which
+// identifies the recorder in attestations.
+const modulePath = "github.com/laurentsimon/dataset-recorder/pkg"
+
+var (
+	// ErrInvalidStatement indicates a statement is malformed.
+	ErrInvalidStatement = errors.New("[attestation] invalid statement")
+	// ErrStatementMismatch indicates a statement does not describe
+	// the public data of a verifier.
+	ErrStatementMismatch = errors.New("[verifier] mismatch statement")
+)
+
+// ResourceDescriptor is an in-toto v1 resource descriptor.
+type ResourceDescriptor struct {
+	Name      string            `json:"name,omitempty"`
+	URI       string            `json:"uri,omitempty"`
+	Digest    map[string]string `json:"digest,omitempty"`
+	MediaType string            `json:"mediaType,omitempty"`
+}
+
+// Statement is an in-toto v1 statement. The predicate is kept
+// encoded, and decoded according to the predicate type.
+type Statement struct {
+	Type          string               `json:"_type"`
+	Subject       []ResourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     json.RawMessage      `json:"predicate"`
+}
+
+// DatasetPredicate describes a recorded dataset.
+type DatasetPredicate struct {
+	// Recorder identifies the code that recorded the dataset.
+	Recorder RecorderInfo `json:"recorder"`
+	// HashSuite, VRFSuite and TreeVersion are the suites of
+	// the tree, as in the public data.
+	HashSuite   string `json:"hashSuite"`
+	VRFSuite    string `json:"vrfSuite,omitempty"`
+	TreeVersion int    `json:"treeVersion"`
+	// Records is the number of records in the tree.
+	Records uint64 `json:"records"`
+	// Sources are the files the records were read from.
+	Sources []ResourceDescriptor `json:"sources,omitempty"`
+	// Public is the public data for verification, as returned
+	// by Recorder.Public().
+	Public []byte `json:"public"`
+}
+
+// RecorderInfo identifies the module that recorded a dataset.
+type RecorderInfo struct {
+	URI     string `json:"uri"`
+	Version string `json:"version"`
+}
+
+// customDigestPrefix namespaces the digest names of roots
+// computed with a hash that has no registered in-toto name.
+const customDigestPrefix = modulePath + "/"
+
+// digestName returns the name of the digest of a root computed
+// with h: the registered in-toto digest name if there is one,
+// or a name under customDigestPrefix.
+func digestName(h crypto.Hash) string {
+	if h == crypto.SHA256 {
+		return "sha256"
+	}
+	return customDigestPrefix + strings.ToLower(strings.ReplaceAll(h.String(), "-", ""))
+}
+
+// moduleVersion returns the version of this module
+// in the running binary.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(unknown)"
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, d := range info.Deps {
+		if d.Path == modulePath {
+			return d.Version
+		}
+	}
+	return "(devel)"
+}
+
+// Statement returns an in-toto statement whose subject is the
+// dataset, with the root of the tree as its digest. The recorder
+// must have a name. sources describe the files the records were
+// read from.
+func (r *Recorder) Statement(sources ...ResourceDescriptor) (*Statement, error) {
+	if r.name == "" {
+		return nil, fmt.Errorf("%w: dataset has no name", ErrInvalidStatement)
+	}
+	public, err := r.Public()
+	if err != nil {
+		return nil, err
+	}
+	predicate, err := json.Marshal(DatasetPredicate{
+		Recorder: RecorderInfo{
+			URI:     "https://" + modulePath,
+			Version: moduleVersion(),
+		},
+		HashSuite:   r.p.HashSuite().String(),
+		VRFSuite:    vrfSuiteName(r.p.VRFSuite()),
+		TreeVersion: int(r.p.HashVersion()),
+		Records:     r.p.Len(),
+		Sources:     sources,
+		Public:      public,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Statement{
+		Type: StatementType,
+		Subject: []ResourceDescriptor{{
+			Name:   r.name,
+			Digest: map[string]string{digestName(r.p.HashSuite()): hex.EncodeToString(r.p.Hash())},
+		}},
+		PredicateType: DatasetPredicateType,
+		Predicate:     predicate,
+	}, nil
+}
+
+// ParseStatement parses an in-toto statement describing
+// a dataset, or the training of models.
+func ParseStatement(b []byte) (*Statement, error) {
+	var s Statement
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidStatement, err)
+	}
+	if s.Type != StatementType {
+		return nil, fmt.Errorf("%w: type %q", ErrInvalidStatement, s.Type)
+	}
+	switch s.PredicateType {
+	case DatasetPredicateType:
+		if len(s.Subject) != 1 {
+			return nil, fmt.Errorf("%w: %d subjects", ErrInvalidStatement, len(s.Subject))
+		}
+		if _, err := s.DatasetPredicate(); err != nil {
+			return nil, err
+		}
+	case TrainingPredicateType:
+		if err := checkModels(s.Subject); err != nil {
+			return nil, err
+		}
+		if _, err := s.TrainingPredicate(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: predicate type %q", ErrInvalidStatement, s.PredicateType)
+	}
+	return &s, nil
+}
+
+// DatasetPredicate decodes the predicate of the statement.
+func (s *Statement) DatasetPredicate() (*DatasetPredicate, error) {
+	if s.PredicateType != DatasetPredicateType {
+		return nil, fmt.Errorf("%w: predicate type %q", ErrInvalidStatement, s.PredicateType)
+	}
+	var p DatasetPredicate
+	if err := json.Unmarshal(s.Predicate, &p); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidStatement, err)
+	}
+	return &p, nil
+}
+
+// VerifyStatement verifies that the statement describes the
+// public data of the verifier: its subject digest must be the
+// root, and its predicate must carry the same suites and
+// public data. The other fields of the predicate are asserted
+// by the recorder, and cannot be verified.
+func (r *Verifier) VerifyStatement(s *Statement) error {
+	if s.Type != StatementType || len(s.Subject) != 1 {
+		return ErrInvalidStatement
+	}
+	p, err := s.DatasetPredicate()
+	if err != nil {
+		return err
+	}
+	v, err := NewVerifier(p.Public)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidStatement, err)
+	}
+	if !r.equal(v) {
+		return fmt.Errorf("%w: public data", ErrStatementMismatch)
+	}
+	if p.HashSuite != r.hash.String() || p.VRFSuite != vrfSuiteName(r.vrfSuite) ||
+		p.TreeVersion != int(r.version) {
+		return fmt.Errorf("%w: suites", ErrStatementMismatch)
+	}
+	if digest := s.Subject[0].Digest[digestName(r.hash)]; digest != hex.EncodeToString(r.treeHash) {
+		return fmt.Errorf("%w: subject digest %q", ErrStatementMismatch, digest)
+	}
+	return nil
+}
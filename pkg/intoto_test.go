@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
+)
+
+func Test_Statement(t *testing.T) {
+	t.Parallel()
+
+	r := newTreeHeadTestRecorder(t, "dataset", 4)
+	sources := []ResourceDescriptor{{
+		URI:    "file:///data/train.parquet",
+		Digest: map[string]string{"sha256": "00ff"},
+	}}
+	s, err := r.Statement(sources...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseStatement(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(s, got); diff != "" {
+		t.Fatalf("unexpected statement (-want +got): \n%s", diff)
+	}
+	p, err := got.DatasetPredicate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Records != 4 || p.HashSuite != HashSHAKE128 || p.VRFSuite != VRFCONIKS || p.TreeVersion != 2 {
+		t.Fatalf("unexpected predicate: %+v", p)
+	}
+	if diff := cmp.Diff(sources, p.Sources); diff != "" {
+		t.Fatalf("unexpected sources (-want +got): \n%s", diff)
+	}
+	if got.Subject[0].Name != "dataset" || got.Subject[0].Digest["github.com/laurentsimon/dataset-recorder/pkg/shake128"] != hex.EncodeToString(r.p.Hash()) {
+		t.Fatalf("unexpected subject: %+v", got.Subject)
+	}
+
+	public, err := r.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifier(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyStatement(got); err != nil {
+		t.Fatal(err)
+	}
+
+	// The subject must be the root.
+	altered := *got
+	altered.Subject = []ResourceDescriptor{{Name: "dataset", Digest: map[string]string{digestName(r.p.HashSuite()): "00"}}}
+	if err := v.VerifyStatement(&altered); !errors.Is(err, ErrStatementMismatch) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// The statement of another recorder does not verify.
+	other, err := newTreeHeadTestRecorder(t, "dataset", 5).Statement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyStatement(other); !errors.Is(err, ErrStatementMismatch) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func Test_StatementInvalid(t *testing.T) {
+	t.Parallel()
+
+	r, err := NewEmptyRecorder(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Statement(); !errors.Is(err, ErrInvalidStatement) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for _, b := range []string{
+		`not json`,
+		`{"_type":"https://in-toto.io/Statement/v0.1","subject":[{"name":"a"}],"predicateType":"` + DatasetPredicateType + `","predicate":{}}`,
+		`{"_type":"` + StatementType + `","subject":[{"name":"a"}],"predicateType":"https://slsa.dev/provenance/v1","predicate":{}}`,
+		`{"_type":"` + StatementType + `","subject":[],"predicateType":"` + DatasetPredicateType + `","predicate":{}}`,
+		`{"_type":"` + StatementType + `","subject":[{"name":"a"}],"predicateType":"` + DatasetPredicateType + `","predicate":[]}`,
+	} {
+		if _, err := ParseStatement([]byte(b)); !errors.Is(err, ErrInvalidStatement) {
+			t.Errorf("%s: unexpected err: %v", b, err)
+		}
+	}
+}
+
+func Test_digestName(t *testing.T) {
+	t.Parallel()
+
+	// Only SHA-256 has a registered in-toto digest name.
+	for h, want := range map[crypto.Hash]string{
+		crypto.SHA256:     "sha256",
+		crypto.SHAKE128:   "github.com/laurentsimon/dataset-recorder/pkg/shake128",
+		crypto.BLAKE2b256: "github.com/laurentsimon/dataset-recorder/pkg/blake2b256",
+	} {
+		if got := digestName(h); got != want {
+			t.Errorf("%v: got %q, want %q", h, got, want)
+		}
+	}
+}
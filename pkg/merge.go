@@ -0,0 +1,329 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/pad"
+)
+
+// MergePolicy decides what Merge does when a key
+// is recorded by both recorders.
+type MergePolicy int
+
+const (
+	// MergeError fails the merge if a key is
+	// recorded by both recorders.
+	MergeError MergePolicy = iota
+	// MergePreferLeft keeps the value of the left recorder.
+	MergePreferLeft
+	// MergePreferRight keeps the value of the right recorder.
+	MergePreferRight
+	// MergeRequireEqual keeps the value if both recorders
+	// agree, and fails the merge otherwise.
+	MergeRequireEqual
+)
+
+func (p MergePolicy) String() string {
+	switch p {
+	case MergeError:
+		return "error"
+	case MergePreferLeft:
+		return "prefer-left"
+	case MergePreferRight:
+		return "prefer-right"
+	case MergeRequireEqual:
+		return "require-equal"
+	}
+	return fmt.Sprintf("MergePolicy(%d)", int(p))
+}
+
+// parseMergePolicy returns the policy named s by String.
+func parseMergePolicy(s string) (MergePolicy, error) {
+	for _, p := range []MergePolicy{MergeError, MergePreferLeft, MergePreferRight, MergeRequireEqual} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unknown policy %q", ErrInvalidMergeReport, s)
+}
+
+var (
+	// ErrMergeConflict indicates a key recorded by both
+	// recorders is not allowed by the merge policy.
+	ErrMergeConflict = errors.New("merge conflict")
+	// ErrInvalidMergeReport indicates a merge report does
+	// not match the recorders' public data.
+	ErrInvalidMergeReport = errors.New("invalid merge report")
+)
+
+// MergeReport describes how two recorders were merged. Each record
+// comes with proofs of inclusion in its source recorder(s) and in the
+// merged recorder, so the report can be checked against the public
+// data of all three.
+type MergeReport struct {
+	Policy string `json:"policy"`
+	// Left, Right and Merged are the public data of the recorders.
+	Left   []byte `json:"left"`
+	Right  []byte `json:"right"`
+	Merged []byte `json:"merged"`
+	// Records are the records of the merged recorder.
+	Records []MergedRecord `json:"records"`
+	// Dropped are the values discarded by the merge policy.
+	Dropped []DroppedRecord `json:"dropped,omitempty"`
+}
+
+// MergedRecord is a record of the merged recorder.
+type MergedRecord struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	// LeftProof and RightProof are the proofs of inclusion in the
+	// source recorders. Only set for the recorders the value comes from.
+	LeftProof  []byte `json:"leftProof,omitempty"`
+	RightProof []byte `json:"rightProof,omitempty"`
+	// Proof is the proof of inclusion in the merged recorder.
+	Proof []byte `json:"proof"`
+}
+
+// DroppedRecord is a value discarded by the merge policy.
+type DroppedRecord struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	// Left is true if the value comes from the left recorder.
+	Left bool `json:"left"`
+	// Proof is the proof of inclusion in the source recorder.
+	Proof []byte `json:"proof"`
+}
+
+// Merge creates a new recorder with the records of a and b, indexed
+// under a new VRF key, or under the key set with WithPrivateKey.
+// The policy decides what happens to keys recorded by both.
+// Both recorders must store their keys. The merged recorder is
+// named after a and uses its suites, unless opts set them.
+func Merge(a, b *Recorder, policy MergePolicy, opts ...Option) (*Recorder, *MergeReport, error) {
+	left, err := recordMap(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	right, err := recordMap(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := make([]string, 0, len(left)+len(right))
+	for k := range left {
+		keys = append(keys, k)
+	}
+	for k := range right {
+		if _, ok := left[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	defaults := []Option{
+		WithName(a.name),
+		WithHashSuite(a.p.HashSuite().String()),
+	}
+	if s := a.p.VRFSuite(); s == pad.PublicIndex {
+		defaults = append(defaults, WithPublicIndex())
+	} else {
+		defaults = append(defaults, WithVRFSuite(s.String()))
+	}
+	r, err := NewEmptyRecorder(nil, append(defaults, opts...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	report := &MergeReport{
+		Policy: policy.String(),
+	}
+	for _, k := range keys {
+		key := []byte(k)
+		lv, lok := left[k]
+		rv, rok := right[k]
+		record := MergedRecord{
+			Key: key,
+		}
+		var fromLeft, fromRight bool
+		switch {
+		case lok && !rok:
+			record.Value, fromLeft = lv, true
+		case !lok && rok:
+			record.Value, fromRight = rv, true
+		case policy == MergeError:
+			return nil, nil, fmt.Errorf("%w: key %q", ErrMergeConflict, key)
+		case bytes.Equal(lv, rv):
+			record.Value, fromLeft, fromRight = lv, true, true
+		case policy == MergePreferLeft:
+			record.Value, fromLeft = lv, true
+			d, err := newDroppedRecord(b, key, rv, false)
+			if err != nil {
+				return nil, nil, err
+			}
+			report.Dropped = append(report.Dropped, *d)
+		case policy == MergePreferRight:
+			record.Value, fromRight = rv, true
+			d, err := newDroppedRecord(a, key, lv, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			report.Dropped = append(report.Dropped, *d)
+		default:
+			return nil, nil, fmt.Errorf("%w: key %q has different values", ErrMergeConflict, key)
+		}
+		if fromLeft {
+			if record.LeftProof, err = marshalProof(a, key); err != nil {
+				return nil, nil, err
+			}
+		}
+		if fromRight {
+			if record.RightProof, err = marshalProof(b, key); err != nil {
+				return nil, nil, err
+			}
+		}
+		if err := r.Insert(key, record.Value); err != nil {
+			return nil, nil, err
+		}
+		report.Records = append(report.Records, record)
+	}
+	// Proofs for the merged recorder are only valid
+	// once all records are inserted.
+	for i := range report.Records {
+		if report.Records[i].Proof, err = marshalProof(r, report.Records[i].Key); err != nil {
+			return nil, nil, err
+		}
+	}
+	if report.Left, err = a.Public(); err != nil {
+		return nil, nil, err
+	}
+	if report.Right, err = b.Public(); err != nil {
+		return nil, nil, err
+	}
+	if report.Merged, err = r.Public(); err != nil {
+		return nil, nil, err
+	}
+	return r, report, nil
+}
+
+func recordMap(r *Recorder) (map[string][]byte, error) {
+	records := make(map[string][]byte)
+	err := r.p.Records(func(key, value []byte) error {
+		records[string(key)] = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func marshalProof(r *Recorder, key []byte) ([]byte, error) {
+	proof, err := r.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return proof.MarshalBinary()
+}
+
+func newDroppedRecord(r *Recorder, key, value []byte, left bool) (*DroppedRecord, error) {
+	proof, err := marshalProof(r, key)
+	if err != nil {
+		return nil, err
+	}
+	return &DroppedRecord{
+		Key:   key,
+		Value: value,
+		Left:  left,
+		Proof: proof,
+	}, nil
+}
+
+// Verify checks the report against the public data of the source
+// recorders and of the merged recorder, and that it follows its policy.
+func (m *MergeReport) Verify(leftPublic, rightPublic, mergedPublic []byte) error {
+	if !bytes.Equal(m.Left, leftPublic) || !bytes.Equal(m.Right, rightPublic) ||
+		!bytes.Equal(m.Merged, mergedPublic) {
+		return fmt.Errorf("%w: public data mismatch", ErrInvalidMergeReport)
+	}
+	policy, err := parseMergePolicy(m.Policy)
+	if err != nil {
+		return err
+	}
+	left, err := NewVerifier(leftPublic)
+	if err != nil {
+		return err
+	}
+	right, err := NewVerifier(rightPublic)
+	if err != nil {
+		return err
+	}
+	merged, err := NewVerifier(mergedPublic)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]*MergedRecord)
+	for i := range m.Records {
+		r := &m.Records[i]
+		if seen[string(r.Key)] != nil {
+			return fmt.Errorf("%w: duplicate key %q", ErrInvalidMergeReport, r.Key)
+		}
+		seen[string(r.Key)] = r
+		if r.LeftProof == nil && r.RightProof == nil {
+			return fmt.Errorf("%w: key %q has no source", ErrInvalidMergeReport, r.Key)
+		}
+		if policy == MergeError && r.LeftProof != nil && r.RightProof != nil {
+			return fmt.Errorf("%w: key %q in both recorders under policy %s", ErrInvalidMergeReport, r.Key, policy)
+		}
+		if r.LeftProof != nil {
+			if err := verifyMarshaledInclusion(left, r.LeftProof, r.Key, r.Value); err != nil {
+				return fmt.Errorf("%w: key %q: left: %w", ErrInvalidMergeReport, r.Key, err)
+			}
+		}
+		if r.RightProof != nil {
+			if err := verifyMarshaledInclusion(right, r.RightProof, r.Key, r.Value); err != nil {
+				return fmt.Errorf("%w: key %q: right: %w", ErrInvalidMergeReport, r.Key, err)
+			}
+		}
+		if err := verifyMarshaledInclusion(merged, r.Proof, r.Key, r.Value); err != nil {
+			return fmt.Errorf("%w: key %q: merged: %w", ErrInvalidMergeReport, r.Key, err)
+		}
+	}
+	dropped := make(map[string]bool)
+	for _, d := range m.Dropped {
+		// Only the prefer policies drop values, and
+		// only those of the other recorder.
+		switch {
+		case policy != MergePreferLeft && policy != MergePreferRight:
+			return fmt.Errorf("%w: dropped key %q under policy %s", ErrInvalidMergeReport, d.Key, policy)
+		case d.Left != (policy == MergePreferRight):
+			return fmt.Errorf("%w: dropped key %q from the preferred recorder", ErrInvalidMergeReport, d.Key)
+		case dropped[string(d.Key)]:
+			return fmt.Errorf("%w: duplicate dropped key %q", ErrInvalidMergeReport, d.Key)
+		}
+		dropped[string(d.Key)] = true
+		r := seen[string(d.Key)]
+		if r == nil {
+			return fmt.Errorf("%w: dropped key %q not merged", ErrInvalidMergeReport, d.Key)
+		}
+		if (policy == MergePreferLeft && r.LeftProof == nil) || (policy == MergePreferRight && r.RightProof == nil) {
+			return fmt.Errorf("%w: dropped key %q not merged from the preferred recorder", ErrInvalidMergeReport, d.Key)
+		}
+		v := right
+		if d.Left {
+			v = left
+		}
+		if err := verifyMarshaledInclusion(v, d.Proof, d.Key, d.Value); err != nil {
+			return fmt.Errorf("%w: dropped key %q: %w", ErrInvalidMergeReport, d.Key, err)
+		}
+	}
+	return nil
+}
+
+func verifyMarshaledInclusion(v *Verifier, b, key, value []byte) error {
+	var proof Proof
+	if err := proof.UnmarshalBinary(b); err != nil {
+		return err
+	}
+	return v.VerifyInclusion(proof, key, value)
+}
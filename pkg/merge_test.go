@@ -0,0 +1,244 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/pad"
+)
+
+// newMergeTestRecorder creates a recorder with keys [from, to).
+// Keys in conflict get a value specific to the recorder.
+func newMergeTestRecorder(t *testing.T, from, to int, conflict map[int]bool, tag string) *Recorder {
+	r, err := NewEmptyRecorder(nil, WithName(tag))
+	if err != nil {
+		t.Fatalf("cannot create recorder: %v", err)
+	}
+	for i := from; i < to; i++ {
+		key := "key" + fmt.Sprint(i)
+		value := []byte("value" + fmt.Sprint(i))
+		if conflict[i] {
+			value = append(value, []byte(tag)...)
+		}
+		if err := r.Insert([]byte(key), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func Test_Merge(t *testing.T) {
+	t.Parallel()
+
+	// Keys 5 to 9 are in both, and 7 has different values.
+	conflict := map[int]bool{7: true}
+	left := newMergeTestRecorder(t, 0, 10, conflict, "left")
+	right := newMergeTestRecorder(t, 5, 15, conflict, "right")
+	leftPublic, err := left.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rightPublic, err := right.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		policy  MergePolicy
+		err     error
+		value7  string
+		dropped int
+	}{
+		{
+			name:   "error",
+			policy: MergeError,
+			err:    ErrMergeConflict,
+		},
+		{
+			name:   "require equal",
+			policy: MergeRequireEqual,
+			err:    ErrMergeConflict,
+		},
+		{
+			name:    "prefer left",
+			policy:  MergePreferLeft,
+			value7:  "value7left",
+			dropped: 1,
+		},
+		{
+			name:    "prefer right",
+			policy:  MergePreferRight,
+			value7:  "value7right",
+			dropped: 1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			m, report, err := Merge(left, right, tt.policy, WithLabel("merged", "true"))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if len(report.Records) != 15 || len(report.Dropped) != tt.dropped {
+				t.Fatalf("unexpected report: %d records, %d dropped", len(report.Records), len(report.Dropped))
+			}
+			h, err := m.Header()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Name != "left" || h.Records != 15 || h.Labels["merged"] != "true" {
+				t.Fatalf("unexpected header: %+v", h)
+			}
+			records, err := recordMap(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.value7, string(records["key7"])); diff != "" {
+				t.Fatalf("unexpected err (-want +got): \n%s", diff)
+			}
+			mergedPublic, err := m.Public()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The merged recorder uses a new key.
+			for _, public := range [][]byte{leftPublic, rightPublic} {
+				source, err := pad.ParsePublic(public)
+				if err != nil {
+					t.Fatal(err)
+				}
+				merged, err := pad.ParsePublic(mergedPublic)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bytes.Equal(merged.VRFKey, source.VRFKey) {
+					t.Fatal("merged recorder re-uses a source key")
+				}
+			}
+			if err := report.Verify(leftPublic, rightPublic, mergedPublic); err != nil {
+				t.Fatal(err)
+			}
+			// Swapped sources are rejected.
+			if err := report.Verify(rightPublic, leftPublic, mergedPublic); !errors.Is(err, ErrInvalidMergeReport) {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			// Tampered values are rejected.
+			report.Records[0].Value = []byte("tampered")
+			if err := report.Verify(leftPublic, rightPublic, mergedPublic); !errors.Is(err, ErrInvalidMergeReport) {
+				t.Fatalf("unexpected err: %v", err)
+			}
+		})
+	}
+}
+
+func Test_MergeEqual(t *testing.T) {
+	t.Parallel()
+
+	left := newMergeTestRecorder(t, 0, 10, nil, "left")
+	right := newMergeTestRecorder(t, 5, 15, nil, "right")
+	// Equal values are conflicts only under MergeError.
+	if _, _, err := Merge(left, right, MergeError); !errors.Is(err, ErrMergeConflict) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	m, report, err := Merge(left, right, MergeRequireEqual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range report.Records {
+		both := r.LeftProof != nil && r.RightProof != nil
+		if want := bytes.Compare(r.Key, []byte("key5")) >= 0 && bytes.Compare(r.Key, []byte("key9")) <= 0; both != want {
+			t.Fatalf("unexpected sources for %q", r.Key)
+		}
+	}
+	// Merge survives a round trip.
+	var b bytes.Buffer
+	if err := m.WriteInternal(&b); err != nil {
+		t.Fatal(err)
+	}
+	m2, err := NewRecorderFromReader(&b, m.Private())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m3, _, err := Merge(m2, left, MergeRequireEqual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m3.p.Len() != 15 {
+		t.Fatalf("unexpected records: %d", m3.p.Len())
+	}
+}
+
+func Test_MergeWithPrivateKey(t *testing.T) {
+	t.Parallel()
+
+	left := newMergeTestRecorder(t, 0, 10, nil, "left")
+	right := newMergeTestRecorder(t, 5, 15, nil, "right")
+	target, err := NewEmptyRecorder(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _, err := Merge(left, right, MergeRequireEqual, WithPrivateKey(target.Private()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(target.Private(), m.Private()); diff != "" {
+		t.Fatalf("unexpected key (-want +got): \n%s", diff)
+	}
+
+	// Keys of another suite are rejected.
+	if _, _, err := Merge(left, right, MergeRequireEqual, WithPrivateKey(target.Private()), WithVRFSuite(VRFP256TAI)); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, _, err := Merge(left, right, MergeRequireEqual, WithPrivateKey(target.Private()), WithPublicIndex()); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func Test_MergeReportPolicy(t *testing.T) {
+	t.Parallel()
+
+	conflict := map[int]bool{7: true}
+	left := newMergeTestRecorder(t, 0, 10, conflict, "left")
+	right := newMergeTestRecorder(t, 5, 15, conflict, "right")
+	verify := func(report *MergeReport) error {
+		return report.Verify(report.Left, report.Right, report.Merged)
+	}
+
+	// A report with dropped values contradicts the policies
+	// that do not drop any.
+	_, report, err := Merge(left, right, MergePreferLeft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(report); err != nil {
+		t.Fatal(err)
+	}
+	for _, policy := range []string{MergeError.String(), MergeRequireEqual.String(), MergePreferRight.String(), "unknown"} {
+		altered := *report
+		altered.Policy = policy
+		if err := verify(&altered); !errors.Is(err, ErrInvalidMergeReport) {
+			t.Errorf("%s: unexpected err: %v", policy, err)
+		}
+	}
+
+	// A report with keys from both recorders contradicts MergeError.
+	equal := newMergeTestRecorder(t, 5, 15, nil, "right")
+	_, report, err = Merge(newMergeTestRecorder(t, 0, 10, nil, "left"), equal, MergeRequireEqual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(report); err != nil {
+		t.Fatal(err)
+	}
+	report.Policy = MergeError.String()
+	if err := verify(report); !errors.Is(err, ErrInvalidMergeReport) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
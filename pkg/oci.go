@@ -0,0 +1,365 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Media types of the artifacts of recordings in OCI layouts.
+const (
+	// ArtifactType is the artifact type of the manifests
+	// of recordings.
+	ArtifactType = "application/vnd.dataset-recorder.artifact.v1"
+	// StateMediaType is the media type of the state of a
+	// recorder, as written by Recorder.WriteInternal().
+	StateMediaType = "application/vnd.dataset-recorder.state.v1"
+	// PublicMediaType is the media type of public data.
+	PublicMediaType = "application/vnd.dataset-recorder.public.v1+json"
+	// TreeHeadMediaType is the media type of signed tree heads.
+	TreeHeadMediaType = "application/vnd.dataset-recorder.treehead.v1+json"
+	// EnvelopeMediaType is the media type of DSSE envelopes.
+	EnvelopeMediaType = "application/vnd.dsse.envelope.v1+json"
+	// StatementMediaType is the media type of in-toto statements.
+	StatementMediaType = "application/vnd.in-toto+json"
+	// BOMMediaType is the media type of SPDX documents.
+	BOMMediaType = "application/spdx+json"
+)
+
+// OCI image layout.
+const (
+	ociLayoutFile     = "oci-layout"
+	ociLayoutVersion  = "1.0.0"
+	ociIndexMediaType = "application/vnd.oci.image.index.v1+json"
+	ociManifestType   = "application/vnd.oci.image.manifest.v1+json"
+	ociEmptyMediaType = "application/vnd.oci.empty.v1+json"
+	ociRefName        = "org.opencontainers.image.ref.name"
+	ociTitle          = "org.opencontainers.image.title"
+)
+
+var (
+	// ErrInvalidLayout indicates an OCI layout is malformed,
+	// or has no recording.
+	ErrInvalidLayout = errors.New("[oci] invalid layout")
+	// ErrDigestMismatch indicates a blob of an OCI layout
+	// does not match its digest.
+	ErrDigestMismatch = errors.New("[oci] mismatch digest")
+)
+
+// Attestation is an attestation about a recording, such as a
+// DSSE envelope, an in-toto statement, a Sigstore bundle or a BOM.
+type Attestation struct {
+	MediaType string
+	Data      []byte
+}
+
+// Artifacts are the artifacts of a recording. The private key
+// of the recorder is not part of them.
+type Artifacts struct {
+	// State is the state of the recorder, as written by
+	// Recorder.WriteInternal(). It may be empty to only
+	// distribute the public data.
+	State        []byte
+	Public       []byte
+	TreeHeads    []SignedTreeHead
+	Attestations []Attestation
+}
+
+// Artifacts returns the state and public data of the recorder.
+func (r *Recorder) Artifacts() (*Artifacts, error) {
+	var state bytes.Buffer
+	if err := r.WriteInternal(&state); err != nil {
+		return nil, err
+	}
+	public, err := r.Public()
+	if err != nil {
+		return nil, err
+	}
+	return &Artifacts{State: state.Bytes(), Public: public}, nil
+}
+
+type ociDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Data         []byte            `json:"data,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        ociDescriptor     `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+// ociBlobPath returns the path of the blob with digest
+// in the layout at path.
+func ociBlobPath(path, digest string) (string, error) {
+	alg, h, ok := strings.Cut(digest, ":")
+	if !ok || alg != "sha256" || len(h) != 2*sha256.Size {
+		return "", fmt.Errorf("%w: digest %q", ErrInvalidLayout, digest)
+	}
+	if _, err := hex.DecodeString(h); err != nil {
+		return "", fmt.Errorf("%w: digest %q", ErrInvalidLayout, digest)
+	}
+	return filepath.Join(path, "blobs", alg, h), nil
+}
+
+// writeBlob writes b in the layout at path,
+// and returns its descriptor.
+func writeBlob(path, mediaType string, b []byte) (ociDescriptor, error) {
+	h := sha256.Sum256(b)
+	d := ociDescriptor{
+		MediaType: mediaType,
+		Digest:    "sha256:" + hex.EncodeToString(h[:]),
+		Size:      int64(len(b)),
+	}
+	p, err := ociBlobPath(path, d.Digest)
+	if err != nil {
+		return d, err
+	}
+	if _, err := os.Stat(p); err == nil {
+		return d, nil
+	}
+	return d, os.WriteFile(p, b, 0o644)
+}
+
+// readBlob reads the blob of d in the layout
+// at path, and checks its digest.
+func readBlob(path string, d *ociDescriptor) ([]byte, error) {
+	p, err := ociBlobPath(path, d.Digest)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(b)
+	if int64(len(b)) != d.Size || "sha256:"+hex.EncodeToString(h[:]) != d.Digest {
+		return nil, fmt.Errorf("%w: %s", ErrDigestMismatch, d.Digest)
+	}
+	return b, nil
+}
+
+func readIndex(path string) (*ociIndex, error) {
+	b, err := os.ReadFile(filepath.Join(path, ociLayoutFile))
+	if err != nil {
+		return nil, err
+	}
+	var layout struct {
+		Version string `json:"imageLayoutVersion"`
+	}
+	if err := json.Unmarshal(b, &layout); err != nil || layout.Version != ociLayoutVersion {
+		return nil, fmt.Errorf("%w: layout version", ErrInvalidLayout)
+	}
+	b, err = os.ReadFile(filepath.Join(path, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	var index ociIndex
+	if err := json.Unmarshal(b, &index); err != nil || index.SchemaVersion != 2 {
+		return nil, fmt.Errorf("%w: index", ErrInvalidLayout)
+	}
+	return &index, nil
+}
+
+// WriteLayout writes the artifacts in the OCI image layout at path,
+// under tag. The layout is created if it does not exist. A recording
+// already under tag is replaced.
+func WriteLayout(path, tag string, a *Artifacts) error {
+	if tag == "" {
+		return fmt.Errorf("%w: empty tag", ErrInvalidLayout)
+	}
+	if len(a.Public) == 0 {
+		return fmt.Errorf("%w: no public data", ErrInvalidLayout)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "blobs", "sha256"), 0o755); err != nil {
+		return err
+	}
+	index, err := readIndex(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = os.WriteFile(filepath.Join(path, ociLayoutFile), []byte(`{"imageLayoutVersion":"`+ociLayoutVersion+`"}`), 0o644)
+		index = &ociIndex{SchemaVersion: 2, MediaType: ociIndexMediaType}
+	}
+	if err != nil {
+		return err
+	}
+
+	type layer struct {
+		mediaType, title string
+		data             []byte
+	}
+	var layers []layer
+	if len(a.State) != 0 {
+		layers = append(layers, layer{StateMediaType, "state", a.State})
+	}
+	layers = append(layers, layer{PublicMediaType, "public.json", a.Public})
+	for i := range a.TreeHeads {
+		b, err := json.Marshal(&a.TreeHeads[i])
+		if err != nil {
+			return err
+		}
+		layers = append(layers, layer{TreeHeadMediaType, fmt.Sprintf("treehead-%d.json", i), b})
+	}
+	for i, at := range a.Attestations {
+		if at.MediaType == "" {
+			return fmt.Errorf("%w: attestation %d has no media type", ErrInvalidLayout, i)
+		}
+		layers = append(layers, layer{at.MediaType, fmt.Sprintf("attestation-%d", i), at.Data})
+	}
+
+	config, err := writeBlob(path, ociEmptyMediaType, []byte("{}"))
+	if err != nil {
+		return err
+	}
+	config.Data = []byte("{}")
+	m := ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestType,
+		ArtifactType:  ArtifactType,
+		Config:        config,
+	}
+	for _, l := range layers {
+		d, err := writeBlob(path, l.mediaType, l.data)
+		if err != nil {
+			return err
+		}
+		d.Annotations = map[string]string{ociTitle: l.title}
+		m.Layers = append(m.Layers, d)
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	d, err := writeBlob(path, ociManifestType, b)
+	if err != nil {
+		return err
+	}
+	d.ArtifactType = ArtifactType
+	d.Annotations = map[string]string{ociRefName: tag}
+
+	manifests := []ociDescriptor{}
+	for _, md := range index.Manifests {
+		if md.Annotations[ociRefName] != tag {
+			manifests = append(manifests, md)
+		}
+	}
+	index.Manifests = append(manifests, d)
+	b, err = json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(path, "index.json"), b, 0o644)
+}
+
+// ReadLayout reads the artifacts under tag in the OCI image layout
+// at path. If tag is empty, the layout must hold a single recording.
+func ReadLayout(path, tag string) (*Artifacts, error) {
+	index, err := readIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	var found []*ociDescriptor
+	for i := range index.Manifests {
+		d := &index.Manifests[i]
+		if d.MediaType != ociManifestType || d.ArtifactType != ArtifactType {
+			continue
+		}
+		if tag == "" || d.Annotations[ociRefName] == tag {
+			found = append(found, d)
+		}
+	}
+	if len(found) != 1 {
+		return nil, fmt.Errorf("%w: %d recordings under tag %q", ErrInvalidLayout, len(found), tag)
+	}
+	b, err := readBlob(path, found[0])
+	if err != nil {
+		return nil, err
+	}
+	var m ociManifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%w: manifest: %w", ErrInvalidLayout, err)
+	}
+	if m.ArtifactType != ArtifactType {
+		return nil, fmt.Errorf("%w: artifact type %q", ErrInvalidLayout, m.ArtifactType)
+	}
+
+	var a Artifacts
+	for i := range m.Layers {
+		d := &m.Layers[i]
+		b, err := readBlob(path, d)
+		if err != nil {
+			return nil, err
+		}
+		switch d.MediaType {
+		case StateMediaType:
+			a.State = b
+		case PublicMediaType:
+			a.Public = b
+		case TreeHeadMediaType:
+			var s SignedTreeHead
+			if err := json.Unmarshal(b, &s); err != nil {
+				return nil, fmt.Errorf("%w: tree head: %w", ErrInvalidLayout, err)
+			}
+			a.TreeHeads = append(a.TreeHeads, s)
+		default:
+			a.Attestations = append(a.Attestations, Attestation{MediaType: d.MediaType, Data: b})
+		}
+	}
+	if a.Public == nil {
+		return nil, fmt.Errorf("%w: no public data", ErrInvalidLayout)
+	}
+	return &a, nil
+}
+
+// NewRecorderFromLayout creates a recorder from the state under
+// tag in the OCI image layout at path, with its private key.
+func NewRecorderFromLayout(path, tag string, private []byte) (*Recorder, error) {
+	a, err := ReadLayout(path, tag)
+	if err != nil {
+		return nil, err
+	}
+	if len(a.State) == 0 {
+		return nil, fmt.Errorf("%w: no state", ErrInvalidLayout)
+	}
+	r, err := NewRecorderFromReader(bytes.NewReader(a.State), private)
+	if err != nil {
+		return nil, err
+	}
+	public, err := r.Public()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(public, a.Public) {
+		return nil, fmt.Errorf("%w: state does not match public data", ErrInvalidLayout)
+	}
+	return r, nil
+}
+
+// NewVerifierFromLayout creates a verifier from the public
+// data under tag in the OCI image layout at path.
+func NewVerifierFromLayout(path, tag string) (*Verifier, error) {
+	a, err := ReadLayout(path, tag)
+	if err != nil {
+		return nil, err
+	}
+	return NewVerifier(a.Public)
+}
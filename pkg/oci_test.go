@@ -0,0 +1,150 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_Layout(t *testing.T) {
+	t.Parallel()
+
+	r := newTreeHeadTestRecorder(t, "dataset", 5)
+	a, err := r.Artifacts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, _, _ := newTestSignedTreeHead(t)
+	a.TreeHeads = []SignedTreeHead{*signed}
+	s, err := r.Statement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Attestations = []Attestation{{MediaType: StatementMediaType, Data: b}}
+
+	path := filepath.Join(t.TempDir(), "layout")
+	if err := WriteLayout(path, "v1", a); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadLayout(path, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(a, got); diff != "" {
+		t.Fatalf("unexpected artifacts (-want +got): \n%s", diff)
+	}
+	// The only recording is read without tag.
+	if _, err := ReadLayout(path, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	nr, err := NewRecorderFromLayout(path, "v1", r.Private())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nr.Insert([]byte("key5"), []byte{5}); err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifierFromLayout(path, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := r.get([]byte("key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyInclusion(*proof, []byte("key1"), []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	// Another private key.
+	other := newTreeHeadTestRecorder(t, "dataset", 1)
+	if _, err := NewRecorderFromLayout(path, "v1", other.Private()); err == nil {
+		t.Fatalf("recorder created with another private key")
+	}
+
+	// Public data only, under another tag.
+	na, err := nr.Artifacts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	na.State = nil
+	if err := WriteLayout(path, "v2", na); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadLayout(path, ""); !errors.Is(err, ErrInvalidLayout) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := NewRecorderFromLayout(path, "v2", r.Private()); !errors.Is(err, ErrInvalidLayout) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if got, err = ReadLayout(path, "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(na, got); diff != "" {
+		t.Fatalf("unexpected artifacts (-want +got): \n%s", diff)
+	}
+	// Replacing a tag keeps the other tags.
+	if err := WriteLayout(path, "v1", na); err != nil {
+		t.Fatal(err)
+	}
+	var index ociIndex
+	b, err = os.ReadFile(filepath.Join(path, "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 2 {
+		t.Fatalf("unexpected manifests: %d", len(index.Manifests))
+	}
+	if _, err := ReadLayout(path, "v3"); !errors.Is(err, ErrInvalidLayout) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func Test_LayoutTampered(t *testing.T) {
+	t.Parallel()
+
+	r := newTreeHeadTestRecorder(t, "dataset", 2)
+	a, err := r.Artifacts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir()
+	if err := WriteLayout(path, "latest", a); err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.Sum256(a.Public)
+	p, err := ociBlobPath(path, "sha256:"+hex.EncodeToString(h[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := newTreeHeadTestRecorder(t, "dataset", 2)
+	public, err := other.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, public, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVerifierFromLayout(path, "latest"); !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := WriteLayout(path, "", a); !errors.Is(err, ErrInvalidLayout) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := ReadLayout(t.TempDir(), ""); err == nil {
+		t.Fatalf("read an empty directory")
+	}
+}
@@ -0,0 +1,96 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// TrainingPredicateType is the type of predicates describing
+// the datasets a model was trained on.
+const TrainingPredicateType = "https://github.com/laurentsimon/dataset-recorder/training/v1"
+
+var (
+	// ErrDatasetNotFound indicates a training statement references
+	// no valid tree head of a dataset.
+	ErrDatasetNotFound = errors.New("[verifier] dataset not found in training statement")
+)
+
+// TrainingPredicate describes the training of the models
+// that are the subjects of its statement.
+type TrainingPredicate struct {
+	// Datasets are the signed tree heads of the datasets
+	// the models were trained on.
+	Datasets []SignedTreeHead `json:"datasets"`
+	// Parameters are the training parameters.
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// checkModels checks that the models all have a digest.
+func checkModels(models []ResourceDescriptor) error {
+	if len(models) == 0 {
+		return fmt.Errorf("%w: no model", ErrInvalidStatement)
+	}
+	for _, m := range models {
+		if len(m.Digest) == 0 {
+			return fmt.Errorf("%w: model %q has no digest", ErrInvalidStatement, m.Name)
+		}
+	}
+	return nil
+}
+
+// NewTrainingStatement returns an in-toto statement that the models
+// were trained on the datasets of the tree heads, with parameters.
+func NewTrainingStatement(models []ResourceDescriptor, datasets []SignedTreeHead, parameters map[string]interface{}) (*Statement, error) {
+	if err := checkModels(models); err != nil {
+		return nil, err
+	}
+	if len(datasets) == 0 {
+		return nil, fmt.Errorf("%w: no dataset", ErrInvalidStatement)
+	}
+	predicate, err := json.Marshal(TrainingPredicate{
+		Datasets:   datasets,
+		Parameters: parameters,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Statement{
+		Type:          StatementType,
+		Subject:       models,
+		PredicateType: TrainingPredicateType,
+		Predicate:     predicate,
+	}, nil
+}
+
+// TrainingPredicate decodes the predicate of the statement.
+func (s *Statement) TrainingPredicate() (*TrainingPredicate, error) {
+	if s.PredicateType != TrainingPredicateType {
+		return nil, fmt.Errorf("%w: predicate type %q", ErrInvalidStatement, s.PredicateType)
+	}
+	var p TrainingPredicate
+	if err := json.Unmarshal(s.Predicate, &p); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidStatement, err)
+	}
+	return &p, nil
+}
+
+// VerifyTraining verifies that the training statement references
+// a tree head of the verifier's public data, signed by key. To check
+// a model trained on several datasets, call it with the verifier
+// of each dataset.
+func (r *Verifier) VerifyTraining(s *Statement, key *VerificationKey) error {
+	if s.Type != StatementType {
+		return ErrInvalidStatement
+	}
+	p, err := s.TrainingPredicate()
+	if err != nil {
+		return err
+	}
+	for i := range p.Datasets {
+		if err := r.VerifyTreeHead(&p.Datasets[i], key); err == nil {
+			return nil
+		}
+	}
+	return ErrDatasetNotFound
+}
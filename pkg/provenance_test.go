@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_TrainingStatement(t *testing.T) {
+	t.Parallel()
+
+	key, err := GenerateSigningKey(nil, SignatureEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vkey, err := key.VerificationKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		heads     []SignedTreeHead
+		verifiers []*Verifier
+	)
+	for _, entries := range []int{3, 4} {
+		r := newTreeHeadTestRecorder(t, "dataset", entries)
+		head, err := r.TreeHead()
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed, err := head.Sign(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		heads = append(heads, *signed)
+		public, err := r.Public()
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := NewVerifier(public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifiers = append(verifiers, v)
+	}
+
+	models := []ResourceDescriptor{{
+		Name:   "model.safetensors",
+		Digest: map[string]string{"sha256": "abcd"},
+	}}
+	parameters := map[string]interface{}{"epochs": 3.0, "optimizer": "adam"}
+	s, err := NewTrainingStatement(models, heads, parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseStatement(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := got.TrainingPredicate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(parameters, p.Parameters); diff != "" {
+		t.Fatalf("unexpected parameters (-want +got): \n%s", diff)
+	}
+	for _, v := range verifiers {
+		if err := v.VerifyTraining(got, vkey); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A dataset that is not referenced.
+	other := newTreeHeadTestRecorder(t, "dataset", 5)
+	public, err := other.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifier(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyTraining(got, vkey); !errors.Is(err, ErrDatasetNotFound) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Tree heads signed by another key.
+	otherKey, err := GenerateSigningKey(nil, SignatureEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherVKey, err := otherKey.VerificationKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifiers[0].VerifyTraining(got, otherVKey); !errors.Is(err, ErrDatasetNotFound) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Dataset statements are not training statements.
+	ds, err := other.Statement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyTraining(ds, vkey); !errors.Is(err, ErrInvalidStatement) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func Test_TrainingStatementInvalid(t *testing.T) {
+	t.Parallel()
+
+	if _, err := NewTrainingStatement(nil, []SignedTreeHead{{}}, nil); !errors.Is(err, ErrInvalidStatement) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	models := []ResourceDescriptor{{Name: "model"}}
+	if _, err := NewTrainingStatement(models, []SignedTreeHead{{}}, nil); !errors.Is(err, ErrInvalidStatement) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	models[0].Digest = map[string]string{"sha256": "abcd"}
+	if _, err := NewTrainingStatement(models, nil, nil); !errors.Is(err, ErrInvalidStatement) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	b := `{"_type":"` + StatementType + `","subject":[{"name":"model"}],"predicateType":"` + TrainingPredicateType + `","predicate":{}}`
+	if _, err := ParseStatement([]byte(b)); !errors.Is(err, ErrInvalidStatement) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package pkg
 
 import (
+	"errors"
+	"fmt"
 	"io"
 
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/pad"
@@ -15,6 +17,33 @@ type Proof struct {
 	proof pad.Proof
 }
 
+const proofVersion = 0x01
+
+var (
+	// ErrInvalidProof indicates a proof cannot be decoded.
+	ErrInvalidProof = errors.New("invalid proof")
+)
+
+// MarshalBinary encodes the proof.
+func (p *Proof) MarshalBinary() ([]byte, error) {
+	b, err := p.proof.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{proofVersion}, b...), nil
+}
+
+// UnmarshalBinary decodes data into the proof.
+func (p *Proof) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("%w: empty", ErrInvalidProof)
+	}
+	if data[0] != proofVersion {
+		return fmt.Errorf("%w: version not supported (%v)", ErrInvalidVersion, data[0])
+	}
+	return p.proof.UnmarshalBinary(data[1:])
+}
+
 func NewProverFromReader(reader io.Reader, private []byte) (*Prover, error) {
 	r, err := NewRecorderFromReader(reader, private)
 	if err != nil {
@@ -40,3 +69,40 @@ func (p *Prover) Get(key []byte) (*Proof, error) {
 		proof: *proof,
 	}, nil
 }
+
+// Opening discloses the value committed to by a membership proof.
+type Opening struct {
+	Value []byte `json:"value"`
+	Salt  []byte `json:"salt"`
+}
+
+// GetMembership returns a proof that the key is recorded, which
+// discloses the commitment to the value but not the value itself.
+// The value can be disclosed later with Open. It returns
+// ErrProofType if the key is not recorded.
+func (p *Prover) GetMembership(key []byte) (*Proof, error) {
+	proof, err := p.Recorder.p.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	membership, err := proof.Membership()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProofType, err)
+	}
+	return &Proof{
+		proof: *membership,
+	}, nil
+}
+
+// Open returns the opening of the commitment of the key's
+// value, to be verified with Verifier.VerifyOpening.
+func (p *Prover) Open(key []byte) (*Opening, error) {
+	value, salt, err := p.Recorder.p.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Opening{
+		Value: value,
+		Salt:  salt,
+	}, nil
+}
@@ -0,0 +1,208 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/pad"
+)
+
+func Test_PublicIndex(t *testing.T) {
+	t.Parallel()
+
+	testSuiteRoundTrip(t, WithPublicIndex())
+	testSuiteRoundTrip(t, WithPublicIndex(), WithHashSuite(HashBLAKE2b256))
+
+	r, err := NewEmptyRecorder(nil, WithPublicIndex())
+	if err != nil {
+		t.Fatalf("cannot create recorder: %v", err)
+	}
+	if len(r.Private()) != 0 {
+		t.Fatal("unexpected private key")
+	}
+	for i := 0; i < 5; i++ {
+		if err := r.Insert([]byte(fmt.Sprint("key", i)), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	public, err := r.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := pad.ParsePublic(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.IndexMode != pad.IndexModePublic || p.VRFSuite != "" || p.VRFKey != nil {
+		t.Fatalf("unexpected public data: %s", public)
+	}
+	h, err := r.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.VRFSuite != "" {
+		t.Fatalf("unexpected vrf suite: %q", h.VRFSuite)
+	}
+
+	v, err := NewVerifier(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := r.get([]byte("key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.proof.VRFProof()) != 0 {
+		t.Fatal("proof carries a vrf proof")
+	}
+	if err := v.VerifyInclusion(*proof, []byte("key1"), []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyInclusion(*proof, []byte("key2"), []byte{1}); !errors.Is(err, ErrInvalidIndex) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// Proofs of a VRF recorder with the same records do not verify.
+	r2, err := NewEmptyRecorder(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r2.Insert([]byte("key1"), []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	proof2, err := r2.get([]byte("key1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyInclusion(*proof2, []byte("key1"), []byte{1}); !errors.Is(err, ErrInvalidIndex) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func Test_PublicIndexDeterministic(t *testing.T) {
+	t.Parallel()
+
+	seed := []byte("a secret seed")
+	r1 := newDeterministicForTest(t, seed, []int{0, 1, 2, 3}, WithPublicIndex())
+	r2 := newDeterministicForTest(t, seed, []int{3, 2, 1, 0}, WithPublicIndex())
+	state := writeDeterministicForTest(t, r1)
+	if !bytes.Equal(state, writeDeterministicForTest(t, r2)) {
+		t.Fatal("same records give different states")
+	}
+
+	// Reloading needs the secret to resume deterministically.
+	r3 := newDeterministicForTest(t, seed, []int{0, 1}, WithPublicIndex())
+	r3, err := NewRecorderFromReader(bytes.NewReader(writeDeterministicForTest(t, r3)), r1.Private())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{2, 3} {
+		if err := r3.Insert([]byte(fmt.Sprint("key", i)), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(state, writeDeterministicForTest(t, r3)) {
+		t.Fatal("reloaded recorder gives a different state")
+	}
+}
+
+func Test_PublicIndexSalvage(t *testing.T) {
+	t.Parallel()
+
+	r, err := NewEmptyRecorder(nil, WithPublicIndex(), WithHashSuite(HashSHA256), WithTreeVersion(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := r.Insert([]byte(fmt.Sprint("key", i)), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := r.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without a header, the mode is found from the tree.
+	var b bytes.Buffer
+	b.Write([]byte{versionNoHeader})
+	if err := r.p.WriteInternal(&b); err != nil {
+		t.Fatal(err)
+	}
+	r2, report, err := Salvage(&b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.VRFSuite != "" {
+		t.Fatalf("unexpected suite: %+v", report)
+	}
+	got, err := r2.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected err (-want +got): \n%s", diff)
+	}
+}
+
+func Test_PublicIndexShardedAndMerge(t *testing.T) {
+	t.Parallel()
+
+	s, err := NewEmptyShardedRecorder(nil, 2, WithPublicIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := s.Insert([]byte(fmt.Sprint("key", i)), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	public, err := s.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewShardedVerifier(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewShardedProverFromShards(s.shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := p.Get([]byte("key4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyInclusion(*proof, []byte("key4"), []byte{4}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The merged recorder keeps the mode.
+	a, err := NewEmptyRecorder(nil, WithPublicIndex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Insert([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	merged, report, err := Merge(a, s.Shard(0), MergeError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.p.VRFSuite() != pad.PublicIndex {
+		t.Fatalf("unexpected suite: %v", merged.p.VRFSuite())
+	}
+	var publics [][]byte
+	for _, r := range []*Recorder{a, s.Shard(0), merged} {
+		public, err := r.Public()
+		if err != nil {
+			t.Fatal(err)
+		}
+		publics = append(publics, public)
+	}
+	if err := report.Verify(publics[0], publics[1], publics[2]); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,66 +5,351 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto/vrf"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/merkletree"
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/pad"
 )
 
 type Recorder struct {
-	p *pad.PAD
+	p         *pad.PAD
+	name      string
+	labels    map[string]string
+	timestamp time.Time
 }
 
-const version = 0x01
+const (
+	// versionNoHeader is the legacy format, with no header.
+	versionNoHeader = 0x01
+	// versionNoKeys has a header, but its leaves do not store their keys.
+	versionNoKeys = 0x02
+	version       = 0x03
+)
 
 var (
 	ErrInvalidVersion = errors.New("invalid version")
+	// ErrInvalidKey indicates a private key does not
+	// match the selected suite or options.
+	ErrInvalidKey = errors.New("invalid key")
+)
+
+// Hash suites supported by recorders.
+const (
+	HashSHAKE128   = "SHAKE128"
+	HashSHA256     = "SHA-256"
+	HashBLAKE2b256 = "BLAKE2b-256"
 )
 
-func NewEmptyRecorder(rnd io.Reader) (*Recorder, error) {
-	vrfKey, err := vrf.GenerateKey(rnd)
+// VRF suites supported by recorders.
+const (
+	VRFCONIKS           = "CONIKS-ED25519-SHAKE256-ELL"
+	VRFEdwards25519TAI  = "ECVRF-EDWARDS25519-SHA512-TAI"
+	VRFEdwards25519ELL2 = "ECVRF-EDWARDS25519-SHA512-ELL2"
+	VRFP256TAI          = "ECVRF-P256-SHA256-TAI"
+)
+
+type options struct {
+	name      string
+	labels    map[string]string
+	hashSuite string
+	vrfSuite  string
+	hash      crypto.Hash
+	suite     vrf.Suite
+	version   merkletree.HashVersion
+	seed      []byte
+	key       vrf.PrivateKey
+	// publicIndex selects the public-index mode.
+	publicIndex bool
+}
+
+// Option configures a recorder at creation.
+type Option func(*options)
+
+// WithName sets the name of the recorded dataset.
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithLabel adds a free-form label to the state header.
+func WithLabel(key, value string) Option {
+	return func(o *options) {
+		if o.labels == nil {
+			o.labels = make(map[string]string)
+		}
+		o.labels[key] = value
+	}
+}
+
+// WithHashSuite sets the hash function used by commitments and
+// the tree. The default is HashSHAKE128.
+func WithHashSuite(suite string) Option {
+	return func(o *options) {
+		o.hashSuite = suite
+	}
+}
+
+// WithVRFSuite sets the VRF that computes the private indices.
+// The default is VRFCONIKS. It overrides WithPublicIndex.
+func WithVRFSuite(suite string) Option {
+	return func(o *options) {
+		o.vrfSuite = suite
+		o.publicIndex = false
+	}
+}
+
+// WithTreeVersion sets how the interior nodes of the tree are hashed.
+// The default is 2, which binds each node hash to the tree nonce and the
+// node level. Version 1, used by trees that predate tree versions, hashes
+// only the children, and is only meant for verifiers that predate
+// version 2.
+func WithTreeVersion(version int) Option {
+	return func(o *options) {
+		o.version = merkletree.HashVersion(version)
+	}
+}
+
+// WithPublicIndex selects the public-index mode, for datasets whose
+// keys are public. The index of a key is a hash of the key instead of
+// a VRF value, so the recorder has no VRF key, proofs carry no VRF
+// proof, and verifiers recompute the indices. Proofs of exclusion
+// then disclose nothing more than the key, which is public anyway.
+// It overrides WithVRFSuite.
+func WithPublicIndex() Option {
+	return func(o *options) {
+		o.publicIndex = true
+	}
+}
+
+// WithDeterministicSeed derives the VRF key, the tree nonce and the
+// commitment salts from the secret seed, instead of drawing them at
+// random. Recording the same records with the same seed and suites
+// then gives byte-identical state and root, so that independent
+// parties can cross-check a recording. The timestamp is left unset
+// for the same reason. The seed must be kept as secret as the
+// private key, and must not be reused for different datasets.
+func WithDeterministicSeed(seed []byte) Option {
+	return func(o *options) {
+		o.seed = append([]byte{}, seed...)
+	}
+}
+
+// WithPrivateKey sets the VRF key of the recorder, instead of
+// generating a new one. It must be a private key of the selected
+// VRF suite, and cannot be combined with WithDeterministicSeed or
+// WithPublicIndex.
+func WithPrivateKey(private []byte) Option {
+	return func(o *options) {
+		o.key = append(vrf.PrivateKey{}, private...)
+	}
+}
+
+// newOptions applies opts and parses the suites they select.
+func newOptions(opts ...Option) (*options, error) {
+	o := &options{
+		hashSuite: crypto.DefaultHash.String(),
+		vrfSuite:  vrf.DefaultSuite.String(),
+		version:   merkletree.DefaultHashVersion,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if !o.version.Available() {
+		return nil, fmt.Errorf("%w: %d", merkletree.ErrUnknownHashVersion, o.version)
+	}
+	var err error
+	if o.hash, err = crypto.ParseHash(o.hashSuite); err != nil {
+		return nil, err
+	}
+	if o.key != nil && (o.seed != nil || o.publicIndex) {
+		return nil, fmt.Errorf("%w: private key with a seed or a public index", ErrInvalidKey)
+	}
+	if o.publicIndex {
+		o.suite = pad.PublicIndex
+		return o, nil
+	}
+	if o.suite, err = vrf.ParseSuite(o.vrfSuite); err != nil {
+		return nil, err
+	}
+	if o.key != nil {
+		if _, err := o.suite.Public(o.key); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+	}
+	return o, nil
+}
+
+func NewEmptyRecorder(rnd io.Reader, opts ...Option) (*Recorder, error) {
+	o, err := newOptions(opts...)
 	if err != nil {
 		return nil, err
 	}
-	p, err := pad.NewEmpty(vrfKey)
+	vrfKey, err := o.generateKey(rnd)
+	if err != nil {
+		return nil, err
+	}
+	return newEmptyRecorderWithKey(vrfKey, o)
+}
+
+// generateKey creates a VRF key of the selected suite, derived
+// from the seed if one is set, or returns the key set by
+// WithPrivateKey. In public-index mode, there is
+// no VRF key, and the key is only a secret for deterministic salts.
+func (o *options) generateKey(rnd io.Reader) (vrf.PrivateKey, error) {
+	if o.suite == pad.PublicIndex {
+		if o.seed == nil {
+			return nil, nil
+		}
+		return vrf.PrivateKey(crypto.PRF(o.seed, "salt secret")), nil
+	}
+	if o.key != nil {
+		return o.key, nil
+	}
+	if o.seed != nil {
+		rnd = crypto.NewPRFReader(o.seed, "vrf key")
+	}
+	return o.suite.GenerateKey(rnd)
+}
+
+func newEmptyRecorderWithKey(vrfKey vrf.PrivateKey, o *options) (*Recorder, error) {
+	if o.seed != nil {
+		p, err := pad.NewEmptyDeterministic(vrfKey, o.suite, o.hash, o.version)
+		if err != nil {
+			return nil, err
+		}
+		return &Recorder{
+			p:      p,
+			name:   o.name,
+			labels: o.labels,
+		}, nil
+	}
+	p, err := pad.NewEmpty(vrfKey, o.suite, o.hash, o.version)
 	if err != nil {
 		return nil, err
 	}
 	return &Recorder{
-		p: p,
+		p:         p,
+		name:      o.name,
+		labels:    o.labels,
+		timestamp: now(),
 	}, nil
 }
 
 func NewRecorderFromReader(reader io.Reader, private []byte) (*Recorder, error) {
-	if err := validateVersion(reader); err != nil {
+	v, err := readVersion(reader)
+	if err != nil {
 		return nil, err
 	}
-	p, err := pad.NewFromReader(reader, vrf.PrivateKey(private))
+	var h *Header
+	hash, suite, version := crypto.DefaultHash, vrf.DefaultSuite, merkletree.HashV1
+	if v != versionNoHeader {
+		h, err = readHeader(reader)
+		if err != nil {
+			return nil, err
+		}
+		hash, err = crypto.ParseHash(h.HashSuite)
+		if err != nil {
+			return nil, err
+		}
+		// Check the suites before loading the tree with them.
+		public, err := pad.ParsePublic(h.Public)
+		if err != nil {
+			return nil, err
+		}
+		if public.HashSuite != h.HashSuite {
+			return nil, fmt.Errorf("%w: hash suite %q", ErrHeaderMismatch, h.HashSuite)
+		}
+		if public.VRFSuite != h.VRFSuite {
+			return nil, fmt.Errorf("%w: vrf suite %q", ErrHeaderMismatch, h.VRFSuite)
+		}
+		suite, err = public.Suite()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrHeaderMismatch, err)
+		}
+		version = public.Version()
+	}
+	p, err := pad.NewFromReader(reader, vrf.PrivateKey(private), suite, hash, version)
 	if err != nil {
 		return nil, err
 	}
-	return &Recorder{
+	r := &Recorder{
 		p: p,
-	}, nil
+	}
+	if h == nil {
+		return r, nil
+	}
+	if err := r.validateHeader(h); err != nil {
+		return nil, err
+	}
+	if h.Deterministic {
+		p.SetDeterministic()
+	}
+	r.name = h.Name
+	r.labels = h.Labels
+	r.timestamp = h.Timestamp
+	return r, nil
 }
 
-func validateVersion(reader io.Reader) error {
+func readVersion(reader io.Reader) (byte, error) {
 	versionBytes := make([]byte, 1)
 	n, err := reader.Read(versionBytes)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if n != 1 {
-		return fmt.Errorf("wrote %d bytes, expected %d", n, 1)
+		return 0, fmt.Errorf("read %d bytes, expected %d", n, 1)
+	}
+	switch versionBytes[0] {
+	case versionNoHeader, versionNoKeys, version:
+		return versionBytes[0], nil
+	}
+	return 0, fmt.Errorf("%w: version not supported (%v)", ErrInvalidVersion, versionBytes)
+}
+
+// validateHeader verifies that the header describes the
+// loaded tree and key.
+func (r *Recorder) validateHeader(h *Header) error {
+	public, err := r.Public()
+	if err != nil {
+		return err
 	}
-	if !bytes.Equal([]byte{version}, versionBytes) {
-		return fmt.Errorf("%w: version not supported (%v)", ErrInvalidVersion, versionBytes)
+	if !bytes.Equal(public, h.Public) {
+		return fmt.Errorf("%w: public data", ErrHeaderMismatch)
+	}
+	if records := r.p.Len(); records != h.Records {
+		return fmt.Errorf("%w: %d records, header has %d", ErrHeaderMismatch, records, h.Records)
 	}
 	return nil
 }
 
+// vrfSuiteName returns the identifier of s,
+// which is empty in public-index mode.
+func vrfSuiteName(s vrf.Suite) string {
+	if s == pad.PublicIndex {
+		return ""
+	}
+	return s.String()
+}
+
+// now returns the current time, without monotonic clock reading
+// so that it survives serialization unchanged.
+func now() time.Time {
+	return time.Now().UTC().Round(0)
+}
+
 // Insert inserts data.
 func (r *Recorder) Insert(key, value []byte) error {
-	return r.p.Insert(key, value)
+	if err := r.p.Insert(key, value); err != nil {
+		return err
+	}
+	// Deterministic recorders do not depend on the time.
+	if !r.p.Deterministic() {
+		r.timestamp = now()
+	}
+	return nil
 }
 
 // get gets a proof for a key. Only used for testing
@@ -79,8 +364,32 @@ func (r *Recorder) get(key []byte) (*Proof, error) {
 	}, nil
 }
 
+// Header returns the header describing the current state.
+func (r *Recorder) Header() (*Header, error) {
+	public, err := r.Public()
+	if err != nil {
+		return nil, err
+	}
+	h := &Header{
+		Name:      r.name,
+		Records:   r.p.Len(),
+		HashSuite: r.p.HashSuite().String(),
+		VRFSuite:  vrfSuiteName(r.p.VRFSuite()),
+		Timestamp: r.timestamp,
+		Labels:    r.labels,
+		Public:    public,
+
+		Deterministic: r.p.Deterministic(),
+	}
+	return h.clone(), nil
+}
+
 // WriteInternal stores internal state of the recorder.
 func (r *Recorder) WriteInternal(writer io.Writer) error {
+	h, err := r.Header()
+	if err != nil {
+		return err
+	}
 	n, err := writer.Write([]byte{version})
 	if err != nil {
 		return err
@@ -88,6 +397,9 @@ func (r *Recorder) WriteInternal(writer io.Writer) error {
 	if n != 1 {
 		return fmt.Errorf("wrote %d bytes, expected %d", n, 1)
 	}
+	if err := writeHeader(writer, h); err != nil {
+		return err
+	}
 	return r.p.WriteInternal(writer)
 }
 
@@ -100,3 +412,9 @@ func (r *Recorder) Private() []byte {
 func (r *Recorder) Public() ([]byte, error) {
 	return r.p.Public()
 }
+
+// Root returns the hash of the root of the tree, which the
+// public data and the statements about the dataset commit to.
+func (r *Recorder) Root() []byte {
+	return r.p.Hash()
+}
@@ -179,3 +179,57 @@ func Test_NewRecorderFromReader(t *testing.T) {
 		t.Fatalf("unexpected err (-want +got): \n%s", diff)
 	}
 }
+
+func Test_NewRecorderFromReaderEmpty(t *testing.T) {
+	t.Parallel()
+
+	for _, opts := range [][]Option{
+		nil,
+		{WithPublicIndex()},
+		{WithDeterministicSeed([]byte("seed"))},
+	} {
+		r1, err := NewEmptyRecorder(nil, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if err := r1.WriteInternal(&b); err != nil {
+			t.Fatal(err)
+		}
+		r2, err := NewRecorderFromReader(&b, r1.Private())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r2.Insert([]byte("key"), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+		public, err := r2.Public()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewVerifier(public); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_Root(t *testing.T) {
+	t.Parallel()
+
+	r, err := NewEmptyRecorder(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty := r.Root()
+	if err := r.Insert([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	root := r.Root()
+	if len(root) != len(empty) || bytes.Equal(root, empty) {
+		t.Fatalf("unexpected roots %x and %x", empty, root)
+	}
+	root[0] ^= 1
+	if bytes.Equal(root, r.Root()) {
+		t.Fatal("root is not a copy")
+	}
+}
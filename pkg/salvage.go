@@ -0,0 +1,263 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto/vrf"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/merkletree"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/pad"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/utils"
+)
+
+// SalvageReport describes what Salvage recovered from a damaged
+// state file.
+type SalvageReport struct {
+	// Name is the name of the dataset, if the header was intact.
+	Name string `json:"name,omitempty"`
+	// HeaderIntact is true if the header could be read.
+	HeaderIntact bool `json:"headerIntact"`
+	// ExpectedRecords is the number of records in the header.
+	// Only set if the header is intact.
+	ExpectedRecords uint64 `json:"expectedRecords,omitempty"`
+	// RecoveredRecords is the number of records in the new tree.
+	RecoveredRecords uint64 `json:"recoveredRecords"`
+	// LostRecords is the number of records that could not be recovered.
+	// Only set if the header is intact.
+	LostRecords uint64 `json:"lostRecords,omitempty"`
+	// Discarded are the records that were read but not trusted.
+	Discarded []DiscardedRecord `json:"discarded,omitempty"`
+	// Complete is true if the whole node stream was read.
+	Complete bool `json:"complete"`
+	// StopReason is the error that stopped the walk of the node stream.
+	StopReason string `json:"stopReason,omitempty"`
+	// Offset is the number of bytes of the tree that were walked.
+	Offset int64 `json:"offset"`
+	// HashSuite is the hash suite of the rebuilt tree. If the header
+	// is damaged, it is the suite that best matches the damaged tree.
+	HashSuite string `json:"hashSuite"`
+	// TreeVersion is the hash version of the rebuilt tree. If the header
+	// is damaged, it is the version that best matches the damaged tree.
+	TreeVersion int `json:"treeVersion"`
+	// VRFSuite is the VRF suite of the rebuilt recorder. If the header
+	// is damaged, it is the suite that computes most recovered indices.
+	// It is empty in public-index mode.
+	VRFSuite string `json:"vrfSuite"`
+	// NonceRecovered is true if the tree nonce was re-used.
+	NonceRecovered bool `json:"nonceRecovered"`
+	// OldRoot is the root stored in the damaged file.
+	OldRoot []byte `json:"oldRoot,omitempty"`
+	// NewRoot is the root of the rebuilt tree.
+	NewRoot []byte `json:"newRoot"`
+}
+
+// DiscardedRecord is a record read from a damaged state file
+// but not trusted.
+type DiscardedRecord struct {
+	// Index is the hex-encoded index of the record.
+	Index  string `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// Salvage reads a damaged state file and rebuilds a recorder from
+// the records that are intact. The returned report describes what
+// was lost. If nothing was lost, the old and new roots are equal.
+func Salvage(reader io.Reader, private []byte) (*Recorder, *SalvageReport, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := readVersion(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	data = data[1:]
+	report := &SalvageReport{}
+	var h *Header
+	if v != versionNoHeader {
+		h, data, err = salvageHeader(data)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	vrfKey := vrf.PrivateKey(private)
+	suites := crypto.Hashes()
+	// Files without header predate tree versions.
+	versions := []merkletree.HashVersion{merkletree.HashV1}
+	if v != versionNoHeader {
+		versions = []merkletree.HashVersion{merkletree.DefaultHashVersion, merkletree.HashV1}
+	}
+	vrfSuites := append(vrf.Suites(), pad.PublicIndex)
+	var public *pad.Public
+	if h != nil {
+		public, err = pad.ParsePublic(h.Public)
+		if err != nil {
+			return nil, nil, err
+		}
+		vrfSuite, err := public.Suite()
+		if err != nil {
+			return nil, nil, err
+		}
+		vrfSuites = []vrf.Suite{vrfSuite}
+		if vrfSuite != pad.PublicIndex {
+			pubKey, err := vrfSuite.Public(vrfKey)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !bytes.Equal(pubKey, public.VRFKey) {
+				return nil, nil, fmt.Errorf("%w: private key does not match", ErrHeaderMismatch)
+			}
+		}
+		suite, err := crypto.ParseHash(h.HashSuite)
+		if err != nil {
+			return nil, nil, err
+		}
+		suites = []crypto.Hash{suite}
+		versions = []merkletree.HashVersion{public.Version()}
+		report.Name = h.Name
+		report.HeaderIntact = true
+		report.ExpectedRecords = h.Records
+	}
+
+	res, err := salvageTree(data, suites, versions)
+	if err != nil {
+		return nil, nil, err
+	}
+	vrfSuite := salvageVRFSuite(res.Tree, vrfKey, vrfSuites)
+	r := &Recorder{
+		p:         pad.NewFromTree(res.Tree, vrfKey, vrfSuite),
+		timestamp: now(),
+	}
+	if h != nil {
+		r.name = h.Name
+		r.labels = h.Labels
+		if h.Deterministic {
+			r.p.SetDeterministic()
+			r.timestamp = time.Time{}
+		}
+	}
+
+	report.RecoveredRecords = res.Recovered
+	if h != nil && h.Records > res.Recovered {
+		report.LostRecords = h.Records - res.Recovered
+	}
+	for _, d := range res.Discarded {
+		report.Discarded = append(report.Discarded, DiscardedRecord{
+			Index:  hex.EncodeToString(d.Index),
+			Reason: d.Reason,
+		})
+	}
+	report.Complete = res.Err == nil
+	if res.Err != nil {
+		report.StopReason = res.Err.Error()
+	}
+	report.Offset = res.Offset
+	report.NonceRecovered = res.NonceRecovered
+	report.HashSuite = res.Tree.HashSuite().String()
+	report.TreeVersion = int(res.Tree.HashVersion())
+	report.VRFSuite = vrfSuiteName(vrfSuite)
+	report.OldRoot = res.StoredHash
+	if report.OldRoot == nil && public != nil {
+		report.OldRoot = public.TreeHash
+	}
+	report.NewRoot = r.p.Hash()
+	return r, report, nil
+}
+
+// salvageTree salvages the tree with each of the suites and versions,
+// and returns the best result: one that matches the stored root, or else
+// the one with most records, preferring the first version on ties.
+// Leaves that store their key are discarded if their commitment does
+// not verify with the suite.
+func salvageTree(data []byte, suites []crypto.Hash, versions []merkletree.HashVersion) (*merkletree.SalvageResult, error) {
+	var best *merkletree.SalvageResult
+	for _, suite := range suites {
+		for _, version := range versions {
+			res, err := merkletree.Salvage(data, suite, version)
+			if err != nil {
+				return nil, err
+			}
+			if res.StoredHash != nil && bytes.Equal(res.StoredHash, res.Tree.Hash()) {
+				return res, nil
+			}
+			if best == nil || res.Recovered > best.Recovered {
+				best = res
+			}
+		}
+	}
+	return best, nil
+}
+
+// salvageVRFSuite returns the suite that computes the indices of most
+// leaves that store their key, preferring the first suite on ties.
+// The suites may include pad.PublicIndex.
+func salvageVRFSuite(tree *merkletree.MerkleTree, vrfKey vrf.PrivateKey, suites []vrf.Suite) vrf.Suite {
+	if len(suites) == 1 {
+		return suites[0]
+	}
+	best, bestCount := suites[0], -1
+	for _, s := range suites {
+		if s != pad.PublicIndex && len(vrfKey) != s.PrivateKeySize() {
+			continue
+		}
+		count := 0
+		for _, l := range tree.Leaves() {
+			if l.Key == nil {
+				continue
+			}
+			var index []byte
+			if s == pad.PublicIndex {
+				index = pad.HashIndex(tree.HashSuite(), l.Key)
+			} else {
+				index = s.Compute(vrfKey, l.Key)
+			}
+			if bytes.Equal(index, l.Index) {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = s, count
+		}
+	}
+	return best
+}
+
+// salvageHeader reads the header at the start of data and returns
+// the remaining data. A header whose content is damaged is skipped,
+// as long as its length can be trusted.
+func salvageHeader(data []byte) (*Header, []byte, error) {
+	if len(data) < 8 {
+		return nil, nil, fmt.Errorf("%w: header truncated", merkletree.ErrInvalidRead)
+	}
+	size := utils.BytesToULong(data[:8])
+	data = data[8:]
+	if size > maxHeaderSize || size > uint64(len(data)) {
+		return nil, nil, fmt.Errorf("%w: invalid header size %d", merkletree.ErrInvalidRead, size)
+	}
+	var h Header
+	if err := json.Unmarshal(data[:size], &h); err != nil {
+		return nil, data[size:], nil
+	}
+	return &h, data[size:], nil
+}
+
+// Write writes the report in JSON.
+func (r *SalvageReport) Write(writer io.Writer) error {
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	n, err := writer.Write(append(content, '\n'))
+	if err != nil {
+		return err
+	}
+	if n != len(content)+1 {
+		return io.ErrShortWrite
+	}
+	return nil
+}
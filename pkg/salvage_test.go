@@ -0,0 +1,186 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/pad"
+)
+
+func Test_Salvage(t *testing.T) {
+	t.Parallel()
+
+	entries := uint64(20)
+	r := newHeaderTestRecorder(t, entries)
+	var b bytes.Buffer
+	if err := r.WriteInternal(&b); err != nil {
+		t.Fatal(err)
+	}
+	state := b.Bytes()
+	public, err := r.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := pad.ParsePublic(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldRoot := p.TreeHash
+
+	tests := []struct {
+		name     string
+		state    func() []byte
+		complete bool
+		lost     bool
+	}{
+		{
+			name:     "intact",
+			state:    func() []byte { return state },
+			complete: true,
+		},
+		{
+			name:  "truncated",
+			state: func() []byte { return state[:len(state)*3/4] },
+			lost:  true,
+		},
+		{
+			name: "trailing data",
+			state: func() []byte {
+				return append(append([]byte{}, state...), 'X')
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r2, report, err := Salvage(bytes.NewReader(tt.state()), r.Private())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.HeaderIntact || report.Name != "dataset" {
+				t.Fatalf("unexpected header: %+v", report)
+			}
+			if report.Complete != tt.complete {
+				t.Fatalf("unexpected complete: %v (%s)", report.Complete, report.StopReason)
+			}
+			if diff := cmp.Diff(oldRoot, report.OldRoot); diff != "" {
+				t.Fatalf("unexpected err (-want +got): \n%s", diff)
+			}
+			if !tt.lost {
+				if report.LostRecords != 0 || report.RecoveredRecords != entries {
+					t.Fatalf("unexpected loss: %+v", report)
+				}
+				if diff := cmp.Diff(oldRoot, report.NewRoot); diff != "" {
+					t.Fatalf("unexpected err (-want +got): \n%s", diff)
+				}
+			} else {
+				if report.LostRecords == 0 || report.LostRecords+report.RecoveredRecords != entries {
+					t.Fatalf("unexpected loss: %+v", report)
+				}
+				if bytes.Equal(oldRoot, report.NewRoot) {
+					t.Fatal("same roots")
+				}
+			}
+			// Recovered records are provable under the new root.
+			public, err := r2.Public()
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := NewVerifier(public)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := newProverFromRecorder(r2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var recovered uint64
+			for i := uint64(0); i < entries; i++ {
+				key := []byte("key" + fmt.Sprint(i))
+				value := append([]byte("value"), byte(i))
+				proof, err := p.Get(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := v.VerifyInclusion(*proof, key, value); err == nil {
+					recovered++
+					continue
+				}
+				if err := v.VerifyExclusion(*proof, key, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if recovered != report.RecoveredRecords {
+				t.Fatalf("recovered %d records, report has %d", recovered, report.RecoveredRecords)
+			}
+			// The report is valid JSON.
+			var out bytes.Buffer
+			if err := report.Write(&out); err != nil {
+				t.Fatal(err)
+			}
+			var got SalvageReport
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(*report, got); diff != "" {
+				t.Fatalf("unexpected err (-want +got): \n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_SalvageWrongKey(t *testing.T) {
+	t.Parallel()
+
+	r := newHeaderTestRecorder(t, 2)
+	other := newHeaderTestRecorder(t, 0)
+	var b bytes.Buffer
+	if err := r.WriteInternal(&b); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Salvage(&b, other.Private()); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func Test_SalvageDetectsSuites(t *testing.T) {
+	t.Parallel()
+
+	r, err := NewEmptyRecorder(nil, WithHashSuite(HashSHA256), WithVRFSuite(VRFEdwards25519ELL2), WithTreeVersion(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := r.Insert([]byte(fmt.Sprint("key", i)), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Without a header, the suites are found from the tree.
+	var b bytes.Buffer
+	b.Write([]byte{versionNoHeader})
+	if err := r.p.WriteInternal(&b); err != nil {
+		t.Fatal(err)
+	}
+	r2, report, err := Salvage(&b, r.Private())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.HashSuite != HashSHA256 || report.VRFSuite != VRFEdwards25519ELL2 {
+		t.Fatalf("unexpected suites: %+v", report)
+	}
+	want, err := r.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r2.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected err (-want +got): \n%s", diff)
+	}
+}
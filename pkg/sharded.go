@@ -0,0 +1,379 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto/vrf"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/merkletree"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/pad"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/utils"
+)
+
+// maxShards is the maximum number of shards.
+const maxShards = 1 << 16
+
+// shardLabel is the header label that identifies a shard,
+// as "index/count".
+const shardLabel = "shard"
+
+var (
+	// ErrInvalidShards indicates the shards do not form
+	// a sharded recorder.
+	ErrInvalidShards = errors.New("invalid shards")
+	// ErrShardMismatch indicates a proof is for a different shard.
+	ErrShardMismatch = errors.New("shard mismatch")
+)
+
+// ShardedRecorder splits records across independent shards, according
+// to the prefix of their VRF index. All shards share the same VRF key.
+// Each shard is a Recorder that can be written and loaded on its own.
+// The public data binds the roots of all shards together.
+type ShardedRecorder struct {
+	shards []*Recorder
+	bits   uint32
+}
+
+// NewEmptyShardedRecorder creates a recorder with n shards. n must be
+// a power of two. The options apply to every shard.
+func NewEmptyShardedRecorder(rnd io.Reader, n int, opts ...Option) (*ShardedRecorder, error) {
+	bits, err := shardBits(n)
+	if err != nil {
+		return nil, err
+	}
+	var vrfKey vrf.PrivateKey
+	s := &ShardedRecorder{
+		shards: make([]*Recorder, n),
+		bits:   bits,
+	}
+	for i := range s.shards {
+		o, err := newOptions(append(opts, WithLabel(shardLabel, fmt.Sprintf("%d/%d", i, n)))...)
+		if err != nil {
+			return nil, err
+		}
+		if vrfKey == nil {
+			if vrfKey, err = o.generateKey(rnd); err != nil {
+				return nil, err
+			}
+		}
+		s.shards[i], err = newEmptyRecorderWithKey(vrfKey, o)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// NewShardedRecorderFromShards creates a sharded recorder from
+// shards loaded with NewRecorderFromReader, in shard order.
+func NewShardedRecorderFromShards(shards []*Recorder) (*ShardedRecorder, error) {
+	bits, err := shardBits(len(shards))
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range shards {
+		if want := fmt.Sprintf("%d/%d", i, len(shards)); r.labels[shardLabel] != want {
+			return nil, fmt.Errorf("%w: shard %d is labeled %q", ErrInvalidShards, i, r.labels[shardLabel])
+		}
+		if !bytes.Equal(r.Private(), shards[0].Private()) {
+			return nil, fmt.Errorf("%w: shard %d has a different key", ErrInvalidShards, i)
+		}
+		if r.p.HashSuite() != shards[0].p.HashSuite() {
+			return nil, fmt.Errorf("%w: shard %d has a different hash suite", ErrInvalidShards, i)
+		}
+		if r.p.VRFSuite() != shards[0].p.VRFSuite() {
+			return nil, fmt.Errorf("%w: shard %d has a different vrf suite", ErrInvalidShards, i)
+		}
+		if r.p.HashVersion() != shards[0].p.HashVersion() {
+			return nil, fmt.Errorf("%w: shard %d has a different tree version", ErrInvalidShards, i)
+		}
+	}
+	return &ShardedRecorder{
+		shards: shards,
+		bits:   bits,
+	}, nil
+}
+
+func shardBits(n int) (uint32, error) {
+	if n <= 0 || n > maxShards || n&(n-1) != 0 {
+		return 0, fmt.Errorf("%w: %d shards, must be a power of two up to %d", ErrInvalidShards, n, maxShards)
+	}
+	var bits uint32
+	for 1<<bits < n {
+		bits++
+	}
+	return bits, nil
+}
+
+// shardOf returns the shard of a VRF index.
+func shardOf(index []byte, bits uint32) uint32 {
+	var shard uint32
+	for i := uint32(0); i < bits; i++ {
+		shard <<= 1
+		if utils.GetNthBit(index, i) {
+			shard |= 1
+		}
+	}
+	return shard
+}
+
+// Shards returns the number of shards.
+func (s *ShardedRecorder) Shards() int {
+	return len(s.shards)
+}
+
+// Shard returns the i-th shard.
+func (s *ShardedRecorder) Shard(i int) *Recorder {
+	return s.shards[i]
+}
+
+func (s *ShardedRecorder) shardFor(key []byte) uint32 {
+	return shardOf(s.shards[0].p.Index(key), s.bits)
+}
+
+// Insert inserts data in the shard of the key.
+func (s *ShardedRecorder) Insert(key, value []byte) error {
+	return s.shards[s.shardFor(key)].Insert(key, value)
+}
+
+// WriteShard stores internal state of the i-th shard.
+func (s *ShardedRecorder) WriteShard(i int, writer io.Writer) error {
+	return s.shards[i].WriteInternal(writer)
+}
+
+// Private returns private keys, shared by all shards.
+func (s *ShardedRecorder) Private() []byte {
+	return s.shards[0].Private()
+}
+
+func (s *ShardedRecorder) roots() [][]byte {
+	roots := make([][]byte, len(s.shards))
+	for i, r := range s.shards {
+		roots[i] = r.p.Hash()
+	}
+	return roots
+}
+
+func (s *ShardedRecorder) hashSuite() crypto.Hash {
+	return s.shards[0].p.HashSuite()
+}
+
+// shardedPublic is the public data of a sharded recorder.
+type shardedPublic struct {
+	HashSuite   string `json:"hashSuite"`
+	VRFSuite    string `json:"vrfSuite"`
+	IndexMode   string `json:"indexMode,omitempty"`
+	TreeVersion uint8  `json:"treeVersion,omitempty"`
+	RootOfRoots []byte `json:"rootOfRoots"`
+	Shards      uint32 `json:"shards"`
+	VRFKey      []byte `json:"vrfKey"`
+}
+
+// Public returns public data for verification. It contains the
+// root of roots, the number of shards and the VRF public key.
+func (s *ShardedRecorder) Public() ([]byte, error) {
+	p := &shardedPublic{
+		HashSuite:   s.hashSuite().String(),
+		RootOfRoots: merkletree.RootOfRoots(s.hashSuite(), s.roots()),
+		Shards:      uint32(len(s.shards)),
+	}
+	if v := s.shards[0].p.HashVersion(); v != merkletree.HashV1 {
+		p.TreeVersion = uint8(v)
+	}
+	suite := s.shards[0].p.VRFSuite()
+	if suite == pad.PublicIndex {
+		p.IndexMode = pad.IndexModePublic
+		return json.Marshal(p)
+	}
+	pubKey, err := suite.Public(s.Private())
+	if err != nil {
+		return nil, err
+	}
+	p.VRFSuite = suite.String()
+	p.VRFKey = pubKey
+	return json.Marshal(p)
+}
+
+// ShardedProver extends a sharded recorder with proving capabilities.
+type ShardedProver struct {
+	ShardedRecorder
+}
+
+// NewShardedProverFromShards creates a prover from shards loaded
+// with NewRecorderFromReader, in shard order.
+func NewShardedProverFromShards(shards []*Recorder) (*ShardedProver, error) {
+	s, err := NewShardedRecorderFromShards(shards)
+	if err != nil {
+		return nil, err
+	}
+	return &ShardedProver{
+		ShardedRecorder: *s,
+	}, nil
+}
+
+// ShardedProof is a proof for a shard, together with
+// the path of the shard root to the root of roots.
+type ShardedProof struct {
+	shard     uint32
+	shardRoot []byte
+	rootsPath [][crypto.HashSizeByte]byte
+	proof     Proof
+}
+
+// Get gets the proof.
+func (p *ShardedProver) Get(key []byte) (*ShardedProof, error) {
+	shard := p.shardFor(key)
+	proof, err := p.shards[shard].get(key)
+	if err != nil {
+		return nil, err
+	}
+	roots := p.roots()
+	return &ShardedProof{
+		shard:     shard,
+		shardRoot: roots[shard],
+		rootsPath: merkletree.RootsPath(p.hashSuite(), roots, shard),
+		proof:     *proof,
+	}, nil
+}
+
+// MarshalBinary encodes the proof.
+func (p *ShardedProof) MarshalBinary() ([]byte, error) {
+	proof, err := p.proof.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	b := []byte{proofVersion}
+	b = append(b, utils.UInt32ToBytes(p.shard)...)
+	b = append(b, p.shardRoot...)
+	b = append(b, byte(len(p.rootsPath)))
+	for _, h := range p.rootsPath {
+		b = append(b, h[:]...)
+	}
+	return append(b, proof...), nil
+}
+
+// UnmarshalBinary decodes data into the proof.
+func (p *ShardedProof) UnmarshalBinary(data []byte) error {
+	if len(data) < 1+4+crypto.HashSizeByte+1 {
+		return fmt.Errorf("%w: too short", ErrInvalidProof)
+	}
+	if data[0] != proofVersion {
+		return fmt.Errorf("%w: version not supported (%v)", ErrInvalidVersion, data[0])
+	}
+	data = data[1:]
+	shard := utils.BytesToUInt32(data[:4])
+	data = data[4:]
+	shardRoot := append([]byte{}, data[:crypto.HashSizeByte]...)
+	data = data[crypto.HashSizeByte:]
+	n := int(data[0])
+	data = data[1:]
+	if len(data) < n*crypto.HashSizeByte {
+		return fmt.Errorf("%w: too short", ErrInvalidProof)
+	}
+	rootsPath := make([][crypto.HashSizeByte]byte, n)
+	for i := range rootsPath {
+		copy(rootsPath[i][:], data[:crypto.HashSizeByte])
+		data = data[crypto.HashSizeByte:]
+	}
+	var proof Proof
+	if err := proof.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	*p = ShardedProof{
+		shard:     shard,
+		shardRoot: shardRoot,
+		rootsPath: rootsPath,
+		proof:     proof,
+	}
+	return nil
+}
+
+// ShardedVerifier verifies proofs of a sharded recorder
+// using only its public data.
+type ShardedVerifier struct {
+	hash        crypto.Hash
+	version     merkletree.HashVersion
+	vrfSuite    vrf.Suite
+	rootOfRoots []byte
+	shards      uint32
+	bits        uint32
+	vrfPubKey   vrf.PublicKey
+}
+
+func NewShardedVerifier(public []byte) (*ShardedVerifier, error) {
+	var p shardedPublic
+	if err := json.Unmarshal(public, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidShards, err)
+	}
+	h, err := crypto.ParseHash(p.HashSuite)
+	if err != nil {
+		return nil, err
+	}
+	s := pad.PublicIndex
+	if p.IndexMode != pad.IndexModePublic {
+		if s, err = vrf.ParseSuite(p.VRFSuite); err != nil {
+			return nil, err
+		}
+	}
+	bits, err := shardBits(int(p.Shards))
+	if err != nil {
+		return nil, err
+	}
+	version := merkletree.HashV1
+	if p.TreeVersion != 0 {
+		version = merkletree.HashVersion(p.TreeVersion)
+	}
+	if !version.Available() {
+		return nil, fmt.Errorf("%w: %d", merkletree.ErrUnknownHashVersion, version)
+	}
+	return &ShardedVerifier{
+		hash:        h,
+		version:     version,
+		vrfSuite:    s,
+		rootOfRoots: p.RootOfRoots,
+		shards:      p.Shards,
+		bits:        bits,
+		vrfPubKey:   p.VRFKey,
+	}, nil
+}
+
+// shardVerifier verifies that the shard root of the proof is bound
+// by the root of roots, and returns a verifier for the shard.
+func (v *ShardedVerifier) shardVerifier(proof *ShardedProof) (*Verifier, error) {
+	pp := proof.proof.proof.PathProof()
+	if int(v.bits) > 8*len(pp.LookupIndex) || shardOf(pp.LookupIndex, v.bits) != proof.shard {
+		return nil, ErrShardMismatch
+	}
+	if !merkletree.VerifyRootsPath(v.hash, v.rootOfRoots, proof.shardRoot, proof.shard, v.shards, proof.rootsPath) {
+		return nil, merkletree.ErrUnequalTreeHashes
+	}
+	return &Verifier{
+		hash:      v.hash,
+		version:   v.version,
+		vrfSuite:  v.vrfSuite,
+		vrfPubKey: v.vrfPubKey,
+		treeHash:  proof.shardRoot,
+	}, nil
+}
+
+// VerifyInclusion verifies the presence of the key.
+func (v *ShardedVerifier) VerifyInclusion(proof ShardedProof, key, value []byte) error {
+	sv, err := v.shardVerifier(&proof)
+	if err != nil {
+		return err
+	}
+	return sv.VerifyInclusion(proof.proof, key, value)
+}
+
+// VerifyExclusion verifies the absence of the key.
+func (v *ShardedVerifier) VerifyExclusion(proof ShardedProof, key, value []byte) error {
+	sv, err := v.shardVerifier(&proof)
+	if err != nil {
+		return err
+	}
+	return sv.VerifyExclusion(proof.proof, key, value)
+}
@@ -0,0 +1,137 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_ShardedRecorder(t *testing.T) {
+	t.Parallel()
+
+	shards := 4
+	s, err := NewEmptyShardedRecorder(nil, shards, WithName("dataset"))
+	if err != nil {
+		t.Fatalf("cannot create recorder: %v", err)
+	}
+	entries := 40
+	for i := 0; i < entries; i++ {
+		key := "key" + fmt.Sprint(i)
+		value := append([]byte("value"), byte(i))
+		if err := s.Insert([]byte(key), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Records are spread across shards.
+	var total uint64
+	for i := 0; i < shards; i++ {
+		n := s.Shard(i).p.Len()
+		if n == 0 {
+			t.Fatalf("shard %d is empty", i)
+		}
+		total += n
+	}
+	if total != uint64(entries) {
+		t.Fatalf("unexpected number of records: %d", total)
+	}
+
+	// Each shard is written and loaded on its own.
+	loaded := make([]*Recorder, shards)
+	for i := 0; i < shards; i++ {
+		var b bytes.Buffer
+		if err := s.WriteShard(i, &b); err != nil {
+			t.Fatal(err)
+		}
+		loaded[i], err = NewRecorderFromReader(&b, s.Private())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := NewShardedProverFromShards(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := s.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := p.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, public); diff != "" {
+		t.Fatalf("unexpected err (-want +got): \n%s", diff)
+	}
+
+	v, err := NewShardedVerifier(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2*entries; i++ {
+		key := []byte("key" + fmt.Sprint(i))
+		value := append([]byte("value"), byte(i))
+		proof, err := p.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := proof.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded ShardedProof
+		if err := decoded.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+		verify := v.VerifyInclusion
+		if i >= entries {
+			verify = v.VerifyExclusion
+		}
+		if err := verify(decoded, key, value); err != nil {
+			t.Fatalf("key %q: %v", key, err)
+		}
+		// A proof claiming another shard is rejected.
+		decoded.shard = (decoded.shard + 1) % uint32(shards)
+		if err := verify(decoded, key, value); !errors.Is(err, ErrShardMismatch) {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		// A proof with another shard root is rejected.
+		decoded.shard = proof.shard
+		decoded.shardRoot = p.roots()[(proof.shard+1)%uint32(shards)]
+		if err := verify(decoded, key, value); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+}
+
+func Test_ShardedRecorderInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, n := range []int{0, 3, 6, 1 << 17} {
+		if _, err := NewEmptyShardedRecorder(nil, n); !errors.Is(err, ErrInvalidShards) {
+			t.Fatalf("%d shards: unexpected err: %v", n, err)
+		}
+	}
+	s, err := NewEmptyShardedRecorder(nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Shards out of order.
+	if _, err := NewShardedRecorderFromShards([]*Recorder{s.Shard(1), s.Shard(0)}); !errors.Is(err, ErrInvalidShards) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Shards with different keys.
+	other, err := NewEmptyShardedRecorder(nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewShardedRecorderFromShards([]*Recorder{s.Shard(0), other.Shard(1)}); !errors.Is(err, ErrInvalidShards) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// A single shard is a valid sharded recorder.
+	if _, err := NewEmptyShardedRecorder(nil, 1); err != nil {
+		t.Fatal(err)
+	}
+}
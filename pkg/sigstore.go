@@ -0,0 +1,525 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/note"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/tlog"
+)
+
+// Sigstore bundles are verified offline: the certificate chain against
+// the certificate authorities of a trusted root, the envelope signature
+// against the certificate, and the log entries against the logs of the
+// trusted root with their inclusion proofs and signed entry timestamps.
+// Certificate transparency is not checked, and the identity in the
+// certificate is left to the caller.
+
+// Media types of Sigstore documents.
+const (
+	BundleMediaType      = "application/vnd.dev.sigstore.bundle.v0.3+json"
+	TrustedRootMediaType = "application/vnd.dev.sigstore.trustedroot+json;version=0.1"
+)
+
+var (
+	// ErrInvalidBundle indicates a bundle is malformed, or
+	// does not verify against the trusted root.
+	ErrInvalidBundle = errors.New("[sigstore] invalid bundle")
+	// ErrInvalidTlogEntry indicates a log entry of a bundle
+	// does not verify, or does not describe the envelope.
+	ErrInvalidTlogEntry = errors.New("[sigstore] invalid log entry")
+)
+
+// Bundle is a Sigstore bundle of a DSSE envelope.
+type Bundle struct {
+	MediaType            string               `json:"mediaType"`
+	VerificationMaterial VerificationMaterial `json:"verificationMaterial"`
+	DSSEEnvelope         *Envelope            `json:"dsseEnvelope"`
+}
+
+// VerificationMaterial is the material to verify a bundle:
+// the signing certificate and the log entries of the envelope.
+type VerificationMaterial struct {
+	Certificate *X509Certificate `json:"certificate"`
+	TlogEntries []TlogEntry      `json:"tlogEntries"`
+}
+
+// X509Certificate is a DER-encoded certificate.
+type X509Certificate struct {
+	RawBytes []byte `json:"rawBytes"`
+}
+
+// TlogEntry is an entry of a transparency log.
+type TlogEntry struct {
+	LogIndex          int64             `json:"logIndex,string"`
+	LogID             LogID             `json:"logId"`
+	KindVersion       KindVersion       `json:"kindVersion"`
+	IntegratedTime    int64             `json:"integratedTime,string"`
+	InclusionPromise  *InclusionPromise `json:"inclusionPromise,omitempty"`
+	InclusionProof    *InclusionProof   `json:"inclusionProof,omitempty"`
+	CanonicalizedBody []byte            `json:"canonicalizedBody"`
+}
+
+// LogID identifies a log by the SHA-256 digest of its public key.
+type LogID struct {
+	KeyID []byte `json:"keyId"`
+}
+
+// KindVersion is the type of a log entry.
+type KindVersion struct {
+	Kind    string `json:"kind"`
+	Version string `json:"version"`
+}
+
+// InclusionPromise is the signature of a log over an entry,
+// promising to include it.
+type InclusionPromise struct {
+	SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+}
+
+// InclusionProof is the RFC 9162 proof of inclusion of an entry in
+// its log, at a checkpoint signed by the log. The index is the index
+// of the entry in the tree of the checkpoint.
+type InclusionProof struct {
+	LogIndex   int64      `json:"logIndex,string"`
+	RootHash   []byte     `json:"rootHash"`
+	TreeSize   int64      `json:"treeSize,string"`
+	Hashes     [][]byte   `json:"hashes"`
+	Checkpoint Checkpoint `json:"checkpoint"`
+}
+
+// Checkpoint is a checkpoint of a log as a signed note.
+type Checkpoint struct {
+	Envelope string `json:"envelope"`
+}
+
+// NewInclusionProof returns the inclusion proof of a log proof,
+// which must have its checkpoint note.
+func NewInclusionProof(p *LogProof) (*InclusionProof, error) {
+	if p.Note == nil {
+		return nil, fmt.Errorf("%w: no checkpoint note", ErrInvalidLogProof)
+	}
+	return &InclusionProof{
+		LogIndex:   int64(p.Index),
+		RootHash:   p.Checkpoint.RootHash,
+		TreeSize:   int64(p.Checkpoint.Size),
+		Hashes:     p.Hashes,
+		Checkpoint: Checkpoint{Envelope: string(p.Note)},
+	}, nil
+}
+
+// TrustedRoot lists the certificate authorities and
+// logs trusted to verify bundles.
+type TrustedRoot struct {
+	MediaType              string                    `json:"mediaType"`
+	Tlogs                  []TransparencyLogInstance `json:"tlogs"`
+	CertificateAuthorities []CertificateAuthority    `json:"certificateAuthorities"`
+}
+
+// TransparencyLogInstance is a log of a trusted root.
+type TransparencyLogInstance struct {
+	BaseURL       string            `json:"baseUrl,omitempty"`
+	HashAlgorithm string            `json:"hashAlgorithm,omitempty"`
+	PublicKey     PublicKeyMaterial `json:"publicKey"`
+	LogID         LogID             `json:"logId"`
+}
+
+// PublicKeyMaterial is a DER-encoded public key.
+type PublicKeyMaterial struct {
+	RawBytes   []byte     `json:"rawBytes"`
+	KeyDetails string     `json:"keyDetails,omitempty"`
+	ValidFor   *TimeRange `json:"validFor,omitempty"`
+}
+
+// CertificateAuthority is a certificate authority of a trusted root.
+// Its chain ends with the root certificate.
+type CertificateAuthority struct {
+	URI       string     `json:"uri,omitempty"`
+	CertChain CertChain  `json:"certChain"`
+	ValidFor  *TimeRange `json:"validFor,omitempty"`
+}
+
+// CertChain is a chain of certificates.
+type CertChain struct {
+	Certificates []X509Certificate `json:"certificates"`
+}
+
+// TimeRange is a validity period. An unset end is open.
+type TimeRange struct {
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+func (t *TimeRange) contains(at time.Time) bool {
+	if t == nil {
+		return true
+	}
+	return !at.Before(t.Start) && (t.End == nil || !at.After(*t.End))
+}
+
+// dsseLogBody is the canonicalized body of entries of kind
+// dsse, version 0.0.1.
+type dsseLogBody struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		PayloadHash struct {
+			Algorithm string `json:"algorithm"`
+			Value     string `json:"value"`
+		} `json:"payloadHash"`
+		Signatures []dsseLogSignature `json:"signatures"`
+	} `json:"spec"`
+}
+
+// dsseLogSignature is a signature in the body of
+// a dsse entry, with its PEM-encoded certificate.
+type dsseLogSignature struct {
+	Signature []byte `json:"signature"`
+	Verifier  []byte `json:"verifier"`
+}
+
+// setPayload is the payload of signed entry timestamps.
+// Its fields are sorted, as logs sign canonical JSON.
+type setPayload struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+}
+
+// signedEntryTimestampPayload returns what the inclusion
+// promise of the entry signs.
+func (e *TlogEntry) signedEntryTimestampPayload() ([]byte, error) {
+	return json.Marshal(setPayload{
+		Body:           base64.StdEncoding.EncodeToString(e.CanonicalizedBody),
+		IntegratedTime: e.IntegratedTime,
+		LogID:          hex.EncodeToString(e.LogID.KeyID),
+		LogIndex:       e.LogIndex,
+	})
+}
+
+// NewBundle returns the bundle of an envelope signed with the
+// key of cert, with its log entries.
+func NewBundle(e *Envelope, cert *x509.Certificate, entries ...TlogEntry) (*Bundle, error) {
+	if _, err := e.Verify(cert.PublicKey); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+	return &Bundle{
+		MediaType: BundleMediaType,
+		VerificationMaterial: VerificationMaterial{
+			Certificate: &X509Certificate{RawBytes: cert.Raw},
+			TlogEntries: entries,
+		},
+		DSSEEnvelope: e,
+	}, nil
+}
+
+// TlogSubmitter records envelopes in a transparency log, such as Rekor.
+type TlogSubmitter interface {
+	// SubmitDSSE records the envelope signed by the key of cert
+	// in an entry of kind dsse, and returns the entry.
+	SubmitDSSE(envelope *Envelope, cert *x509.Certificate) (*TlogEntry, error)
+}
+
+// Bundle signs the tree head with signer, whose certificate
+// is cert, records it in logs and returns the bundle.
+func (h *TreeHead) Bundle(signer crypto.Signer, cert *x509.Certificate, logs ...TlogSubmitter) (*Bundle, error) {
+	e, err := h.Envelope(signer, "")
+	if err != nil {
+		return nil, err
+	}
+	var entries []TlogEntry
+	for _, log := range logs {
+		entry, err := log.SubmitDSSE(e, cert)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return NewBundle(e, cert, entries...)
+}
+
+// ParseBundle parses a bundle.
+func ParseBundle(b []byte) (*Bundle, error) {
+	var bundle Bundle
+	if err := json.Unmarshal(b, &bundle); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+	if bundle.MediaType != BundleMediaType {
+		return nil, fmt.Errorf("%w: media type %q", ErrInvalidBundle, bundle.MediaType)
+	}
+	if bundle.DSSEEnvelope == nil || bundle.VerificationMaterial.Certificate == nil {
+		return nil, fmt.Errorf("%w: missing envelope or certificate", ErrInvalidBundle)
+	}
+	return &bundle, nil
+}
+
+// ParseTrustedRoot parses a trusted root.
+func ParseTrustedRoot(b []byte) (*TrustedRoot, error) {
+	var root TrustedRoot
+	if err := json.Unmarshal(b, &root); err != nil {
+		return nil, err
+	}
+	if root.MediaType != TrustedRootMediaType {
+		return nil, fmt.Errorf("unsupported trusted root media type %q", root.MediaType)
+	}
+	return &root, nil
+}
+
+// VerifiedBundle is the result of the verification of a bundle.
+type VerifiedBundle struct {
+	*VerifiedEnvelope
+	// Certificate is the signing certificate, whose identity
+	// must be checked by the caller.
+	Certificate *x509.Certificate
+	// IntegratedTime is the earliest time the
+	// envelope was integrated into a log.
+	IntegratedTime time.Time
+}
+
+// Verify verifies the bundle against the trusted root. Every log
+// entry must verify, and at least one must carry an inclusion
+// promise: only the promise signs the integration time of an entry,
+// so entries with only an inclusion proof do not tell when they
+// were integrated. The certificate must have been valid at the
+// earliest integration time signed by a log.
+func (b *Bundle) Verify(root *TrustedRoot) (*VerifiedBundle, error) {
+	if b.MediaType != BundleMediaType || b.DSSEEnvelope == nil || b.VerificationMaterial.Certificate == nil {
+		return nil, ErrInvalidBundle
+	}
+	cert, err := x509.ParseCertificate(b.VerificationMaterial.Certificate.RawBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+	verified, err := b.DSSEEnvelope.Verify(cert.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+	if len(b.VerificationMaterial.TlogEntries) == 0 {
+		return nil, fmt.Errorf("%w: no log entry", ErrInvalidBundle)
+	}
+	var integrated time.Time
+	var unpromised []*TransparencyLogInstance
+	for i := range b.VerificationMaterial.TlogEntries {
+		e := &b.VerificationMaterial.TlogEntries[i]
+		log, err := root.verifyTlogEntry(e, b.DSSEEnvelope, cert)
+		if err != nil {
+			return nil, err
+		}
+		if e.InclusionPromise == nil {
+			unpromised = append(unpromised, log)
+			continue
+		}
+		t := time.Unix(e.IntegratedTime, 0).UTC()
+		if integrated.IsZero() || t.Before(integrated) {
+			integrated = t
+		}
+	}
+	if integrated.IsZero() {
+		return nil, fmt.Errorf("%w: no log entry with an inclusion promise", ErrInvalidBundle)
+	}
+	// The integration time of entries without a promise is not
+	// signed, so their log keys are checked at the signed time.
+	for _, log := range unpromised {
+		if !log.PublicKey.ValidFor.contains(integrated) {
+			return nil, fmt.Errorf("%w: log key not valid at integration time", ErrInvalidTlogEntry)
+		}
+	}
+	if integrated.Before(cert.NotBefore) || integrated.After(cert.NotAfter) {
+		return nil, fmt.Errorf("%w: certificate not valid at %v", ErrInvalidBundle, integrated)
+	}
+	if err := root.verifyCertificate(cert, integrated); err != nil {
+		return nil, err
+	}
+	return &VerifiedBundle{
+		VerifiedEnvelope: verified,
+		Certificate:      cert,
+		IntegratedTime:   integrated,
+	}, nil
+}
+
+// verifyCertificate verifies that one of the certificate
+// authorities issued cert, at time at.
+func (r *TrustedRoot) verifyCertificate(cert *x509.Certificate, at time.Time) error {
+	for _, ca := range r.CertificateAuthorities {
+		certs := ca.CertChain.Certificates
+		if !ca.ValidFor.contains(at) || len(certs) == 0 {
+			continue
+		}
+		roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+		for i, c := range certs {
+			parsed, err := x509.ParseCertificate(c.RawBytes)
+			if err != nil {
+				return fmt.Errorf("invalid trusted root: %w", err)
+			}
+			if i == len(certs)-1 {
+				roots.AddCert(parsed)
+			} else {
+				intermediates.AddCert(parsed)
+			}
+		}
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   at,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		})
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: certificate not issued by a trusted authority", ErrInvalidBundle)
+}
+
+// verifyTlogEntry verifies the inclusion proof or the inclusion
+// promise of the entry by a trusted log, or both if present, and
+// that the entry records the envelope and cert. It returns the log.
+// The validity of the log key is only checked for entries with
+// a promise, which signs their integration time.
+func (r *TrustedRoot) verifyTlogEntry(e *TlogEntry, envelope *Envelope, cert *x509.Certificate) (*TransparencyLogInstance, error) {
+	var log *TransparencyLogInstance
+	for i := range r.Tlogs {
+		if bytes.Equal(r.Tlogs[i].LogID.KeyID, e.LogID.KeyID) {
+			log = &r.Tlogs[i]
+		}
+	}
+	if log == nil {
+		return nil, fmt.Errorf("%w: unknown log %x", ErrInvalidTlogEntry, e.LogID.KeyID)
+	}
+	if e.InclusionPromise == nil && e.InclusionProof == nil {
+		return nil, fmt.Errorf("%w: no inclusion proof or promise", ErrInvalidTlogEntry)
+	}
+	key, err := x509.ParsePKIXPublicKey(log.PublicKey.RawBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted root: %w", err)
+	}
+	if e.InclusionProof != nil {
+		if err := e.InclusionProof.verify(e.CanonicalizedBody, key, log.LogID.KeyID); err != nil {
+			return nil, err
+		}
+	}
+	if e.InclusionPromise != nil {
+		if !log.PublicKey.ValidFor.contains(time.Unix(e.IntegratedTime, 0)) {
+			return nil, fmt.Errorf("%w: log key not valid at integration time", ErrInvalidTlogEntry)
+		}
+		payload, err := e.signedEntryTimestampPayload()
+		if err != nil {
+			return nil, err
+		}
+		ok, err := verifySignature(crypto.PublicKey(key), payload, e.InclusionPromise.SignedEntryTimestamp)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid inclusion promise", ErrInvalidTlogEntry)
+		}
+	}
+	if err := checkDSSELogBody(e, envelope, cert); err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// verify verifies that the proof includes body in the log of key,
+// whose identifier is logID, at the checkpoint.
+func (p *InclusionProof) verify(body []byte, key crypto.PublicKey, logID []byte) error {
+	n, err := note.Parse([]byte(p.Checkpoint.Envelope))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTlogEntry, err)
+	}
+	c, err := parseCheckpoint(n.Text)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTlogEntry, err)
+	}
+	if !verifyCheckpointNote(n, c.Origin, key, logID) {
+		return fmt.Errorf("%w: checkpoint not signed by the log", ErrInvalidTlogEntry)
+	}
+	if p.LogIndex < 0 || p.TreeSize < 0 || c.Size != uint64(p.TreeSize) || !bytes.Equal(c.RootHash, p.RootHash) {
+		return fmt.Errorf("%w: proof does not match the checkpoint", ErrInvalidTlogEntry)
+	}
+	if err := tlog.VerifyInclusion(uint64(p.LogIndex), c.Size, tlog.LeafHash(body), p.Hashes, c.RootHash); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTlogEntry, err)
+	}
+	return nil
+}
+
+// verifyCheckpointNote returns true if the checkpoint note has a
+// valid signature by key. Sigstore logs identify their key by the
+// first bytes of the log identifier, and logs of this package by
+// the key hash of signed notes for origin.
+func verifyCheckpointNote(n *note.Note, origin string, key crypto.PublicKey, logID []byte) bool {
+	if pub, ok := key.(ed25519.PublicKey); ok && n.Verify(origin, pub) {
+		return true
+	}
+	if len(logID) < 4 {
+		return false
+	}
+	for _, sig := range n.Signatures {
+		if sig.Hash != binary.BigEndian.Uint32(logID) {
+			continue
+		}
+		if ok, err := verifySignature(key, []byte(n.Text), sig.Value); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDSSELogBody checks that the body of the entry
+// records the payload and the signatures of the envelope.
+func checkDSSELogBody(e *TlogEntry, envelope *Envelope, cert *x509.Certificate) error {
+	if e.KindVersion.Kind != "dsse" || e.KindVersion.Version != "0.0.1" {
+		return fmt.Errorf("%w: kind %v", ErrInvalidTlogEntry, e.KindVersion)
+	}
+	var body dsseLogBody
+	if err := json.Unmarshal(e.CanonicalizedBody, &body); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTlogEntry, err)
+	}
+	payloadHash := sha256.Sum256(envelope.Payload)
+	if body.Kind != "dsse" || body.Spec.PayloadHash.Algorithm != "sha256" ||
+		body.Spec.PayloadHash.Value != hex.EncodeToString(payloadHash[:]) {
+		return fmt.Errorf("%w: entry does not record the payload", ErrInvalidTlogEntry)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	for _, s := range envelope.Signatures {
+		found := false
+		for _, logged := range body.Spec.Signatures {
+			if bytes.Equal(logged.Signature, s.Sig) && bytes.Equal(logged.Verifier, certPEM) {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: entry does not record the signatures", ErrInvalidTlogEntry)
+		}
+	}
+	return nil
+}
+
+// NewDSSELogBody returns the canonicalized body of the log entry
+// of kind dsse recording the envelope signed by the key of cert.
+func NewDSSELogBody(envelope *Envelope, cert *x509.Certificate) ([]byte, error) {
+	var body dsseLogBody
+	body.APIVersion, body.Kind = "0.0.1", "dsse"
+	payloadHash := sha256.Sum256(envelope.Payload)
+	body.Spec.PayloadHash.Algorithm = "sha256"
+	body.Spec.PayloadHash.Value = hex.EncodeToString(payloadHash[:])
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	for _, s := range envelope.Signatures {
+		body.Spec.Signatures = append(body.Spec.Signatures, dsseLogSignature{
+			Signature: s.Sig,
+			Verifier:  certPEM,
+		})
+	}
+	return json.Marshal(body)
+}
@@ -0,0 +1,475 @@
+package pkg
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/note"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/tlog"
+)
+
+// testCA is a local certificate authority issuing
+// short-lived code-signing certificates.
+type testCA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{key: key, cert: cert}
+}
+
+func (ca *testCA) issue(t *testing.T, pub crypto.PublicKey, notBefore, notAfter time.Time) *x509.Certificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		EmailAddresses: []string{"publisher@example.com"},
+		NotBefore:      notBefore,
+		NotAfter:       notAfter,
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, pub, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// testTlog stands in for a transparency log. It signs inclusion
+// promises, and proves inclusion at checkpoints it signs as notes.
+type testTlog struct {
+	key crypto.Signer
+	id  []byte
+	// noteKey signs checkpoint notes like logs of this package
+	// if set, and like Sigstore logs otherwise.
+	noteKey *SigningKey
+	index   int64
+	hashes  [][]byte
+}
+
+func newTestTlog(t *testing.T) *testTlog {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestTlogWithKey(t, key)
+}
+
+// newTestEd25519Tlog returns a log that signs checkpoint
+// notes like MemoryLog.
+func newTestEd25519Tlog(t *testing.T) *testTlog {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := newTestTlogWithKey(t, key)
+	l.noteKey = &SigningKey{Algorithm: SignatureEd25519, Private: key}
+	return l
+}
+
+func newTestTlogWithKey(t *testing.T, key crypto.Signer) *testTlog {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := sha256.Sum256(der)
+	return &testTlog{key: key, id: id[:]}
+}
+
+func (l *testTlog) sign(m []byte) ([]byte, error) {
+	if _, ok := l.key.Public().(*ecdsa.PublicKey); ok {
+		digest := sha256.Sum256(m)
+		return l.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	return l.key.Sign(rand.Reader, m, crypto.Hash(0))
+}
+
+// checkpointNote returns the checkpoint as a note signed by the log.
+func (l *testTlog) checkpointNote(c *LogCheckpoint) ([]byte, error) {
+	if l.noteKey != nil {
+		return c.Note(l.noteKey)
+	}
+	sig, err := l.sign(c.body())
+	if err != nil {
+		return nil, err
+	}
+	n := note.Note{
+		Text: string(c.body()),
+		Signatures: []note.Signature{{
+			Name:  c.Origin,
+			Hash:  binary.BigEndian.Uint32(l.id),
+			Value: sig,
+		}},
+	}
+	return n.Marshal()
+}
+
+func (l *testTlog) SubmitDSSE(envelope *Envelope, cert *x509.Certificate) (*TlogEntry, error) {
+	body, err := NewDSSELogBody(envelope, cert)
+	if err != nil {
+		return nil, err
+	}
+	e := &TlogEntry{
+		LogIndex:          l.index,
+		LogID:             LogID{KeyID: l.id},
+		KindVersion:       KindVersion{Kind: "dsse", Version: "0.0.1"},
+		IntegratedTime:    time.Now().Unix(),
+		CanonicalizedBody: body,
+	}
+	l.index++
+	payload, err := e.signedEntryTimestampPayload()
+	if err != nil {
+		return nil, err
+	}
+	set, err := l.sign(payload)
+	if err != nil {
+		return nil, err
+	}
+	e.InclusionPromise = &InclusionPromise{SignedEntryTimestamp: set}
+
+	l.hashes = append(l.hashes, tlog.LeafHash(body))
+	index := uint64(len(l.hashes) - 1)
+	hashes, err := tlog.InclusionProof(index, l.hashes)
+	if err != nil {
+		return nil, err
+	}
+	c := LogCheckpoint{
+		Origin:   "log.example.com",
+		Size:     uint64(len(l.hashes)),
+		RootHash: tlog.RootHash(l.hashes),
+	}
+	n, err := l.checkpointNote(&c)
+	if err != nil {
+		return nil, err
+	}
+	proof := LogProof{
+		Index:      index,
+		Hashes:     hashes,
+		Checkpoint: SignedLogCheckpoint{LogCheckpoint: c},
+		Note:       n,
+	}
+	if e.InclusionProof, err = NewInclusionProof(&proof); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func newTestTrustedRoot(t *testing.T, ca *testCA, log *testTlog) *TrustedRoot {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(log.key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	details := "PKIX_ED25519"
+	if _, ok := log.key.Public().(*ecdsa.PublicKey); ok {
+		details = "PKIX_ECDSA_P256_SHA_256"
+	}
+	b, err := json.Marshal(TrustedRoot{
+		MediaType: TrustedRootMediaType,
+		Tlogs: []TransparencyLogInstance{{
+			HashAlgorithm: "SHA2_256",
+			PublicKey: PublicKeyMaterial{
+				RawBytes:   der,
+				KeyDetails: details,
+				ValidFor:   &TimeRange{Start: time.Now().Add(-time.Hour)},
+			},
+			LogID: LogID{KeyID: log.id},
+		}},
+		CertificateAuthorities: []CertificateAuthority{{
+			CertChain: CertChain{Certificates: []X509Certificate{{RawBytes: ca.cert.Raw}}},
+			ValidFor:  &TimeRange{Start: time.Now().Add(-time.Hour)},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := ParseTrustedRoot(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func Test_Bundle(t *testing.T) {
+	t.Parallel()
+
+	ca, log := newTestCA(t), newTestTlog(t)
+	root := newTestTrustedRoot(t, ca, log)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := ca.issue(t, key.Public(), time.Now().Add(-time.Minute), time.Now().Add(10*time.Minute))
+
+	r := newTreeHeadTestRecorder(t, "dataset", 3)
+	head, err := r.TreeHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := head.Bundle(key, cert, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseBundle(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := parsed.Verify(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified.Certificate.EmailAddresses[0] != "publisher@example.com" {
+		t.Fatalf("unexpected certificate: %v", verified.Certificate.EmailAddresses)
+	}
+	v, err := NewVerifierFromEnvelope(verified.VerifiedEnvelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := r.get([]byte("key2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyInclusion(*proof, []byte("key2"), []byte{2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The promise is enough, but the inclusion proof is not:
+	// it does not sign the integration time.
+	promised := *parsed
+	entry := promised.VerificationMaterial.TlogEntries[0]
+	entry.InclusionProof = nil
+	promised.VerificationMaterial.TlogEntries = []TlogEntry{entry}
+	if _, err := promised.Verify(root); err != nil {
+		t.Fatal(err)
+	}
+	proved := *parsed
+	entry = proved.VerificationMaterial.TlogEntries[0]
+	entry.InclusionPromise = nil
+	proved.VerificationMaterial.TlogEntries = []TlogEntry{entry}
+	if _, err := proved.Verify(root); !errors.Is(err, ErrInvalidBundle) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Entries with only a proof are verified alongside entries with
+	// a promise, but do not change the integration time.
+	both, err := head.Bundle(key, cert, log, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpromised := &both.VerificationMaterial.TlogEntries[1]
+	unpromised.InclusionPromise = nil
+	unpromised.IntegratedTime = cert.NotBefore.Add(-time.Hour).Unix()
+	got, err := both.Verify(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(both.VerificationMaterial.TlogEntries[0].IntegratedTime, 0).UTC(); !got.IntegratedTime.Equal(want) {
+		t.Fatalf("unexpected integration time: %v, want %v", got.IntegratedTime, want)
+	}
+	unpromised.InclusionProof.LogIndex++
+	if _, err := both.Verify(root); !errors.Is(err, ErrInvalidTlogEntry) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Checkpoints signed like MemoryLog also verify.
+	edLog := newTestEd25519Tlog(t)
+	for i := 0; i < 3; i++ {
+		bundle, err = head.Bundle(key, cert, edLog)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := bundle.Verify(newTestTrustedRoot(t, ca, edLog)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Log entries are required.
+	unlogged, err := head.Bundle(key, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unlogged.Verify(root); !errors.Is(err, ErrInvalidBundle) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func Test_BundleInvalid(t *testing.T) {
+	t.Parallel()
+
+	ca, log := newTestCA(t), newTestTlog(t)
+	root := newTestTrustedRoot(t, ca, log)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := ca.issue(t, key.Public(), time.Now().Add(-time.Minute), time.Now().Add(10*time.Minute))
+	head, err := newTreeHeadTestRecorder(t, "dataset", 3).TreeHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newBundle := func(cert *x509.Certificate) *Bundle {
+		bundle, err := head.Bundle(key, cert, log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bundle
+	}
+
+	tests := []struct {
+		name   string
+		alter  func(*Bundle)
+		cert   *x509.Certificate
+		root   *TrustedRoot
+		expErr error
+	}{
+		{
+			name: "altered payload",
+			alter: func(b *Bundle) {
+				b.DSSEEnvelope.Payload = append(b.DSSEEnvelope.Payload, ' ')
+			},
+			expErr: ErrInvalidBundle,
+		},
+		{
+			name: "altered inclusion promise",
+			alter: func(b *Bundle) {
+				b.VerificationMaterial.TlogEntries[0].IntegratedTime++
+			},
+			expErr: ErrInvalidTlogEntry,
+		},
+		{
+			name: "no inclusion proof or promise",
+			alter: func(b *Bundle) {
+				b.VerificationMaterial.TlogEntries[0].InclusionPromise = nil
+				b.VerificationMaterial.TlogEntries[0].InclusionProof = nil
+			},
+			expErr: ErrInvalidTlogEntry,
+		},
+		{
+			name: "integration time of an entry without promise",
+			alter: func(b *Bundle) {
+				b.VerificationMaterial.TlogEntries[0].InclusionPromise = nil
+				b.VerificationMaterial.TlogEntries[0].IntegratedTime = time.Now().Unix()
+			},
+			cert:   ca.issue(t, key.Public(), time.Now().Add(-time.Hour), time.Now().Add(-time.Minute)),
+			expErr: ErrInvalidBundle,
+		},
+		{
+			name: "altered inclusion proof",
+			alter: func(b *Bundle) {
+				b.VerificationMaterial.TlogEntries[0].InclusionProof.LogIndex++
+			},
+			expErr: ErrInvalidTlogEntry,
+		},
+		{
+			name: "inclusion proof of another root",
+			alter: func(b *Bundle) {
+				b.VerificationMaterial.TlogEntries[0].InclusionProof.RootHash = make([]byte, 32)
+			},
+			expErr: ErrInvalidTlogEntry,
+		},
+		{
+			name: "unsigned checkpoint",
+			alter: func(b *Bundle) {
+				p := b.VerificationMaterial.TlogEntries[0].InclusionProof
+				other, err := newTestTlog(t).checkpointNote(&LogCheckpoint{
+					Origin:   "log.example.com",
+					Size:     uint64(p.TreeSize),
+					RootHash: p.RootHash,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				p.Checkpoint.Envelope = string(other)
+			},
+			expErr: ErrInvalidTlogEntry,
+		},
+		{
+			name:   "untrusted log",
+			root:   newTestTrustedRoot(t, ca, newTestTlog(t)),
+			expErr: ErrInvalidTlogEntry,
+		},
+		{
+			name:   "untrusted authority",
+			root:   newTestTrustedRoot(t, newTestCA(t), log),
+			expErr: ErrInvalidBundle,
+		},
+		{
+			name:   "certificate expired when logged",
+			cert:   ca.issue(t, key.Public(), time.Now().Add(-time.Hour), time.Now().Add(-time.Minute)),
+			expErr: ErrInvalidBundle,
+		},
+		{
+			name: "other certificate",
+			alter: func(b *Bundle) {
+				other := ca.issue(t, key.Public(), time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+				b.VerificationMaterial.Certificate.RawBytes = other.Raw
+			},
+			expErr: ErrInvalidTlogEntry,
+		},
+	}
+	for _, tt := range tests {
+		c := cert
+		if tt.cert != nil {
+			c = tt.cert
+		}
+		bundle := newBundle(c)
+		if tt.alter != nil {
+			tt.alter(bundle)
+		}
+		r := root
+		if tt.root != nil {
+			r = tt.root
+		}
+		if _, err := bundle.Verify(r); !errors.Is(err, tt.expErr) {
+			t.Errorf("%s: unexpected err: %v", tt.name, err)
+		}
+	}
+
+	if _, err := ParseBundle([]byte(`{"mediaType":"application/vnd.dev.sigstore.bundle+json;version=0.1"}`)); !errors.Is(err, ErrInvalidBundle) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
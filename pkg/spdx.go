@@ -0,0 +1,368 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SPDX 3.0 JSON-LD serialization.
+const (
+	spdxContext     = "https://spdx.org/rdf/3.0.1/spdx-context.jsonld"
+	spdxSpecVersion = "3.0.1"
+	spdxTimeFormat  = "2006-01-02T15:04:05Z"
+	// spdxRootComment marks the integrity method
+	// carrying the root of the tree.
+	spdxRootComment = "dataset-recorder root"
+	// spdxPropertyPrefix prefixes the names of the
+	// properties describing the tree.
+	spdxPropertyPrefix = "dataset-recorder:"
+)
+
+var (
+	// ErrInvalidBOM indicates a BOM is malformed.
+	ErrInvalidBOM = errors.New("[bom] invalid BOM")
+	// ErrBOMMismatch indicates a BOM does not describe
+	// the public data of a verifier.
+	ErrBOMMismatch = errors.New("[verifier] mismatch BOM")
+)
+
+// spdxHashAlgorithms are the names of the SPDX hash algorithms
+// that have the same name in in-toto digests.
+var spdxHashAlgorithms = map[string]bool{
+	"sha1":       true,
+	"sha224":     true,
+	"sha256":     true,
+	"sha384":     true,
+	"sha512":     true,
+	"sha3_256":   true,
+	"sha3_384":   true,
+	"sha3_512":   true,
+	"blake2b256": true,
+	"blake2b384": true,
+	"blake2b512": true,
+	"blake3":     true,
+	"md5":        true,
+}
+
+// BOM is an SPDX 3.0 document describing a recorded dataset
+// with the Dataset profile.
+type BOM struct {
+	// Name is the name of the dataset.
+	Name string
+	// Created is the time of the last modification of the records.
+	Created time.Time
+	// Root is the root of the tree.
+	Root []byte
+	// HashSuite, VRFSuite and TreeVersion are the suites of
+	// the tree, as in the public data.
+	HashSuite   string
+	VRFSuite    string
+	TreeVersion int
+	// Records is the number of records in the tree.
+	Records uint64
+	// Sources are the files the records were read from.
+	Sources []ResourceDescriptor
+}
+
+// spdxElement holds the properties of the SPDX elements
+// used in BOMs.
+type spdxElement struct {
+	Type         string `json:"type"`
+	ID           string `json:"@id,omitempty"`
+	SpdxID       string `json:"spdxId,omitempty"`
+	CreationInfo string `json:"creationInfo,omitempty"`
+	Name         string `json:"name,omitempty"`
+
+	// CreationInfo.
+	SpecVersion string   `json:"specVersion,omitempty"`
+	Created     string   `json:"created,omitempty"`
+	CreatedBy   []string `json:"createdBy,omitempty"`
+
+	// SpdxDocument.
+	ProfileConformance []string `json:"profileConformance,omitempty"`
+	RootElement        []string `json:"rootElement,omitempty"`
+	Element            []string `json:"element,omitempty"`
+
+	// Artifacts.
+	VerifiedUsing  []spdxIntegrityMethod `json:"verifiedUsing,omitempty"`
+	ExternalRef    []spdxExternalRef     `json:"externalRef,omitempty"`
+	Extension      []spdxExtension       `json:"extension,omitempty"`
+	BuiltTime      string                `json:"builtTime,omitempty"`
+	ContentType    string                `json:"contentType,omitempty"`
+	PrimaryPurpose string                `json:"software_primaryPurpose,omitempty"`
+	FileKind       string                `json:"software_fileKind,omitempty"`
+	DatasetType    []string              `json:"dataset_datasetType,omitempty"`
+
+	// Relationship.
+	From             string   `json:"from,omitempty"`
+	RelationshipType string   `json:"relationshipType,omitempty"`
+	To               []string `json:"to,omitempty"`
+}
+
+type spdxIntegrityMethod struct {
+	Type      string `json:"type"`
+	Algorithm string `json:"algorithm"`
+	HashValue string `json:"hashValue"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+type spdxExternalRef struct {
+	Type            string   `json:"type"`
+	ExternalRefType string   `json:"externalRefType"`
+	Locator         []string `json:"locator"`
+}
+
+type spdxExtension struct {
+	Type       string              `json:"type"`
+	Properties []spdxPropertyEntry `json:"extension_cdxProperty"`
+}
+
+type spdxPropertyEntry struct {
+	Type  string `json:"type"`
+	Name  string `json:"extension_cdxPropName"`
+	Value string `json:"extension_cdxPropValue"`
+}
+
+type spdxDocument struct {
+	Context string        `json:"@context"`
+	Graph   []spdxElement `json:"@graph"`
+}
+
+// spdxHashes returns the integrity methods of the digests,
+// in the order of their names.
+func spdxHashes(digest map[string]string) []spdxIntegrityMethod {
+	names := make([]string, 0, len(digest))
+	for name := range digest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var hashes []spdxIntegrityMethod
+	for _, name := range names {
+		h := spdxIntegrityMethod{Type: "Hash", Algorithm: name, HashValue: digest[name]}
+		if !spdxHashAlgorithms[name] {
+			h.Algorithm, h.Comment = "other", name
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes
+}
+
+// BOM returns an SPDX 3.0 JSON-LD document describing the dataset
+// with the Dataset profile. The identifiers of its elements are
+// under namespace, an absolute IRI. The recorder must have a name.
+// sources describe the files the records were read from.
+func (r *Recorder) BOM(namespace string, sources ...ResourceDescriptor) ([]byte, error) {
+	if r.name == "" {
+		return nil, fmt.Errorf("%w: dataset has no name", ErrInvalidBOM)
+	}
+	if u, err := url.Parse(namespace); err != nil || !u.IsAbs() {
+		return nil, fmt.Errorf("%w: namespace %q is not an absolute IRI", ErrInvalidBOM, namespace)
+	}
+	const creationInfo = "_:creationinfo"
+	var (
+		agentID    = namespace + "/agent"
+		documentID = namespace + "/document"
+		datasetID  = namespace + "/dataset"
+	)
+	properties := []spdxPropertyEntry{
+		{Name: "records", Value: strconv.FormatUint(r.p.Len(), 10)},
+		{Name: "hashSuite", Value: r.p.HashSuite().String()},
+		{Name: "vrfSuite", Value: vrfSuiteName(r.p.VRFSuite())},
+		{Name: "treeVersion", Value: strconv.Itoa(int(r.p.HashVersion()))},
+	}
+	for i := range properties {
+		properties[i].Type = "extension_CdxPropertyEntry"
+		properties[i].Name = spdxPropertyPrefix + properties[i].Name
+	}
+	graph := []spdxElement{
+		{
+			Type:        "CreationInfo",
+			ID:          creationInfo,
+			SpecVersion: spdxSpecVersion,
+			Created:     r.timestamp.UTC().Format(spdxTimeFormat),
+			CreatedBy:   []string{agentID},
+		},
+		{
+			Type:         "SoftwareAgent",
+			SpdxID:       agentID,
+			CreationInfo: creationInfo,
+			Name:         modulePath + "@" + moduleVersion(),
+		},
+		{
+			Type:               "SpdxDocument",
+			SpdxID:             documentID,
+			CreationInfo:       creationInfo,
+			Name:               r.name,
+			ProfileConformance: []string{"core", "software", "dataset", "extension"},
+			RootElement:        []string{datasetID},
+		},
+		{
+			Type:         "dataset_DatasetPackage",
+			SpdxID:       datasetID,
+			CreationInfo: creationInfo,
+			Name:         r.name,
+			BuiltTime:    r.timestamp.UTC().Format(spdxTimeFormat),
+			VerifiedUsing: []spdxIntegrityMethod{{
+				Type:      "Hash",
+				Algorithm: "other",
+				HashValue: hex.EncodeToString(r.p.Hash()),
+				Comment:   spdxRootComment,
+			}},
+			Extension: []spdxExtension{{
+				Type:       "extension_CdxPropertiesExtension",
+				Properties: properties,
+			}},
+			PrimaryPurpose: "data",
+			DatasetType:    []string{"noAssertion"},
+		},
+	}
+	var files []string
+	for i, s := range sources {
+		id := fmt.Sprintf("%s/source/%d", namespace, i)
+		f := spdxElement{
+			Type:          "software_File",
+			SpdxID:        id,
+			CreationInfo:  creationInfo,
+			Name:          s.Name,
+			VerifiedUsing: spdxHashes(s.Digest),
+			ContentType:   s.MediaType,
+			FileKind:      "file",
+		}
+		if s.URI != "" {
+			f.ExternalRef = []spdxExternalRef{{
+				Type:            "ExternalRef",
+				ExternalRefType: "altDownloadLocation",
+				Locator:         []string{s.URI},
+			}}
+		}
+		graph = append(graph, f)
+		files = append(files, id)
+	}
+	if len(files) != 0 {
+		graph = append(graph, spdxElement{
+			Type:             "Relationship",
+			SpdxID:           namespace + "/relationship/data-files",
+			CreationInfo:     creationInfo,
+			From:             datasetID,
+			RelationshipType: "hasDataFile",
+			To:               files,
+		})
+	}
+	for _, e := range graph[1:] {
+		if e.SpdxID != documentID {
+			graph[2].Element = append(graph[2].Element, e.SpdxID)
+		}
+	}
+	return json.MarshalIndent(spdxDocument{Context: spdxContext, Graph: graph}, "", "  ")
+}
+
+// ParseBOM parses an SPDX 3.0 JSON-LD document describing
+// a dataset, as returned by Recorder.BOM().
+func ParseBOM(b []byte) (*BOM, error) {
+	var doc spdxDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidBOM, err)
+	}
+	if doc.Context != spdxContext {
+		return nil, fmt.Errorf("%w: context %q", ErrInvalidBOM, doc.Context)
+	}
+	elements := make(map[string]*spdxElement)
+	var dataset *spdxElement
+	for i := range doc.Graph {
+		e := &doc.Graph[i]
+		if e.SpdxID != "" {
+			elements[e.SpdxID] = e
+		}
+		if e.Type == "dataset_DatasetPackage" {
+			if dataset != nil {
+				return nil, fmt.Errorf("%w: several datasets", ErrInvalidBOM)
+			}
+			dataset = e
+		}
+	}
+	if dataset == nil {
+		return nil, fmt.Errorf("%w: no dataset", ErrInvalidBOM)
+	}
+	bom := BOM{Name: dataset.Name}
+	created, err := time.Parse(spdxTimeFormat, dataset.BuiltTime)
+	if err != nil {
+		return nil, fmt.Errorf("%w: built time: %w", ErrInvalidBOM, err)
+	}
+	bom.Created = created
+	for _, h := range dataset.VerifiedUsing {
+		if h.Comment == spdxRootComment {
+			if bom.Root, err = hex.DecodeString(h.HashValue); err != nil {
+				return nil, fmt.Errorf("%w: root: %w", ErrInvalidBOM, err)
+			}
+		}
+	}
+	if bom.Root == nil {
+		return nil, fmt.Errorf("%w: no root", ErrInvalidBOM)
+	}
+	properties := make(map[string]string)
+	for _, ext := range dataset.Extension {
+		for _, p := range ext.Properties {
+			properties[p.Name] = p.Value
+		}
+	}
+	bom.HashSuite = properties[spdxPropertyPrefix+"hashSuite"]
+	bom.VRFSuite = properties[spdxPropertyPrefix+"vrfSuite"]
+	if bom.Records, err = strconv.ParseUint(properties[spdxPropertyPrefix+"records"], 10, 64); err != nil {
+		return nil, fmt.Errorf("%w: records: %w", ErrInvalidBOM, err)
+	}
+	if bom.TreeVersion, err = strconv.Atoi(properties[spdxPropertyPrefix+"treeVersion"]); err != nil {
+		return nil, fmt.Errorf("%w: tree version: %w", ErrInvalidBOM, err)
+	}
+
+	for _, e := range doc.Graph {
+		if e.Type != "Relationship" || e.From != dataset.SpdxID || e.RelationshipType != "hasDataFile" {
+			continue
+		}
+		for _, id := range e.To {
+			f, ok := elements[id]
+			if !ok || f.Type != "software_File" {
+				return nil, fmt.Errorf("%w: data file %q", ErrInvalidBOM, id)
+			}
+			s := ResourceDescriptor{Name: f.Name, MediaType: f.ContentType}
+			for _, ref := range f.ExternalRef {
+				if ref.ExternalRefType == "altDownloadLocation" && len(ref.Locator) != 0 {
+					s.URI = ref.Locator[0]
+				}
+			}
+			for _, h := range f.VerifiedUsing {
+				name := h.Algorithm
+				if name == "other" {
+					name = h.Comment
+				}
+				if s.Digest == nil {
+					s.Digest = make(map[string]string)
+				}
+				s.Digest[name] = h.HashValue
+			}
+			bom.Sources = append(bom.Sources, s)
+		}
+	}
+	return &bom, nil
+}
+
+// VerifyBOM verifies that the BOM describes the public data of
+// the verifier: its root and suites must be those of the tree.
+// The other fields are asserted by the recorder, and cannot be
+// verified.
+func (r *Verifier) VerifyBOM(b *BOM) error {
+	if !bytes.Equal(b.Root, r.treeHash) {
+		return fmt.Errorf("%w: root", ErrBOMMismatch)
+	}
+	if b.HashSuite != r.hash.String() || b.VRFSuite != vrfSuiteName(r.vrfSuite) ||
+		b.TreeVersion != int(r.version) {
+		return fmt.Errorf("%w: suites", ErrBOMMismatch)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_BOM(t *testing.T) {
+	t.Parallel()
+
+	r := newTreeHeadTestRecorder(t, "dataset", 5)
+	sources := []ResourceDescriptor{
+		{
+			Name:      "train.parquet",
+			URI:       "https://example.com/train.parquet",
+			Digest:    map[string]string{"sha256": "abcd", "shake128": "ef01"},
+			MediaType: "application/vnd.apache.parquet",
+		},
+		{
+			Name:   "test.parquet",
+			Digest: map[string]string{"sha512": "2345"},
+		},
+	}
+	b, err := r.BOM("https://example.com/spdx/dataset", sources...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The document is JSON-LD with the expected elements.
+	var doc struct {
+		Context string `json:"@context"`
+		Graph   []struct {
+			Type string `json:"type"`
+		} `json:"@graph"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, e := range doc.Graph {
+		types = append(types, e.Type)
+	}
+	want := []string{"CreationInfo", "SoftwareAgent", "SpdxDocument", "dataset_DatasetPackage", "software_File", "software_File", "Relationship"}
+	if diff := cmp.Diff(want, types); diff != "" {
+		t.Fatalf("unexpected types (-want +got): \n%s", diff)
+	}
+
+	bom, err := ParseBOM(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(sources, bom.Sources); diff != "" {
+		t.Fatalf("unexpected sources (-want +got): \n%s", diff)
+	}
+	if bom.Name != "dataset" || bom.Records != 5 || !bom.Created.Equal(r.timestamp.Truncate(time.Second)) {
+		t.Fatalf("unexpected BOM: %+v", bom)
+	}
+	public, err := r.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifier(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyBOM(bom); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another dataset.
+	other := newTreeHeadTestRecorder(t, "dataset", 5)
+	public, err = other.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err = NewVerifier(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyBOM(bom); !errors.Is(err, ErrBOMMismatch) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func Test_BOMInvalid(t *testing.T) {
+	t.Parallel()
+
+	r := newTreeHeadTestRecorder(t, "", 1)
+	if _, err := r.BOM("https://example.com/spdx"); !errors.Is(err, ErrInvalidBOM) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	r = newTreeHeadTestRecorder(t, "dataset", 1)
+	if _, err := r.BOM("dataset"); !errors.Is(err, ErrInvalidBOM) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	b, err := r.BOM("https://example.com/spdx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"context":    strings.Replace(string(b), spdxContext, "https://example.com/context", 1),
+		"no dataset": strings.Replace(string(b), "dataset_DatasetPackage", "software_Package", 1),
+		"no root":    strings.Replace(string(b), spdxRootComment, "root", 1),
+		"records":    strings.Replace(string(b), spdxPropertyPrefix+"records", "records", 1),
+		"not json":   string(b[1:]),
+	}
+	for name, b := range tests {
+		if _, err := ParseBOM([]byte(b)); !errors.Is(err, ErrInvalidBOM) {
+			t.Fatalf("%s: unexpected err: %v", name, err)
+		}
+	}
+}
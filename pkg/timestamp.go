@@ -0,0 +1,97 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/timestamp"
+)
+
+var (
+	// ErrInvalidTimestamp indicates a time-stamp token of a tree
+	// head is malformed, or does not verify.
+	ErrInvalidTimestamp = errors.New("[treehead] invalid timestamp")
+	// ErrNoTimestamp indicates a tree head has no time-stamp token.
+	ErrNoTimestamp = errors.New("[treehead] no timestamp")
+)
+
+// TimestampAuthority is an RFC 3161 time-stamp authority.
+type TimestampAuthority interface {
+	// Timestamp returns the DER TimeStampResp to the
+	// DER TimeStampReq request.
+	Timestamp(request []byte) ([]byte, error)
+}
+
+// Timestamp requests a time-stamp token over the signature of the
+// tree head from tsa, and appends it to the timestamps of s. The
+// token proves that the tree head was signed before the time it
+// asserts.
+func (s *SignedTreeHead) Timestamp(tsa TimestampAuthority) error {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return err
+	}
+	req, err := timestamp.NewRequest(s.Signature, nonce)
+	if err != nil {
+		return err
+	}
+	resp, err := tsa.Timestamp(req)
+	if err != nil {
+		return err
+	}
+	token, err := timestamp.ParseResponse(resp)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTimestamp, err)
+	}
+	info, err := timestamp.ParseToken(token, s.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTimestamp, err)
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return fmt.Errorf("%w: mismatch nonce", ErrInvalidTimestamp)
+	}
+	s.Timestamps = append(s.Timestamps, token)
+	return nil
+}
+
+// VerifyTimestamps verifies the time-stamp tokens of the tree head
+// with the certificates of roots, and returns their times. It does
+// not verify the signature of the tree head.
+func (s *SignedTreeHead) VerifyTimestamps(roots *x509.CertPool) ([]time.Time, error) {
+	if len(s.Timestamps) == 0 {
+		return nil, ErrNoTimestamp
+	}
+	times := make([]time.Time, len(s.Timestamps))
+	for i, token := range s.Timestamps {
+		info, err := timestamp.Verify(token, s.Signature, roots)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidTimestamp, err)
+		}
+		times[i] = info.Time
+	}
+	return times, nil
+}
+
+// VerifyTimestampedTreeHead verifies the tree head like VerifyTreeHead,
+// and its time-stamp tokens with the certificates of roots. It returns
+// the earliest time asserted by the tokens.
+func (r *Verifier) VerifyTimestampedTreeHead(s *SignedTreeHead, key *VerificationKey, roots *x509.CertPool) (time.Time, error) {
+	if err := r.VerifyTreeHead(s, key); err != nil {
+		return time.Time{}, err
+	}
+	times, err := s.VerifyTimestamps(roots)
+	if err != nil {
+		return time.Time{}, err
+	}
+	earliest := times[0]
+	for _, t := range times[1:] {
+		if t.Before(earliest) {
+			earliest = t
+		}
+	}
+	return earliest, nil
+}
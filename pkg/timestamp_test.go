@@ -0,0 +1,178 @@
+package pkg
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/timestamp"
+)
+
+// testTSA is an in-process time-stamp authority.
+type testTSA struct {
+	*timestamp.Authority
+}
+
+func (a testTSA) Timestamp(request []byte) ([]byte, error) {
+	return a.Respond(request)
+}
+
+func newTestTSA(t *testing.T, ca *testCA) testTSA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testTSA{&timestamp.Authority{
+		Signer:      key,
+		Certificate: cert,
+		Policy:      asn1.ObjectIdentifier{1, 2, 3, 4},
+	}}
+}
+
+func newTestSignedTreeHead(t *testing.T) (*SignedTreeHead, *VerificationKey, *Verifier) {
+	t.Helper()
+	key, err := GenerateSigningKey(nil, SignatureEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vkey, err := key.VerificationKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTreeHeadTestRecorder(t, "dataset", 3)
+	head, err := r.TreeHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := head.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifier(head.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed, vkey, v
+}
+
+func Test_Timestamp(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	tsa := newTestTSA(t, ca)
+	signed, vkey, v := newTestSignedTreeHead(t)
+
+	if _, err := v.VerifyTimestampedTreeHead(signed, vkey, roots); !errors.Is(err, ErrNoTimestamp) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := signed.Timestamp(tsa); err != nil {
+		t.Fatal(err)
+	}
+	// Timestamps survive serialization, and do not
+	// invalidate the signature.
+	b, err := json.Marshal(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got SignedTreeHead
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	tm, err := v.VerifyTimestampedTreeHead(&got, vkey, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(tm); d < 0 || d > time.Minute {
+		t.Fatalf("unexpected time: %v", tm)
+	}
+
+	// Tokens of another authority.
+	other := newTestCA(t)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(other.cert)
+	if _, err := got.VerifyTimestamps(otherRoots); !errors.Is(err, ErrInvalidTimestamp) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Tokens over another signature.
+	otherHead, _, _ := newTestSignedTreeHead(t)
+	otherHead.Timestamps = got.Timestamps
+	if _, err := otherHead.VerifyTimestamps(roots); !errors.Is(err, ErrInvalidTimestamp) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func Test_TimestampEarliest(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	signed, vkey, v := newTestSignedTreeHead(t)
+	early := time.Now().Add(-30 * time.Minute).UTC().Truncate(time.Second)
+	for _, tm := range []time.Time{early.Add(time.Minute), early, early.Add(2 * time.Minute)} {
+		tm := tm
+		tsa := newTestTSA(t, ca)
+		tsa.Now = func() time.Time { return tm }
+		if err := signed.Timestamp(tsa); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tm, err := v.VerifyTimestampedTreeHead(signed, vkey, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tm.Equal(early) {
+		t.Fatalf("unexpected time: %v, want %v", tm, early)
+	}
+}
+
+// nonceTSA replays the responses of another request.
+type nonceTSA struct {
+	testTSA
+}
+
+func (a nonceTSA) Timestamp(request []byte) ([]byte, error) {
+	req, err := timestamp.NewRequest([]byte("other"), big.NewInt(1))
+	if err != nil {
+		return nil, err
+	}
+	return a.Respond(req)
+}
+
+func Test_TimestampInvalidResponse(t *testing.T) {
+	t.Parallel()
+
+	signed, _, _ := newTestSignedTreeHead(t)
+	tsa := nonceTSA{newTestTSA(t, newTestCA(t))}
+	if err := signed.Timestamp(tsa); !errors.Is(err, ErrInvalidTimestamp) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(signed.Timestamps) != 0 {
+		t.Fatalf("unexpected timestamps: %d", len(signed.Timestamps))
+	}
+}
@@ -0,0 +1,299 @@
+package pkg
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto/sign"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/tlog"
+)
+
+var (
+	// ErrInvalidLogProof indicates a log proof or checkpoint
+	// does not verify.
+	ErrInvalidLogProof = errors.New("[tlog] invalid log proof")
+	// ErrNoLogProof indicates a tree head has no proof of
+	// inclusion in a trusted log.
+	ErrNoLogProof = errors.New("[tlog] no log proof")
+)
+
+// logCheckpointContext separates the signatures of checkpoints
+// from other signatures of the same keys.
+const logCheckpointContext = "dataset-recorder log checkpoint v1\n"
+
+// TransparencyLog is an append-only log. Publishers record their
+// tree heads in logs, so that they cannot show different roots
+// to different verifiers.
+type TransparencyLog interface {
+	// Append appends the entry to the log, and returns its index.
+	Append(entry []byte) (uint64, error)
+	// Checkpoint returns the signed current state of the log.
+	Checkpoint() (*SignedLogCheckpoint, error)
+	// InclusionProof returns the proof that the entry at index is
+	// in the log of size entries.
+	InclusionProof(index, size uint64) ([][]byte, error)
+	// ConsistencyProof returns the proof that the log of size1
+	// entries is a prefix of the log of size2 entries.
+	ConsistencyProof(size1, size2 uint64) ([][]byte, error)
+}
+
+// LogCheckpoint is the state of a log.
+type LogCheckpoint struct {
+	// Origin identifies the log.
+	Origin   string `json:"origin"`
+	Size     uint64 `json:"size"`
+	RootHash []byte `json:"rootHash"`
+}
+
+// SignedLogCheckpoint is a checkpoint signed by its log.
+type SignedLogCheckpoint struct {
+	LogCheckpoint
+	Algorithm string `json:"algorithm"`
+	Signature []byte `json:"signature"`
+}
+
+// LogKey identifies a log trusted by verifiers.
+type LogKey struct {
+	Origin string `json:"origin"`
+	VerificationKey
+}
+
+// LogProof proves that a tree head is in a log.
+type LogProof struct {
+	Index      uint64              `json:"index"`
+	Hashes     [][]byte            `json:"hashes"`
+	Checkpoint SignedLogCheckpoint `json:"checkpoint"`
+	// Note is the checkpoint as a signed note, with the
+	// cosignatures of witnesses.
+	Note []byte `json:"note,omitempty"`
+}
+
+// body returns the text of the checkpoint, as in
+// https://c2sp.org/tlog-checkpoint.
+func (c *LogCheckpoint) body() []byte {
+	b := []byte(c.Origin + "\n")
+	b = strconv.AppendUint(b, c.Size, 10)
+	b = append(b, '\n')
+	b = append(b, base64.StdEncoding.EncodeToString(c.RootHash)...)
+	return append(b, '\n')
+}
+
+func (c *LogCheckpoint) signedMessage(algorithm string) []byte {
+	m := []byte(logCheckpointContext)
+	m = append(m, algorithm...)
+	m = append(m, '\n')
+	return append(m, c.body()...)
+}
+
+// Sign signs the checkpoint with key.
+func (c *LogCheckpoint) Sign(key *SigningKey) (*SignedLogCheckpoint, error) {
+	a, err := sign.ParseAlgorithm(key.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := a.Sign(key.Private, c.signedMessage(key.Algorithm))
+	if err != nil {
+		return nil, err
+	}
+	return &SignedLogCheckpoint{
+		LogCheckpoint: *c,
+		Algorithm:     key.Algorithm,
+		Signature:     sig,
+	}, nil
+}
+
+// Verify verifies that the checkpoint is signed by the log of key.
+func (c *SignedLogCheckpoint) Verify(key *LogKey) error {
+	if c.Origin != key.Origin {
+		return fmt.Errorf("%w: origin %q, key is %q", ErrInvalidLogProof, c.Origin, key.Origin)
+	}
+	if c.Algorithm != key.Algorithm {
+		return fmt.Errorf("%w: %q, key is %q", ErrAlgorithmMismatch, c.Algorithm, key.Algorithm)
+	}
+	a, err := sign.ParseAlgorithm(c.Algorithm)
+	if err != nil {
+		return err
+	}
+	if !a.Verify(key.Public, c.signedMessage(c.Algorithm), c.Signature) {
+		return fmt.Errorf("%w: %w", ErrInvalidLogProof, ErrInvalidSignature)
+	}
+	return nil
+}
+
+// VerifyConsistency verifies that the log at c is a prefix of
+// the log at next. Both checkpoints must be verified.
+func (c *LogCheckpoint) VerifyConsistency(next *LogCheckpoint, proof [][]byte) error {
+	if c.Origin != next.Origin {
+		return fmt.Errorf("%w: origin %q, next is %q", ErrInvalidLogProof, c.Origin, next.Origin)
+	}
+	if err := tlog.VerifyConsistency(c.Size, next.Size, proof, c.RootHash, next.RootHash); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidLogProof, err)
+	}
+	return nil
+}
+
+// logEntry returns the entry of the tree head in logs. It
+// leaves out the timestamps and proofs, which are not signed.
+func (s *SignedTreeHead) logEntry() ([]byte, error) {
+	return json.Marshal(SignedTreeHead{
+		TreeHead:  s.TreeHead,
+		Algorithm: s.Algorithm,
+		Signature: s.Signature,
+	})
+}
+
+// Submit appends the tree head to log, and adds the proof of its
+// inclusion in the current state of the log to the proofs of s.
+func (s *SignedTreeHead) Submit(log TransparencyLog) (*LogProof, error) {
+	entry, err := s.logEntry()
+	if err != nil {
+		return nil, err
+	}
+	index, err := log.Append(entry)
+	if err != nil {
+		return nil, err
+	}
+	c, err := log.Checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	hashes, err := log.InclusionProof(index, c.Size)
+	if err != nil {
+		return nil, err
+	}
+	proof := LogProof{
+		Index:      index,
+		Hashes:     hashes,
+		Checkpoint: *c,
+	}
+	if err := tlog.VerifyInclusion(index, c.Size, tlog.LeafHash(entry), hashes, c.RootHash); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidLogProof, err)
+	}
+	s.LogProofs = append(s.LogProofs, proof)
+	return &proof, nil
+}
+
+// VerifyLogProof verifies that the tree head has a proof of
+// inclusion in one of the logs, and returns it. It does not
+// verify the signature of the tree head.
+func (s *SignedTreeHead) VerifyLogProof(logs ...*LogKey) (*LogProof, error) {
+	entry, err := s.logEntry()
+	if err != nil {
+		return nil, err
+	}
+	leaf := tlog.LeafHash(entry)
+	for i := range s.LogProofs {
+		p := &s.LogProofs[i]
+		for _, key := range logs {
+			if p.Checkpoint.Origin != key.Origin {
+				continue
+			}
+			if err := p.Checkpoint.Verify(key); err != nil {
+				return nil, err
+			}
+			if err := tlog.VerifyInclusion(p.Index, p.Checkpoint.Size, leaf, p.Hashes, p.Checkpoint.RootHash); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrInvalidLogProof, err)
+			}
+			return p, nil
+		}
+	}
+	return nil, ErrNoLogProof
+}
+
+// VerifyLoggedTreeHead verifies the tree head like VerifyTreeHead,
+// and that it is included in one of the logs.
+func (r *Verifier) VerifyLoggedTreeHead(s *SignedTreeHead, key *VerificationKey, logs ...*LogKey) error {
+	if err := r.VerifyTreeHead(s, key); err != nil {
+		return err
+	}
+	_, err := s.VerifyLogProof(logs...)
+	return err
+}
+
+// NewVerifierFromLoggedTreeHead creates a verifier for the public
+// data of the tree head, after verifying its signature with key and
+// that it is included in one of the logs.
+func NewVerifierFromLoggedTreeHead(s *SignedTreeHead, key *VerificationKey, logs ...*LogKey) (*Verifier, error) {
+	if err := s.Verify(key); err != nil {
+		return nil, err
+	}
+	if _, err := s.VerifyLogProof(logs...); err != nil {
+		return nil, err
+	}
+	return NewVerifier(s.Public)
+}
+
+// MemoryLog is a transparency log kept in memory, for tests
+// and local deployments.
+type MemoryLog struct {
+	origin string
+	key    *SigningKey
+
+	mu      sync.Mutex
+	entries [][]byte
+	hashes  [][]byte
+}
+
+// NewMemoryLog creates an empty log identified by origin,
+// signing its checkpoints with key.
+func NewMemoryLog(origin string, key *SigningKey) (*MemoryLog, error) {
+	if _, err := sign.ParseAlgorithm(key.Algorithm); err != nil {
+		return nil, err
+	}
+	return &MemoryLog{origin: origin, key: key}, nil
+}
+
+// Append implements TransparencyLog.
+func (l *MemoryLog) Append(entry []byte) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, append([]byte{}, entry...))
+	l.hashes = append(l.hashes, tlog.LeafHash(entry))
+	return uint64(len(l.entries) - 1), nil
+}
+
+// Entry returns the entry at index.
+func (l *MemoryLog) Entry(index uint64) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if index >= uint64(len(l.entries)) {
+		return nil, tlog.ErrInvalidRange
+	}
+	return l.entries[index], nil
+}
+
+// Checkpoint implements TransparencyLog.
+func (l *MemoryLog) Checkpoint() (*SignedLogCheckpoint, error) {
+	l.mu.Lock()
+	c := LogCheckpoint{
+		Origin:   l.origin,
+		Size:     uint64(len(l.hashes)),
+		RootHash: tlog.RootHash(l.hashes),
+	}
+	l.mu.Unlock()
+	return c.Sign(l.key)
+}
+
+// InclusionProof implements TransparencyLog.
+func (l *MemoryLog) InclusionProof(index, size uint64) ([][]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if size > uint64(len(l.hashes)) {
+		return nil, tlog.ErrInvalidRange
+	}
+	return tlog.InclusionProof(index, l.hashes[:size])
+}
+
+// ConsistencyProof implements TransparencyLog.
+func (l *MemoryLog) ConsistencyProof(size1, size2 uint64) ([][]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if size2 > uint64(len(l.hashes)) {
+		return nil, tlog.ErrInvalidRange
+	}
+	return tlog.ConsistencyProof(size1, l.hashes[:size2])
+}
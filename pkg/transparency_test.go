@@ -0,0 +1,149 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func newTestLog(t *testing.T, origin string) (*MemoryLog, *LogKey) {
+	t.Helper()
+	key, err := GenerateSigningKey(nil, SignatureEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vkey, err := key.VerificationKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := NewMemoryLog(origin, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log, &LogKey{Origin: origin, VerificationKey: *vkey}
+}
+
+func Test_TransparencyLog(t *testing.T) {
+	t.Parallel()
+
+	log, logKey := newTestLog(t, "example.com/log")
+	// Other entries surround the tree head.
+	for _, e := range []string{"a", "b", "c"} {
+		if _, err := log.Append([]byte(e)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signed, vkey, v := newTestSignedTreeHead(t)
+	if err := v.VerifyLoggedTreeHead(signed, vkey, logKey); !errors.Is(err, ErrNoLogProof) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	proof, err := signed.Submit(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proof.Index != 3 || proof.Checkpoint.Size != 4 {
+		t.Fatalf("unexpected proof: index %d, size %d", proof.Index, proof.Checkpoint.Size)
+	}
+	for _, e := range []string{"d", "e"} {
+		if _, err := log.Append([]byte(e)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := json.Marshal(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got SignedTreeHead
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyLoggedTreeHead(&got, vkey, logKey); err != nil {
+		t.Fatal(err)
+	}
+	nv, err := NewVerifierFromLoggedTreeHead(&got, vkey, logKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nv.equal(v) {
+		t.Fatalf("unexpected verifier")
+	}
+
+	// Another log.
+	_, otherKey := newTestLog(t, "example.com/other")
+	if _, err := got.VerifyLogProof(otherKey); !errors.Is(err, ErrNoLogProof) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Another key for the log.
+	_, otherKey = newTestLog(t, "example.com/log")
+	if _, err := got.VerifyLogProof(otherKey); !errors.Is(err, ErrInvalidLogProof) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Another tree head with the proof.
+	other, _, _ := newTestSignedTreeHead(t)
+	other.LogProofs = got.LogProofs
+	if _, err := other.VerifyLogProof(logKey); !errors.Is(err, ErrInvalidLogProof) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Another index.
+	got.LogProofs[0].Index = 2
+	if _, err := got.VerifyLogProof(logKey); !errors.Is(err, ErrInvalidLogProof) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func Test_LogCheckpointConsistency(t *testing.T) {
+	t.Parallel()
+
+	log, logKey := newTestLog(t, "example.com/log")
+	var checkpoints []*SignedLogCheckpoint
+	for _, e := range []string{"a", "b", "c", "d", "e"} {
+		if _, err := log.Append([]byte(e)); err != nil {
+			t.Fatal(err)
+		}
+		c, err := log.Checkpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Verify(logKey); err != nil {
+			t.Fatal(err)
+		}
+		checkpoints = append(checkpoints, c)
+	}
+	for _, c1 := range checkpoints {
+		for _, c2 := range checkpoints[c1.Size-1:] {
+			proof, err := log.ConsistencyProof(c1.Size, c2.Size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c1.VerifyConsistency(&c2.LogCheckpoint, proof); err != nil {
+				t.Fatalf("sizes %d, %d: %v", c1.Size, c2.Size, err)
+			}
+		}
+	}
+
+	// A log showing another history.
+	fork, _ := newTestLog(t, "example.com/log")
+	for _, e := range []string{"a", "b", "x", "d", "e"} {
+		if _, err := fork.Append([]byte(e)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := fork.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := fork.ConsistencyProof(3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkpoints[2].VerifyConsistency(&c.LogCheckpoint, proof); !errors.Is(err, ErrInvalidLogProof) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Checkpoints are bound to their origin.
+	otherKey := *logKey
+	otherKey.Origin = "example.com/other"
+	if err := checkpoints[4].Verify(&otherKey); !errors.Is(err, ErrInvalidLogProof) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
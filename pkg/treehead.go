@@ -0,0 +1,209 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto/sign"
+)
+
+// Signature algorithms of signed tree heads.
+const (
+	SignatureEd25519 = "Ed25519"
+	// SignatureSLHDSASHAKE128s is a hash-based signature, for tree
+	// heads that must stay verifiable after the discrete logarithm
+	// problem stops being hard. It relies only on SHAKE256.
+	SignatureSLHDSASHAKE128s = "SLH-DSA-SHAKE-128s"
+	// SignatureSLHDSASHAKE128f signs faster than
+	// SignatureSLHDSASHAKE128s, with signatures twice as large.
+	SignatureSLHDSASHAKE128f = "SLH-DSA-SHAKE-128f"
+)
+
+var (
+	// ErrInvalidSignature indicates the signature of a tree head
+	// does not verify.
+	ErrInvalidSignature = errors.New("[treehead] invalid signature")
+	// ErrAlgorithmMismatch indicates a tree head is signed with
+	// another algorithm than the key verifying it.
+	ErrAlgorithmMismatch = errors.New("[treehead] mismatch signature algorithm")
+	// ErrTreeHeadMismatch indicates a tree head does not describe
+	// the public data of a verifier.
+	ErrTreeHeadMismatch = errors.New("[verifier] mismatch tree head")
+)
+
+// treeHeadContext separates the signatures of tree heads
+// from other signatures of the same keys.
+const treeHeadContext = "dataset-recorder tree head v1\n"
+
+// TreeHead describes the records of a recorder at a point in time.
+type TreeHead struct {
+	// Name is the name of the recorded dataset.
+	Name string `json:"name,omitempty"`
+	// Records is the number of records in the tree.
+	Records uint64 `json:"records"`
+	// Timestamp is the last time the records were modified,
+	// as asserted by the recorder.
+	Timestamp time.Time `json:"timestamp"`
+	// Public is the public data for verification, as returned
+	// by Recorder.Public(). It contains the root of the tree.
+	Public []byte `json:"public"`
+}
+
+// SignedTreeHead is a tree head signed by the publisher
+// of the records.
+type SignedTreeHead struct {
+	TreeHead
+	// Algorithm identifies the signature algorithm, and
+	// selects how verifiers check the signature.
+	Algorithm string `json:"algorithm"`
+	Signature []byte `json:"signature"`
+	// Timestamps are RFC 3161 time-stamp tokens over the
+	// signature. They are not signed.
+	Timestamps [][]byte `json:"timestamps,omitempty"`
+	// LogProofs prove the inclusion of the tree head
+	// in transparency logs. They are not signed.
+	LogProofs []LogProof `json:"logProofs,omitempty"`
+}
+
+// SigningKey signs tree heads.
+type SigningKey struct {
+	Algorithm string `json:"algorithm"`
+	Private   []byte `json:"private"`
+}
+
+// VerificationKey verifies signed tree heads.
+type VerificationKey struct {
+	Algorithm string `json:"algorithm"`
+	Public    []byte `json:"public"`
+}
+
+// GenerateSigningKey creates a key of the algorithm using rnd
+// for randomness. If rnd is nil, crypto/rand is used.
+func GenerateSigningKey(rnd io.Reader, algorithm string) (*SigningKey, error) {
+	a, err := sign.ParseAlgorithm(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	sk, err := a.GenerateKey(rnd)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{
+		Algorithm: algorithm,
+		Private:   sk,
+	}, nil
+}
+
+// VerificationKey returns the key that verifies the
+// signatures of k.
+func (k *SigningKey) VerificationKey() (*VerificationKey, error) {
+	a, err := sign.ParseAlgorithm(k.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := a.Public(k.Private)
+	if err != nil {
+		return nil, err
+	}
+	return &VerificationKey{
+		Algorithm: k.Algorithm,
+		Public:    pk,
+	}, nil
+}
+
+// TreeHead returns the tree head describing the current state.
+func (r *Recorder) TreeHead() (*TreeHead, error) {
+	public, err := r.Public()
+	if err != nil {
+		return nil, err
+	}
+	return &TreeHead{
+		Name:      r.name,
+		Records:   r.p.Len(),
+		Timestamp: r.timestamp,
+		Public:    public,
+	}, nil
+}
+
+// signedMessage returns the message signed by algorithm. It binds
+// the algorithm, so that a signature cannot be checked as one
+// of another algorithm.
+func (h *TreeHead) signedMessage(algorithm string) ([]byte, error) {
+	b, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	m := []byte(treeHeadContext)
+	m = append(m, algorithm...)
+	m = append(m, '\n')
+	return append(m, b...), nil
+}
+
+// Sign signs the tree head with key.
+func (h *TreeHead) Sign(key *SigningKey) (*SignedTreeHead, error) {
+	a, err := sign.ParseAlgorithm(key.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	m, err := h.signedMessage(key.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := a.Sign(key.Private, m)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedTreeHead{
+		TreeHead:  *h,
+		Algorithm: key.Algorithm,
+		Signature: sig,
+	}, nil
+}
+
+// Verify verifies the signature of the tree head with key. The
+// algorithm of the tree head must be the algorithm of the key.
+func (s *SignedTreeHead) Verify(key *VerificationKey) error {
+	if s.Algorithm != key.Algorithm {
+		return fmt.Errorf("%w: %q, key is %q", ErrAlgorithmMismatch, s.Algorithm, key.Algorithm)
+	}
+	a, err := sign.ParseAlgorithm(s.Algorithm)
+	if err != nil {
+		return err
+	}
+	m, err := s.TreeHead.signedMessage(s.Algorithm)
+	if err != nil {
+		return err
+	}
+	if !a.Verify(key.Public, m, s.Signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// VerifyTreeHead verifies the signature of the tree head with key,
+// and that it describes the public data of the verifier.
+func (r *Verifier) VerifyTreeHead(s *SignedTreeHead, key *VerificationKey) error {
+	if err := s.Verify(key); err != nil {
+		return err
+	}
+	v, err := NewVerifier(s.Public)
+	if err != nil {
+		return err
+	}
+	if !r.equal(v) {
+		return ErrTreeHeadMismatch
+	}
+	return nil
+}
+
+// equal returns true if r and v verify the same tree.
+func (r *Verifier) equal(v *Verifier) bool {
+	return r.hash == v.hash && r.version == v.version &&
+		r.vrfSuite == v.vrfSuite &&
+		bytes.Equal(r.vrfPubKey, v.vrfPubKey) &&
+		bytes.Equal(r.treeHash, v.treeHash)
+}
@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func newTreeHeadTestRecorder(t *testing.T, name string, entries int) *Recorder {
+	t.Helper()
+	r, err := NewEmptyRecorder(nil, WithName(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < entries; i++ {
+		if err := r.Insert([]byte(fmt.Sprint("key", i)), []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func Test_SignedTreeHead(t *testing.T) {
+	t.Parallel()
+
+	r := newTreeHeadTestRecorder(t, "dataset", 5)
+	public, err := r.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifier(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := r.TreeHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Name != "dataset" || head.Records != 5 {
+		t.Fatalf("unexpected tree head: %+v", head)
+	}
+
+	for _, algorithm := range []string{SignatureEd25519, SignatureSLHDSASHAKE128s, SignatureSLHDSASHAKE128f} {
+		algorithm := algorithm
+		t.Run(algorithm, func(t *testing.T) {
+			t.Parallel()
+			key, err := GenerateSigningKey(nil, algorithm)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vkey, err := key.VerificationKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			signed, err := head.Sign(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Signed heads survive serialization.
+			b, err := json.Marshal(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got SignedTreeHead
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(*signed, got); diff != "" {
+				t.Fatalf("unexpected tree head (-want +got): \n%s", diff)
+			}
+			if err := v.VerifyTreeHead(&got, vkey); err != nil {
+				t.Fatal(err)
+			}
+
+			altered := got
+			altered.Records++
+			if err := altered.Verify(vkey); !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			// The algorithm is bound to the key.
+			other := *vkey
+			other.Algorithm = SignatureEd25519
+			if algorithm == SignatureEd25519 {
+				other.Algorithm = SignatureSLHDSASHAKE128f
+			}
+			if err := got.Verify(&other); !errors.Is(err, ErrAlgorithmMismatch) {
+				t.Fatalf("unexpected err: %v", err)
+			}
+		})
+	}
+}
+
+func Test_VerifyTreeHeadMismatch(t *testing.T) {
+	t.Parallel()
+
+	key, err := GenerateSigningKey(nil, SignatureEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vkey, err := key.VerificationKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newTreeHeadTestRecorder(t, "dataset", 3)
+	public, err := r.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifier(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The head of a later state does not describe the verifier's.
+	if err := r.Insert([]byte("key3"), []byte{3}); err != nil {
+		t.Fatal(err)
+	}
+	head, err := r.TreeHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := head.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyTreeHead(signed, vkey); !errors.Is(err, ErrTreeHeadMismatch) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if _, err := GenerateSigningKey(nil, "RSA"); err == nil {
+		t.Fatal("unexpected algorithm")
+	}
+}
@@ -1,8 +1,10 @@
 package pkg
 
 import (
+	"bytes"
 	"errors"
 
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto"
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/crypto/vrf"
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/merkletree"
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/pad"
@@ -11,18 +13,38 @@ import (
 var (
 	// ErrProofType indicates proof is of the wrong type.
 	ErrProofType = errors.New("[verifier] mismatch proof type")
+	// ErrInvalidIndex indicates the lookup index of a proof
+	// is not the VRF value of the key.
+	ErrInvalidIndex = errors.New("[verifier] invalid lookup index")
 )
 
 type Verifier struct {
+	hash      crypto.Hash
+	version   merkletree.HashVersion
+	vrfSuite  vrf.Suite
 	vrfPubKey vrf.PublicKey
 	treeHash  []byte
 }
 
 func NewVerifier(public []byte) (*Verifier, error) {
-	p := pad.Public(public)
+	p, err := pad.ParsePublic(public)
+	if err != nil {
+		return nil, err
+	}
+	h, err := p.Hash()
+	if err != nil {
+		return nil, err
+	}
+	s, err := p.Suite()
+	if err != nil {
+		return nil, err
+	}
 	return &Verifier{
-		vrfPubKey: p.VerificationKey(),
-		treeHash:  p.TreeHash(),
+		hash:      h,
+		version:   p.Version(),
+		vrfSuite:  s,
+		vrfPubKey: p.VRFKey,
+		treeHash:  p.TreeHash,
 	}, nil
 }
 
@@ -32,7 +54,10 @@ func (r *Verifier) VerifyInclusion(proof Proof, key, value []byte) error {
 	if (&pp).ProofType() != merkletree.ProofOfInclusion {
 		return ErrProofType
 	}
-	return pp.Verify(key, value, r.treeHash)
+	if err := r.verifyIndex(proof, key); err != nil {
+		return err
+	}
+	return pp.Verify(r.hash, r.version, key, value, r.treeHash)
 }
 
 // VerifyExclusion verifies the absence of the key.
@@ -42,5 +67,52 @@ func (r *Verifier) VerifyExclusion(proof Proof, key, value []byte) error {
 	if (&pp).ProofType() != merkletree.ProofOfExclusion {
 		return ErrProofType
 	}
-	return pp.Verify(key, value, r.treeHash)
+	if err := r.verifyIndex(proof, key); err != nil {
+		return err
+	}
+	return pp.Verify(r.hash, r.version, key, value, r.treeHash)
+}
+
+// VerifyMembership verifies that the key is recorded, with a proof
+// returned by Prover.GetMembership. The value is not checked. Proofs
+// of inclusion returned by Prover.Get are accepted too.
+func (r *Verifier) VerifyMembership(proof Proof, key []byte) error {
+	pp := proof.proof.PathProof()
+	if (&pp).ProofType() != merkletree.ProofOfInclusion {
+		return ErrProofType
+	}
+	if err := r.verifyIndex(proof, key); err != nil {
+		return err
+	}
+	return pp.VerifyMembership(r.hash, r.version, r.treeHash)
+}
+
+// VerifyOpening verifies the membership proof of the key like
+// VerifyMembership, and that opening discloses the recorded value.
+func (r *Verifier) VerifyOpening(proof Proof, key []byte, opening Opening) error {
+	pp := proof.proof.PathProof()
+	if (&pp).ProofType() != merkletree.ProofOfInclusion {
+		return ErrProofType
+	}
+	if err := r.verifyIndex(proof, key); err != nil {
+		return err
+	}
+	return pp.VerifyOpening(r.hash, r.version, key, opening.Value, opening.Salt, r.treeHash)
+}
+
+// verifyIndex verifies that the lookup index of the
+// proof is the VRF value of the key, or its hash in
+// public-index mode.
+func (r *Verifier) verifyIndex(proof Proof, key []byte) error {
+	pp := proof.proof.PathProof()
+	if r.vrfSuite == pad.PublicIndex {
+		if len(proof.proof.VRFProof()) != 0 || !bytes.Equal(pp.LookupIndex, pad.HashIndex(r.hash, key)) {
+			return ErrInvalidIndex
+		}
+		return nil
+	}
+	if !r.vrfSuite.Verify(r.vrfPubKey, key, pp.LookupIndex, proof.proof.VRFProof()) {
+		return ErrInvalidIndex
+	}
+	return nil
 }
@@ -2,11 +2,13 @@ package pkg
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/laurentsimon/dataset-recorder/pkg/internal/merkletree"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/pad"
 )
 
 func Test_VerifyInExclusion(t *testing.T) {
@@ -198,3 +200,102 @@ func copyBuffer(b bytes.Buffer) bytes.Buffer {
 	cpy.Write(b.Bytes())
 	return cpy
 }
+
+func Test_VerifyMembership(t *testing.T) {
+	t.Parallel()
+
+	r, err := NewEmptyRecorder(nil)
+	if err != nil {
+		t.Fatalf("cannot create recorder: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := r.Insert([]byte(fmt.Sprint("key", i)), []byte(fmt.Sprint("secret value ", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := newProverFromRecorder(r)
+	if err != nil {
+		t.Fatalf("cannot create prover: %v", err)
+	}
+	public, err := p.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewVerifier(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, value := []byte("key3"), []byte("secret value 3")
+	proof, err := p.GetMembership(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := proof.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, value) {
+		t.Fatal("membership proof discloses the value")
+	}
+	var decoded Proof
+	if err := decoded.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyMembership(decoded, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyMembership(decoded, []byte("key4")); !errors.Is(err, ErrInvalidIndex) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := v.VerifyInclusion(decoded, key, value); err == nil {
+		t.Fatal("expected error")
+	}
+	// Full proofs of inclusion prove membership too.
+	full, err := p.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyMembership(*full, key); err != nil {
+		t.Fatal(err)
+	}
+
+	// The opening discloses the value.
+	opening, err := p.Open(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(value, opening.Value); diff != "" {
+		t.Fatalf("unexpected value (-want +got): \n%s", diff)
+	}
+	if err := v.VerifyOpening(decoded, key, *opening); err != nil {
+		t.Fatal(err)
+	}
+	forged := *opening
+	forged.Value = []byte("secret value 4")
+	if err := v.VerifyOpening(decoded, key, forged); !errors.Is(err, merkletree.ErrUnverifiableCommitment) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	other, err := p.Open([]byte("key4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyOpening(decoded, key, *other); !errors.Is(err, merkletree.ErrUnverifiableCommitment) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// Absent keys have no membership proof nor opening.
+	if _, err := p.GetMembership([]byte("key10")); !errors.Is(err, ErrProofType) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := p.Open([]byte("key10")); !errors.Is(err, pad.ErrKeyNotFound) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	absent, err := p.Get([]byte("key10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.VerifyMembership(*absent, []byte("key10")); !errors.Is(err, ErrProofType) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
@@ -0,0 +1,482 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/note"
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/tlog"
+)
+
+var (
+	// ErrInvalidNote indicates a checkpoint note is malformed,
+	// or not signed by its log.
+	ErrInvalidNote = errors.New("[witness] invalid note")
+	// ErrInconsistentCheckpoint indicates a checkpoint is not
+	// consistent with the checkpoints cosigned by a witness.
+	ErrInconsistentCheckpoint = errors.New("[witness] inconsistent checkpoint")
+	// ErrWitnessPolicy indicates a checkpoint is not cosigned
+	// by enough witnesses.
+	ErrWitnessPolicy = errors.New("[witness] policy not satisfied")
+	// ErrUnknownLog indicates a witness does not know the log
+	// of a checkpoint.
+	ErrUnknownLog = errors.New("[witness] unknown log")
+	// ErrSizeConflict indicates a consistency proof does not start
+	// from the last checkpoint cosigned by a witness.
+	ErrSizeConflict = errors.New("[witness] mismatch old size")
+	// ErrInvalidWitnessState indicates the state of a witness
+	// is malformed.
+	ErrInvalidWitnessState = errors.New("[witness] invalid state")
+)
+
+// ed25519Key returns the Ed25519 public key of k. Notes
+// are only signed with Ed25519.
+func (k *VerificationKey) ed25519Key() (ed25519.PublicKey, error) {
+	if k.Algorithm != SignatureEd25519 || len(k.Public) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: notes are signed with %s, not %s", ErrAlgorithmMismatch, SignatureEd25519, k.Algorithm)
+	}
+	return ed25519.PublicKey(k.Public), nil
+}
+
+func (k *SigningKey) ed25519Key() (ed25519.PrivateKey, error) {
+	if k.Algorithm != SignatureEd25519 || len(k.Private) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%w: notes are signed with %s, not %s", ErrAlgorithmMismatch, SignatureEd25519, k.Algorithm)
+	}
+	return ed25519.PrivateKey(k.Private), nil
+}
+
+// NoteKey returns the key of the log in the format of the
+// verifier keys of the Go checksum database.
+func (k *LogKey) NoteKey() (string, error) {
+	pub, err := k.ed25519Key()
+	if err != nil {
+		return "", err
+	}
+	return note.VerifierKey(k.Origin, note.AlgEd25519, pub)
+}
+
+// parseCheckpoint parses the text of a checkpoint
+// note, ignoring extension lines.
+func parseCheckpoint(text string) (*LogCheckpoint, error) {
+	lines := strings.SplitN(text, "\n", 4)
+	if len(lines) < 4 {
+		return nil, fmt.Errorf("%w: checkpoint", ErrInvalidNote)
+	}
+	size, err := strconv.ParseUint(lines[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: size: %w", ErrInvalidNote, err)
+	}
+	c := &LogCheckpoint{Origin: lines[0], Size: size}
+	if c.RootHash, err = base64.StdEncoding.DecodeString(lines[2]); err != nil || len(c.RootHash) != tlog.HashSize {
+		return nil, fmt.Errorf("%w: root hash", ErrInvalidNote)
+	}
+	return c, nil
+}
+
+// Note returns the checkpoint as a note signed by key,
+// named after the origin of the log.
+func (c *LogCheckpoint) Note(key *SigningKey) ([]byte, error) {
+	priv, err := key.ed25519Key()
+	if err != nil {
+		return nil, err
+	}
+	n := note.Note{Text: string(c.body())}
+	if err := n.Sign(c.Origin, priv); err != nil {
+		return nil, err
+	}
+	return n.Marshal()
+}
+
+// CheckpointNote returns the current checkpoint of the log as a note.
+func (l *MemoryLog) CheckpointNote() ([]byte, error) {
+	c, err := l.Checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	return c.Note(l.key)
+}
+
+// openCheckpointNote parses a checkpoint note and verifies
+// the signature of the log.
+func openCheckpointNote(b []byte, log *LogKey) (*note.Note, *LogCheckpoint, error) {
+	pub, err := log.ed25519Key()
+	if err != nil {
+		return nil, nil, err
+	}
+	n, err := note.Parse(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidNote, err)
+	}
+	c, err := parseCheckpoint(n.Text)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.Origin != log.Origin || !n.Verify(log.Origin, pub) {
+		return nil, nil, fmt.Errorf("%w: not signed by %q", ErrInvalidNote, log.Origin)
+	}
+	return n, c, nil
+}
+
+// OpenCheckpointNote parses a checkpoint note, and verifies
+// that it is signed by log.
+func OpenCheckpointNote(b []byte, log *LogKey) (*LogCheckpoint, error) {
+	_, c, err := openCheckpointNote(b, log)
+	return c, err
+}
+
+// WitnessKey identifies a witness trusted by verifiers.
+type WitnessKey struct {
+	Name string `json:"name"`
+	VerificationKey
+}
+
+// NoteKey returns the key of the witness in the format of the
+// verifier keys of the Go checksum database.
+func (k *WitnessKey) NoteKey() (string, error) {
+	pub, err := k.ed25519Key()
+	if err != nil {
+		return "", err
+	}
+	return note.VerifierKey(k.Name, note.AlgCosignatureV1, pub)
+}
+
+// Witness cosigns the checkpoints of logs, after checking that
+// each is consistent with the last one it cosigned for the log.
+// Verifiers that trust a witness know that the log showed them
+// the same history as to every other client of the witness.
+type Witness struct {
+	name string
+	key  ed25519.PrivateKey
+	logs map[string]*LogKey
+	// Now returns the time of cosignatures. If nil,
+	// time.Now is used.
+	Now func() time.Time
+	// Store, if not nil, durably stores the state of the witness,
+	// as read by LoadState. It is called with the checkpoint to
+	// cosign before the cosignature is returned, so that the
+	// witness never forgets a checkpoint it cosigned. If it fails,
+	// the checkpoint is not cosigned.
+	Store func(state []byte) error
+
+	mu     sync.Mutex
+	latest map[string]*LogCheckpoint
+}
+
+// NewWitness creates a witness named name, cosigning with key
+// the checkpoints of logs.
+func NewWitness(name string, key *SigningKey, logs ...*LogKey) (*Witness, error) {
+	priv, err := key.ed25519Key()
+	if err != nil {
+		return nil, err
+	}
+	w := &Witness{
+		name:   name,
+		key:    priv,
+		logs:   make(map[string]*LogKey),
+		latest: make(map[string]*LogCheckpoint),
+	}
+	for _, l := range logs {
+		w.logs[l.Origin] = l
+	}
+	return w, nil
+}
+
+// witnessState is the state of a witness, as stored by Store.
+type witnessState struct {
+	Checkpoints []*LogCheckpoint `json:"checkpoints"`
+}
+
+// LoadState restores the last checkpoints cosigned by the
+// witness from state, as stored by Store. It must be called
+// before the witness cosigns checkpoints.
+func (w *Witness) LoadState(reader io.Reader) error {
+	var state witnessState
+	if err := json.NewDecoder(reader).Decode(&state); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidWitnessState, err)
+	}
+	latest := make(map[string]*LogCheckpoint, len(state.Checkpoints))
+	for _, c := range state.Checkpoints {
+		if c == nil || len(c.RootHash) != tlog.HashSize {
+			return fmt.Errorf("%w: checkpoint", ErrInvalidWitnessState)
+		}
+		if _, ok := latest[c.Origin]; ok {
+			return fmt.Errorf("%w: duplicate origin %q", ErrInvalidWitnessState, c.Origin)
+		}
+		latest[c.Origin] = c
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.latest = latest
+	return nil
+}
+
+// store stores the state of the witness with the checkpoint c.
+// The caller holds w.mu.
+func (w *Witness) store(c *LogCheckpoint) error {
+	if w.Store == nil {
+		return nil
+	}
+	var state witnessState
+	for origin, latest := range w.latest {
+		if origin != c.Origin {
+			state.Checkpoints = append(state.Checkpoints, latest)
+		}
+	}
+	state.Checkpoints = append(state.Checkpoints, c)
+	sort.Slice(state.Checkpoints, func(i, j int) bool {
+		return state.Checkpoints[i].Origin < state.Checkpoints[j].Origin
+	})
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return w.Store(b)
+}
+
+// Size returns the size of the last checkpoint cosigned for the
+// log of origin. Consistency proofs sent to Cosign start from it.
+func (w *Witness) Size(origin string) uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size(origin)
+}
+
+func (w *Witness) size(origin string) uint64 {
+	if c, ok := w.latest[origin]; ok {
+		return c.Size
+	}
+	return 0
+}
+
+// Cosign verifies the checkpoint note, and that proof proves its
+// consistency with the last checkpoint cosigned for the log, of
+// size oldSize. It returns the note with the cosignature of the
+// witness added.
+func (w *Witness) Cosign(b []byte, oldSize uint64, proof [][]byte) ([]byte, error) {
+	n, err := note.Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidNote, err)
+	}
+	c, err := parseCheckpoint(n.Text)
+	if err != nil {
+		return nil, err
+	}
+	log, ok := w.logs[c.Origin]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownLog, c.Origin)
+	}
+	if _, _, err := openCheckpointNote(b, log); err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if size := w.size(c.Origin); oldSize != size {
+		return nil, fmt.Errorf("%w: %d, witness is at %d", ErrSizeConflict, oldSize, size)
+	}
+	if latest, ok := w.latest[c.Origin]; ok {
+		if err := latest.VerifyConsistency(c, proof); err != nil {
+			return nil, fmt.Errorf("%w: from size %d: %w", ErrInconsistentCheckpoint, latest.Size, err)
+		}
+	} else if len(proof) != 0 {
+		return nil, fmt.Errorf("%w: proof from an empty log", ErrInconsistentCheckpoint)
+	}
+	now := time.Now
+	if w.Now != nil {
+		now = w.Now
+	}
+	if err := n.Cosign(w.name, w.key, now()); err != nil {
+		return nil, err
+	}
+	cosigned, err := n.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.store(c); err != nil {
+		return nil, err
+	}
+	w.latest[c.Origin] = c
+	return cosigned, nil
+}
+
+// maxAddCheckpoint limits the size of add-checkpoint requests.
+const maxAddCheckpoint = 1 << 20
+
+// ServeHTTP serves the add-checkpoint endpoint of
+// https://c2sp.org/tlog-witness. It responds with
+// the cosignature line of the witness.
+func (w *Witness) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxAddCheckpoint))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	oldSize, proof, b, err := parseAddCheckpoint(body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cosigned, err := w.Cosign(b, oldSize, proof)
+	switch {
+	case errors.Is(err, ErrSizeConflict):
+		var origin string
+		if n, err := note.Parse(b); err == nil {
+			origin, _, _ = strings.Cut(n.Text, "\n")
+		}
+		rw.Header().Set("Content-Type", "text/x.tlog.size")
+		rw.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(rw, "%d\n", w.Size(origin))
+		return
+	case errors.Is(err, ErrUnknownLog):
+		http.Error(rw, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, ErrInconsistentCheckpoint):
+		http.Error(rw, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, ErrInvalidNote):
+		http.Error(rw, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The cosignature is the last line of the note.
+	i := bytes.LastIndex(cosigned[:len(cosigned)-1], []byte("\n"))
+	rw.Write(cosigned[i+1:])
+}
+
+// parseAddCheckpoint parses the body of an add-checkpoint request.
+func parseAddCheckpoint(body []byte) (uint64, [][]byte, []byte, error) {
+	header, b, ok := bytes.Cut(body, []byte("\n\n"))
+	if !ok {
+		return 0, nil, nil, fmt.Errorf("malformed request")
+	}
+	lines := strings.Split(string(header), "\n")
+	size, ok := strings.CutPrefix(lines[0], "old ")
+	if !ok {
+		return 0, nil, nil, fmt.Errorf("malformed old size")
+	}
+	oldSize, err := strconv.ParseUint(size, 10, 64)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("malformed old size: %w", err)
+	}
+	var proof [][]byte
+	for _, l := range lines[1:] {
+		h, err := base64.StdEncoding.DecodeString(l)
+		if err != nil || len(h) != tlog.HashSize {
+			return 0, nil, nil, fmt.Errorf("malformed proof")
+		}
+		proof = append(proof, h)
+	}
+	return oldSize, proof, b, nil
+}
+
+// AddCheckpointRequest returns the body of an add-checkpoint
+// request to a witness at oldSize.
+func AddCheckpointRequest(b []byte, oldSize uint64, proof [][]byte) []byte {
+	body := []byte("old " + strconv.FormatUint(oldSize, 10) + "\n")
+	for _, h := range proof {
+		body = append(body, base64.StdEncoding.EncodeToString(h)...)
+		body = append(body, '\n')
+	}
+	body = append(body, '\n')
+	return append(body, b...)
+}
+
+// WitnessPolicy requires checkpoints to be cosigned by at least
+// Threshold of the Witnesses.
+type WitnessPolicy struct {
+	Threshold int           `json:"threshold"`
+	Witnesses []*WitnessKey `json:"witnesses"`
+}
+
+// Verify verifies that the checkpoint note is signed by log and
+// satisfies the policy, and returns the checkpoint.
+func (p *WitnessPolicy) Verify(b []byte, log *LogKey) (*LogCheckpoint, error) {
+	if p.Threshold <= 0 || p.Threshold > len(p.Witnesses) {
+		return nil, fmt.Errorf("%w: threshold %d of %d witnesses", ErrWitnessPolicy, p.Threshold, len(p.Witnesses))
+	}
+	n, c, err := openCheckpointNote(b, log)
+	if err != nil {
+		return nil, err
+	}
+	// Witnesses listed twice count once.
+	cosigned := make(map[string]bool)
+	for _, w := range p.Witnesses {
+		pub, err := w.ed25519Key()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := n.VerifyCosignature(w.Name, pub); ok {
+			cosigned[w.Name+"\n"+string(pub)] = true
+		}
+	}
+	if len(cosigned) < p.Threshold {
+		return nil, fmt.Errorf("%w: %d of %d cosignatures", ErrWitnessPolicy, len(cosigned), p.Threshold)
+	}
+	return c, nil
+}
+
+// AddCheckpointNote attaches the checkpoint note, signed by log,
+// to the proof of inclusion in the log of the same checkpoint.
+func (s *SignedTreeHead) AddCheckpointNote(b []byte, log *LogKey) error {
+	c, err := OpenCheckpointNote(b, log)
+	if err != nil {
+		return err
+	}
+	for i := range s.LogProofs {
+		p := &s.LogProofs[i].Checkpoint
+		if p.Origin == c.Origin && p.Size == c.Size && bytes.Equal(p.RootHash, c.RootHash) {
+			s.LogProofs[i].Note = b
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: no proof for checkpoint of size %d", ErrNoLogProof, c.Size)
+}
+
+// VerifyWitnessedLogProof verifies the proof of inclusion of the
+// tree head in log like VerifyLogProof, and that its checkpoint
+// note satisfies policy.
+func (s *SignedTreeHead) VerifyWitnessedLogProof(log *LogKey, policy *WitnessPolicy) (*LogProof, error) {
+	p, err := s.VerifyLogProof(log)
+	if err != nil {
+		return nil, err
+	}
+	if p.Note == nil {
+		return nil, fmt.Errorf("%w: no checkpoint note", ErrWitnessPolicy)
+	}
+	c, err := policy.Verify(p.Note, log)
+	if err != nil {
+		return nil, err
+	}
+	if c.Size != p.Checkpoint.Size || !bytes.Equal(c.RootHash, p.Checkpoint.RootHash) {
+		return nil, fmt.Errorf("%w: note does not match checkpoint", ErrInvalidLogProof)
+	}
+	return p, nil
+}
+
+// VerifyWitnessedTreeHead verifies the tree head like
+// VerifyTreeHead, and that it is included in log at a
+// checkpoint that satisfies policy.
+func (r *Verifier) VerifyWitnessedTreeHead(s *SignedTreeHead, key *VerificationKey, log *LogKey, policy *WitnessPolicy) error {
+	if err := r.VerifyTreeHead(s, key); err != nil {
+		return err
+	}
+	_, err := s.VerifyWitnessedLogProof(log, policy)
+	return err
+}
@@ -0,0 +1,406 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/laurentsimon/dataset-recorder/pkg/internal/note"
+)
+
+func newTestWitness(t *testing.T, name string, logs ...*LogKey) (*Witness, *WitnessKey) {
+	t.Helper()
+	key, err := GenerateSigningKey(nil, SignatureEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vkey, err := key.VerificationKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWitness(name, key, logs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, &WitnessKey{Name: name, VerificationKey: *vkey}
+}
+
+// cosign has the witness cosign the current checkpoint of log.
+func cosign(t *testing.T, w *Witness, log *MemoryLog, b []byte) []byte {
+	t.Helper()
+	c, err := log.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := w.Size(c.Origin)
+	proof, err := log.ConsistencyProof(old, c.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cosigned, err := w.Cosign(b, old, proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cosigned
+}
+
+func Test_WitnessedTreeHead(t *testing.T) {
+	t.Parallel()
+
+	log, logKey := newTestLog(t, "example.com/log")
+	var (
+		witnesses []*Witness
+		policy    WitnessPolicy
+	)
+	for _, name := range []string{"w1.example", "w2.example", "w3.example"} {
+		w, k := newTestWitness(t, name, logKey)
+		witnesses = append(witnesses, w)
+		policy.Witnesses = append(policy.Witnesses, k)
+	}
+
+	signed, vkey, v := newTestSignedTreeHead(t)
+	for i := 0; i < 2; i++ {
+		if _, err := log.Append([]byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+		b, err := log.CheckpointNote()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range witnesses {
+			cosign(t, w, log, b)
+		}
+	}
+	if _, err := signed.Submit(log); err != nil {
+		t.Fatal(err)
+	}
+	b, err := log.CheckpointNote()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two of the three witnesses cosign.
+	for _, w := range witnesses[:2] {
+		b = cosign(t, w, log, b)
+	}
+	if err := signed.AddCheckpointNote(b, logKey); err != nil {
+		t.Fatal(err)
+	}
+
+	policy.Threshold = 2
+	if err := v.VerifyWitnessedTreeHead(signed, vkey, logKey, &policy); err != nil {
+		t.Fatal(err)
+	}
+	policy.Threshold = 3
+	if err := v.VerifyWitnessedTreeHead(signed, vkey, logKey, &policy); !errors.Is(err, ErrWitnessPolicy) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Witnesses listed twice count once.
+	dup := WitnessPolicy{Threshold: 2, Witnesses: []*WitnessKey{policy.Witnesses[0], policy.Witnesses[0]}}
+	if _, err := signed.VerifyWitnessedLogProof(logKey, &dup); !errors.Is(err, ErrWitnessPolicy) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	for _, threshold := range []int{0, 4} {
+		p := WitnessPolicy{Threshold: threshold, Witnesses: policy.Witnesses}
+		if _, err := signed.VerifyWitnessedLogProof(logKey, &p); !errors.Is(err, ErrWitnessPolicy) {
+			t.Fatalf("threshold %d: unexpected err: %v", threshold, err)
+		}
+	}
+	// A note of another checkpoint.
+	if _, err := log.Append([]byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	other, err := log.CheckpointNote()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signed.AddCheckpointNote(other, logKey); !errors.Is(err, ErrNoLogProof) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	signed.LogProofs[0].Note = other
+	policy.Threshold = 1
+	if _, err := signed.VerifyWitnessedLogProof(logKey, &policy); !errors.Is(err, ErrWitnessPolicy) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func Test_WitnessConsistency(t *testing.T) {
+	t.Parallel()
+
+	key, err := GenerateSigningKey(nil, SignatureEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vkey, err := key.VerificationKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logKey := &LogKey{Origin: "example.com/log", VerificationKey: *vkey}
+	// The log shows two histories, with the same key.
+	log, err := NewMemoryLog(logKey.Origin, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork, err := NewMemoryLog(logKey.Origin, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []string{"a", "b", "c"} {
+		if _, err := log.Append([]byte(e)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fork.Append([]byte(e)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := log.Append([]byte("d")); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []string{"x", "y"} {
+		if _, err := fork.Append([]byte(e)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w, _ := newTestWitness(t, "w.example", logKey)
+	b, err := log.CheckpointNote()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cosign(t, w, log, b)
+	if w.Size(logKey.Origin) != 4 {
+		t.Fatalf("unexpected size: %d", w.Size(logKey.Origin))
+	}
+
+	// The fork is not consistent with the cosigned checkpoint.
+	b, err = fork.CheckpointNote()
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := fork.ConsistencyProof(4, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Cosign(b, 4, proof); !errors.Is(err, ErrInconsistentCheckpoint) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := w.Cosign(b, 3, proof); !errors.Is(err, ErrSizeConflict) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Nor are smaller checkpoints.
+	c := LogCheckpoint{Origin: logKey.Origin, Size: 3, RootHash: make([]byte, 32)}
+	if b, err = c.Note(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Cosign(b, 4, nil); !errors.Is(err, ErrInconsistentCheckpoint) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// Checkpoints of other logs, or not signed by the log.
+	other, _ := newTestLog(t, "example.com/other")
+	if b, err = other.CheckpointNote(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Cosign(b, 0, nil); !errors.Is(err, ErrUnknownLog) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	otherKey, err := GenerateSigningKey(nil, SignatureEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err = c.Note(otherKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Cosign(b, 4, nil); !errors.Is(err, ErrInvalidNote) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}
+
+func Test_WitnessHTTP(t *testing.T) {
+	t.Parallel()
+
+	log, logKey := newTestLog(t, "example.com/log")
+	w, wkey := newTestWitness(t, "w.example", logKey)
+	srv := httptest.NewServer(w)
+	defer srv.Close()
+
+	post := func(body []byte) (int, []byte) {
+		resp, err := http.Post(srv.URL, "text/plain", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, b
+	}
+	for _, e := range []string{"a", "b", "c"} {
+		if _, err := log.Append([]byte(e)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := log.CheckpointNote()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, line := post(AddCheckpointRequest(b, 0, nil))
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", status, line)
+	}
+	policy := WitnessPolicy{Threshold: 1, Witnesses: []*WitnessKey{wkey}}
+	if _, err := policy.Verify(append(b, line...), logKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := log.Append([]byte("d")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = log.CheckpointNote(); err != nil {
+		t.Fatal(err)
+	}
+	status, body := post(AddCheckpointRequest(b, 0, nil))
+	if status != http.StatusConflict || string(body) != "3\n" {
+		t.Fatalf("unexpected response %d: %s", status, body)
+	}
+	proof, err := log.ConsistencyProof(3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof[0][0] ^= 1
+	if status, body = post(AddCheckpointRequest(b, 3, proof)); status != http.StatusUnprocessableEntity {
+		t.Fatalf("unexpected response %d: %s", status, body)
+	}
+	proof[0][0] ^= 1
+	if status, body = post(AddCheckpointRequest(b, 3, proof)); status != http.StatusOK {
+		t.Fatalf("unexpected response %d: %s", status, body)
+	}
+	if status, body = post([]byte("old 3\n")); status != http.StatusBadRequest {
+		t.Fatalf("unexpected response %d: %s", status, body)
+	}
+}
+
+func Test_WitnessState(t *testing.T) {
+	t.Parallel()
+
+	log, logKey := newTestLog(t, "example.com/log")
+	key, err := GenerateSigningKey(nil, SignatureEd25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWitness("w.example", key, logKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state []byte
+	w.Store = func(b []byte) error {
+		state = b
+		return nil
+	}
+	for _, e := range []string{"a", "b", "c"} {
+		if _, err := log.Append([]byte(e)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old, err := log.CheckpointNote()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cosign(t, w, log, old)
+	if _, err := log.Append([]byte("d")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := log.CheckpointNote()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cosign(t, w, log, b)
+
+	// A failed store does not cosign, nor update the witness.
+	if _, err := log.Append([]byte("e")); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := log.CheckpointNote()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errStore := errors.New("store")
+	w.Store = func([]byte) error { return errStore }
+	proof, err := log.ConsistencyProof(4, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Cosign(latest, 4, proof); !errors.Is(err, errStore) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if size := w.Size(logKey.Origin); size != 4 {
+		t.Fatalf("unexpected size: %d", size)
+	}
+
+	// A restarted witness remembers the last checkpoint it cosigned.
+	restarted, err := NewWitness("w.example", key, logKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.LoadState(bytes.NewReader(state)); err != nil {
+		t.Fatal(err)
+	}
+	if size := restarted.Size(logKey.Origin); size != 4 {
+		t.Fatalf("unexpected size: %d", size)
+	}
+	if _, err := restarted.Cosign(old, 0, nil); !errors.Is(err, ErrSizeConflict) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := restarted.Cosign(latest, 4, proof); err != nil {
+		t.Fatal(err)
+	}
+
+	c := `{"origin":"example.com/log","size":1,"rootHash":"` + base64.StdEncoding.EncodeToString(make([]byte, 32)) + `"}`
+	for _, b := range []string{
+		`not json`,
+		`{"checkpoints":[null]}`,
+		`{"checkpoints":[{"origin":"example.com/log","size":1,"rootHash":"AA=="}]}`,
+		`{"checkpoints":[` + c + `,` + c + `]}`,
+	} {
+		if err := restarted.LoadState(strings.NewReader(b)); !errors.Is(err, ErrInvalidWitnessState) {
+			t.Errorf("%s: unexpected err: %v", b, err)
+		}
+	}
+}
+
+func Test_NoteKeys(t *testing.T) {
+	t.Parallel()
+
+	_, logKey := newTestLog(t, "example.com/log")
+	_, wkey := newTestWitness(t, "w.example")
+	for _, tt := range []struct {
+		key  func() (string, error)
+		name string
+		alg  byte
+	}{
+		{logKey.NoteKey, "example.com/log", note.AlgEd25519},
+		{wkey.NoteKey, "w.example", note.AlgCosignatureV1},
+	} {
+		s, err := tt.key()
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, alg, _, err := note.ParseVerifierKey(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != tt.name || alg != tt.alg || !strings.HasPrefix(s, tt.name+"+") {
+			t.Fatalf("unexpected key %q", s)
+		}
+	}
+	key, err := GenerateSigningKey(nil, SignatureSLHDSASHAKE128f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewWitness("w.example", key); !errors.Is(err, ErrAlgorithmMismatch) {
+		t.Fatalf("unexpected err: %v", err)
+	}
+}